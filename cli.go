@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"BingPaper/internal/bootstrap"
+	"BingPaper/internal/service/archive"
+	"BingPaper/internal/util"
+
+	"go.uber.org/zap"
+)
+
+// runExport 处理 export 子命令：将图片及元数据导出为归档文件
+func runExport(configPath string, args []string) {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	output := fs.String("o", "", "输出文件路径，- 表示标准输出 (默认根据筛选条件生成文件名)")
+	mkt := fs.String("mkt", "", "地区编码，为空表示全部地区")
+	from := fs.String("from", "", "起始日期 (YYYY-MM-DD，含)")
+	to := fs.String("to", "", "截止日期 (YYYY-MM-DD，含)")
+	variant := fs.String("variant", "", "分辨率，多个以逗号分隔")
+	format := fs.String("format", "", "图片格式，多个以逗号分隔")
+	archiveFormat := fs.String("archive", archive.FormatZip, "归档格式 (zip, tar.gz)")
+	_ = fs.Parse(args)
+
+	opts := archive.ExportOptions{
+		Mkt:      *mkt,
+		From:     *from,
+		To:       *to,
+		Variants: archive.SplitList(*variant),
+		Formats:  archive.SplitList(*format),
+		Archive:  *archiveFormat,
+	}
+	if err := opts.Normalize(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	path := *output
+	if path == "" {
+		path = opts.Filename()
+	}
+	if path == "-" {
+		// 归档写到标准输出，控制台日志改写到标准错误
+		util.ConsoleOutput = os.Stderr
+	}
+
+	bootstrap.InitServices(configPath)
+
+	stats, err := exportArchive(opts, path)
+	if err != nil {
+		util.Logger.Error("Export failed", zap.String("path", path), zap.Error(err))
+		_ = util.Logger.Sync()
+		os.Exit(1)
+	}
+	if path != "-" {
+		fmt.Fprintf(os.Stderr, "Exported %d images (%d files, %d skipped) to %s\n", stats.Images, stats.Files, stats.Skipped, path)
+	}
+}
+
+// exportArchive 将归档写入 path（- 表示标准输出）。写入文件失败时删除不完整的文件。
+func exportArchive(opts archive.ExportOptions, path string) (archive.ExportStats, error) {
+	if path == "-" {
+		return archive.Export(context.Background(), opts, os.Stdout)
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return archive.ExportStats{}, err
+	}
+	stats, err := archive.Export(context.Background(), opts, f)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(path)
+	}
+	return stats, err
+}
+
+// runImport 处理 import 子命令：从目录或归档文件导入图片，不访问 Bing
+func runImport(configPath string, args []string) {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	mkt := fs.String("mkt", "", "元数据中没有地区时使用的地区，默认使用 default_region")
+	force := fs.Bool("force", false, "覆盖已存在的同日同地区记录")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: BingPaper import [flags] <目录或 zip/tar.gz 归档>")
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	bootstrap.InitServices(configPath)
+
+	stats, err := archive.ImportPath(context.Background(), fs.Arg(0), archive.ImportOptions{Mkt: *mkt, Force: *force})
+	fmt.Fprintf(os.Stderr, "Imported %d of %d images (%d skipped, %d failed)\n", stats.Imported, stats.Images, stats.Skipped, stats.Failed)
+	if err != nil {
+		util.Logger.Fatal("Import finished with errors", zap.Error(err))
+	}
+}
@@ -13,18 +13,40 @@ import (
 	apphttp "BingPaper/internal/http"
 	"BingPaper/internal/repo"
 	"BingPaper/internal/service/fetcher"
+	"BingPaper/internal/service/job"
 	"BingPaper/internal/storage"
-	"BingPaper/internal/storage/local"
-	"BingPaper/internal/storage/s3"
-	"BingPaper/internal/storage/webdav"
+	"BingPaper/internal/storage/backend"
 	"BingPaper/internal/util"
 
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
 )
 
-// Init initializes the application services.
+// Init initializes the application services and background tasks, and returns the HTTP router.
 func Init(webFS embed.FS, configPath string) *gin.Engine {
+	InitServices(configPath)
+
+	if err := job.RecoverInterrupted(); err != nil {
+		util.Logger.Warn("Failed to mark interrupted jobs", zap.Error(err))
+	}
+
+	cron.InitCron()
+
+	f := fetcher.NewFetcher()
+	params := map[string]interface{}{"n": config.BingFetchN, "trigger": "startup"}
+	if _, err := job.Submit(job.TypeFetch, params, func(ctx context.Context) error {
+		_, err := f.Fetch(ctx, config.BingFetchN, false)
+		return err
+	}); err != nil {
+		util.Logger.Error("Failed to submit startup fetch job", zap.Error(err))
+	}
+
+	return apphttp.SetupRouter(webFS)
+}
+
+// InitServices loads the configuration and initializes logging, the database and storage.
+// Command line subcommands use it directly so they don't start cron or the HTTP server.
+func InitServices(configPath string) {
 	_ = os.MkdirAll("data/picture", 0755)
 	_ = os.MkdirAll("data/layout", 0755)
 
@@ -65,6 +87,10 @@ func Init(webFS embed.FS, configPath string) *gin.Engine {
 		util.Logger.Info("WebDAV storage detail",
 			zap.String("url", cfg.Storage.WebDAV.URL),
 		)
+	case "replicated":
+		util.Logger.Info("Replicated storage detail",
+			zap.String("location", backend.Location(cfg.Storage)),
+		)
 	default:
 		util.Logger.Info("Local storage detail",
 			zap.String("root", cfg.Storage.Local.Root),
@@ -75,43 +101,15 @@ func Init(webFS embed.FS, configPath string) *gin.Engine {
 		util.Logger.Fatal("Failed to initialize database")
 	}
 
-	var s storage.Storage
-	var err error
-	switch cfg.Storage.Type {
-	case "s3":
-		s, err = s3.NewS3Storage(
-			cfg.Storage.S3.Endpoint,
-			cfg.Storage.S3.Region,
-			cfg.Storage.S3.Bucket,
-			cfg.Storage.S3.AccessKey,
-			cfg.Storage.S3.SecretKey,
-			cfg.Storage.S3.PublicURLPrefix,
-			cfg.Storage.S3.ForcePathStyle,
-		)
-	case "webdav":
-		s, err = webdav.NewWebDAVStorage(
-			cfg.Storage.WebDAV.URL,
-			cfg.Storage.WebDAV.Username,
-			cfg.Storage.WebDAV.Password,
-			cfg.Storage.WebDAV.PublicURLPrefix,
-		)
-	default:
-		s, err = local.NewLocalStorage(cfg.Storage.Local.Root)
-	}
-
+	s, err := backend.New(cfg.Storage)
 	if err != nil {
 		util.Logger.Fatal("Failed to initialize storage", zap.Error(err))
 	}
-	storage.GlobalStorage = s
-
-	cron.InitCron()
-
-	go func() {
-		f := fetcher.NewFetcher()
-		_ = f.Fetch(context.Background(), config.BingFetchN, false)
-	}()
-
-	return apphttp.SetupRouter(webFS)
+	s, err = backend.WithCache(s, cfg.Storage)
+	if err != nil {
+		util.Logger.Fatal("Failed to initialize storage cache", zap.Error(err))
+	}
+	storage.SetGlobalStorage(s)
 }
 
 // LogWelcomeInfo prints quick access URLs after startup.
@@ -3,6 +3,7 @@ package config
 import (
 	"fmt"
 	"os"
+	"runtime"
 	"sort"
 	"strings"
 	"sync"
@@ -60,9 +61,17 @@ func (c LogConfig) GetShowDBLog() bool    { return c.ShowDBLog }
 func (c LogConfig) GetDBLogLevel() string { return c.DBLogLevel }
 
 type APIConfig struct {
-	Mode                string `mapstructure:"mode" yaml:"mode"`                                     // local | redirect
-	EnableMktFallback   bool   `mapstructure:"enable_mkt_fallback" yaml:"enable_mkt_fallback"`       // 当请求的地区不存在时，是否回退到默认地区
-	EnableOnDemandFetch bool   `mapstructure:"enable_on_demand_fetch" yaml:"enable_on_demand_fetch"` // 是否启用按需抓取
+	Mode                  string       `mapstructure:"mode" yaml:"mode"`                                         // local | redirect
+	EnableMktFallback     bool         `mapstructure:"enable_mkt_fallback" yaml:"enable_mkt_fallback"`           // 当请求的地区不存在时，是否回退到默认地区
+	EnableOnDemandFetch   bool         `mapstructure:"enable_on_demand_fetch" yaml:"enable_on_demand_fetch"`     // 是否启用按需抓取
+	OnDemandFetchCooldown string       `mapstructure:"on_demand_fetch_cooldown" yaml:"on_demand_fetch_cooldown"` // 按需抓取结束后仍无图片时，同一地区/日期再次抓取前的冷却时间
+	Resize                ResizeConfig `mapstructure:"resize" yaml:"resize"`                                     // 按需缩放 (w/h/fit 参数)
+}
+
+type ResizeConfig struct {
+	Enabled      bool     `mapstructure:"enabled" yaml:"enabled"`             // 是否允许通过 w/h 参数按需生成任意尺寸
+	MaxDimension int      `mapstructure:"max_dimension" yaml:"max_dimension"` // 宽或高的最大像素值
+	AllowedSizes []string `mapstructure:"allowed_sizes" yaml:"allowed_sizes"` // 尺寸白名单 (如 2560x1440)，为空时仅受 max_dimension 限制，任意尺寸都会写回存储
 }
 
 type CronConfig struct {
@@ -71,7 +80,8 @@ type CronConfig struct {
 }
 
 type RetentionConfig struct {
-	Days int `mapstructure:"days" yaml:"days"`
+	Days    int `mapstructure:"days" yaml:"days"`
+	JobDays int `mapstructure:"job_days" yaml:"job_days"` // 已结束任务记录的保留天数，0 表示永久保留
 }
 
 type DBConfig struct {
@@ -79,11 +89,32 @@ type DBConfig struct {
 	DSN  string `mapstructure:"dsn" yaml:"dsn"`
 }
 
+// 存储布局
+const (
+	StorageLayoutName    = "name"    // {imageName}/{imageName}_{variant}.{format}
+	StorageLayoutContent = "content" // sha256/{前两位}/{SHA-256}.{format}，相同内容只存储一份
+)
+
 type StorageConfig struct {
-	Type   string       `mapstructure:"type" yaml:"type"` // local/s3/webdav
-	Local  LocalConfig  `mapstructure:"local" yaml:"local"`
-	S3     S3Config     `mapstructure:"s3" yaml:"s3"`
-	WebDAV WebDAVConfig `mapstructure:"webdav" yaml:"webdav"`
+	Type       string           `mapstructure:"type" yaml:"type"`     // local/s3/webdav/replicated
+	Layout     string           `mapstructure:"layout" yaml:"layout"` // name/content，默认 name
+	Local      LocalConfig      `mapstructure:"local" yaml:"local"`
+	S3         S3Config         `mapstructure:"s3" yaml:"s3"`
+	WebDAV     WebDAVConfig     `mapstructure:"webdav" yaml:"webdav"`
+	Replicated ReplicatedConfig `mapstructure:"replicated" yaml:"replicated,omitempty"`
+	Cache      CacheConfig      `mapstructure:"cache" yaml:"cache"`
+}
+
+// CacheConfig 远程存储的本地磁盘缓存，对 local 存储不生效
+type CacheConfig struct {
+	Enabled   bool   `mapstructure:"enabled" yaml:"enabled"`
+	Dir       string `mapstructure:"dir" yaml:"dir"`
+	MaxSizeMB int64  `mapstructure:"max_size_mb" yaml:"max_size_mb"` // 缓存占用上限 (MB)，超出时淘汰最久未使用的对象
+}
+
+// ReplicatedConfig 复制存储配置，第一个后端为主存储，其余为副本
+type ReplicatedConfig struct {
+	Backends []StorageConfig `mapstructure:"backends" yaml:"backends"`
 }
 
 type LocalConfig struct {
@@ -98,6 +129,17 @@ type S3Config struct {
 	SecretKey       string `mapstructure:"secret_key" yaml:"secret_key"`
 	PublicURLPrefix string `mapstructure:"public_url_prefix" yaml:"public_url_prefix"`
 	ForcePathStyle  bool   `mapstructure:"force_path_style" yaml:"force_path_style"`
+	Presign         bool   `mapstructure:"presign" yaml:"presign"`         // 私有桶：redirect 模式下生成预签名 URL
+	PresignTTL      string `mapstructure:"presign_ttl" yaml:"presign_ttl"` // 预签名 URL 有效期
+}
+
+// GetPresignTTL 返回预签名 URL 的有效期，配置无效时默认 1 小时
+func (c S3Config) GetPresignTTL() time.Duration {
+	ttl, err := time.ParseDuration(c.PresignTTL)
+	if err != nil || ttl <= 0 {
+		return time.Hour
+	}
+	return ttl
 }
 
 type WebDAVConfig struct {
@@ -124,16 +166,135 @@ type WebConfig struct {
 }
 
 type FetcherConfig struct {
-	Regions []string `mapstructure:"regions" yaml:"regions"`
+	Regions  []string        `mapstructure:"regions" yaml:"regions"`
+	Sources  []string        `mapstructure:"sources" yaml:"sources"`   // 启用的图片源，第一个为默认图片源
+	Formats  []string        `mapstructure:"formats" yaml:"formats"`   // 变体输出格式: jpg, webp, avif (jpg 始终生成)
+	Variants []VariantConfig `mapstructure:"variants" yaml:"variants"` // 变体矩阵，为空时使用内置默认值
+	// 单张原图下载大小上限 (MB)
+	MaxDownloadMB int64           `mapstructure:"max_download_mb" yaml:"max_download_mb"`
+	Retry         RetryConfig     `mapstructure:"retry" yaml:"retry"`
+	RateLimit     RateLimitConfig `mapstructure:"rate_limit" yaml:"rate_limit"`
+	// 同时抓取的地区数，<= 0 时为 1
+	RegionConcurrency int `mapstructure:"region_concurrency" yaml:"region_concurrency"`
+	// 同时缩放编码变体的 worker 数，<= 0 时为 CPU 核数
+	VariantConcurrency int        `mapstructure:"variant_concurrency" yaml:"variant_concurrency"`
+	Bing               BingConfig `mapstructure:"bing" yaml:"bing"`
+}
+
+// BingConfig Bing 接口与图片下载地址，可指向镜像或本地替身服务（用于离线测试）
+type BingConfig struct {
+	APIBase   string `mapstructure:"api_base" yaml:"api_base"`     // HPImageArchive 接口地址
+	ImageHost string `mapstructure:"image_host" yaml:"image_host"` // 图片地址前缀，与 urlbase 拼接成下载地址
+}
+
+// GetAPIBase 返回 HPImageArchive 接口地址，未配置时使用官方地址
+func (c BingConfig) GetAPIBase() string {
+	if c.APIBase == "" {
+		return BingAPIBase
+	}
+	return c.APIBase
+}
+
+// GetImageHost 返回图片地址前缀（不含末尾的 /），未配置时使用官方地址
+func (c BingConfig) GetImageHost() string {
+	if c.ImageHost == "" {
+		return BingImageHost
+	}
+	return strings.TrimRight(c.ImageHost, "/")
+}
+
+// RetryConfig 访问 Bing 失败（网络错误、429、5xx）时的重试策略
+type RetryConfig struct {
+	MaxAttempts    int    `mapstructure:"max_attempts" yaml:"max_attempts"`       // 最多尝试次数（含首次）
+	InitialBackoff string `mapstructure:"initial_backoff" yaml:"initial_backoff"` // 首次重试前的等待时间，之后每次翻倍
+	MaxBackoff     string `mapstructure:"max_backoff" yaml:"max_backoff"`         // 单次等待的上限
+}
+
+// RateLimitConfig 对同一主机的请求限速（令牌桶），所有地区共享
+type RateLimitConfig struct {
+	RequestsPerSecond float64 `mapstructure:"requests_per_second" yaml:"requests_per_second"` // <= 0 表示不限速
+	Burst             int     `mapstructure:"burst" yaml:"burst"`
+}
+
+// GetMaxAttempts 返回最多尝试次数，至少为 1
+func (c RetryConfig) GetMaxAttempts() int {
+	return max(c.MaxAttempts, 1)
+}
+
+// GetBackoff 返回首次等待时间与等待上限，配置无效时分别默认 1 秒和 30 秒
+func (c RetryConfig) GetBackoff() (time.Duration, time.Duration) {
+	initial, err := time.ParseDuration(c.InitialBackoff)
+	if err != nil || initial <= 0 {
+		initial = time.Second
+	}
+	maxBackoff, err := time.ParseDuration(c.MaxBackoff)
+	if err != nil || maxBackoff < initial {
+		maxBackoff = max(30*time.Second, initial)
+	}
+	return initial, maxBackoff
+}
+
+// GetRegionConcurrency 返回同时抓取的地区数
+func (c FetcherConfig) GetRegionConcurrency() int {
+	return max(c.RegionConcurrency, 1)
+}
+
+// GetVariantConcurrency 返回同时缩放编码变体的 worker 数
+func (c FetcherConfig) GetVariantConcurrency() int {
+	if c.VariantConcurrency <= 0 {
+		return runtime.NumCPU()
+	}
+	return c.VariantConcurrency
+}
+
+// GetMaxDownloadBytes 返回单张原图下载大小上限，配置无效时默认 50 MB
+func (c FetcherConfig) GetMaxDownloadBytes() int64 {
+	if c.MaxDownloadMB <= 0 {
+		return 50 << 20
+	}
+	return c.MaxDownloadMB << 20
+}
+
+type VariantConfig struct {
+	Name    string   `mapstructure:"name" yaml:"name" json:"name"`                              // 变体名称，如 1920x1080
+	Width   int      `mapstructure:"width" yaml:"width" json:"width"`                           // 目标宽度
+	Height  int      `mapstructure:"height" yaml:"height" json:"height"`                        // 目标高度
+	Fit     string   `mapstructure:"fit" yaml:"fit" json:"fit"`                                 // fill (裁剪填满) | fit (等比不裁剪)，默认 fill
+	Anchor  string   `mapstructure:"anchor" yaml:"anchor" json:"anchor"`                        // fill 模式的裁剪锚点: center, top, bottom, left, right 等，默认 center
+	Formats []string `mapstructure:"formats" yaml:"formats,omitempty" json:"formats,omitempty"` // 覆盖 fetcher.formats，为空时使用全局设置
+	Quality int      `mapstructure:"quality" yaml:"quality" json:"quality"`                     // 编码质量 (1-100)，默认 100；webp/avif 未配置时分别使用 80/60
+}
+
+// DefaultVariants 内置的默认变体矩阵
+var DefaultVariants = []VariantConfig{
+	{Name: "1920x1200", Width: 1920, Height: 1200},
+	{Name: "1920x1080", Width: 1920, Height: 1080},
+	{Name: "1080x1920", Width: 1080, Height: 1920},
+	{Name: "1366x768", Width: 1366, Height: 768},
+	{Name: "1280x768", Width: 1280, Height: 768},
+	{Name: "1024x768", Width: 1024, Height: 768},
+	{Name: "800x600", Width: 800, Height: 600},
+	{Name: "800x480", Width: 800, Height: 480},
+	{Name: "768x1280", Width: 768, Height: 1280},
+	{Name: "720x1280", Width: 720, Height: 1280},
+	{Name: "640x480", Width: 640, Height: 480},
+	{Name: "480x800", Width: 480, Height: 800},
+	{Name: "400x240", Width: 400, Height: 240},
+	{Name: "320x240", Width: 320, Height: 240},
+	{Name: "240x320", Width: 240, Height: 320},
 }
 
 // Bing 默认配置 (内置)
 const (
-	BingMkt     = "zh-CN"
-	BingFetchN  = 8
-	BingAPIBase = "https://www.bing.com/HPImageArchive.aspx"
+	BingMkt       = "zh-CN"
+	BingFetchN    = 8
+	BingAPIBase   = "https://www.bing.com/HPImageArchive.aspx"
+	BingImageHost = "https://www.bing.com"
 )
 
+// SourceBing Bing 每日图片 (HPImageArchive) 图片源
+const SourceBing = "bing"
+
 var (
 	GlobalConfig *Config
 	configLock   sync.RWMutex
@@ -165,13 +326,24 @@ func Init(configPath string) error {
 	v.SetDefault("api.mode", "redirect")
 	v.SetDefault("api.enable_mkt_fallback", false)
 	v.SetDefault("api.enable_on_demand_fetch", false)
+	v.SetDefault("api.on_demand_fetch_cooldown", "30m")
+	v.SetDefault("api.resize.enabled", false)
+	v.SetDefault("api.resize.max_dimension", 3840)
+	v.SetDefault("api.resize.allowed_sizes", []string{})
 	v.SetDefault("cron.enabled", true)
 	v.SetDefault("cron.daily_spec", "10 */2 * * *")
 	v.SetDefault("retention.days", 0)
+	v.SetDefault("retention.job_days", 30)
 	v.SetDefault("db.type", "sqlite")
 	v.SetDefault("db.dsn", "data/bing_paper.db")
 	v.SetDefault("storage.type", "local")
+	v.SetDefault("storage.layout", StorageLayoutName)
 	v.SetDefault("storage.local.root", "data/picture")
+	v.SetDefault("storage.cache.enabled", false)
+	v.SetDefault("storage.cache.dir", "data/cache")
+	v.SetDefault("storage.cache.max_size_mb", 1024)
+	v.SetDefault("storage.s3.presign", false)
+	v.SetDefault("storage.s3.presign_ttl", "1h")
 	v.SetDefault("token.default_ttl", "168h")
 	v.SetDefault("feature.write_daily_files", true)
 	v.SetDefault("web.path", "web")
@@ -182,6 +354,30 @@ func Init(configPath string) error {
 		defaultRegions = append(defaultRegions, r.Value)
 	}
 	v.SetDefault("fetcher.regions", defaultRegions)
+	v.SetDefault("fetcher.formats", []string{"jpg", "webp"})
+	v.SetDefault("fetcher.sources", []string{SourceBing})
+	v.SetDefault("fetcher.max_download_mb", 50)
+	v.SetDefault("fetcher.retry.max_attempts", 3)
+	v.SetDefault("fetcher.retry.initial_backoff", "1s")
+	v.SetDefault("fetcher.retry.max_backoff", "30s")
+	v.SetDefault("fetcher.rate_limit.requests_per_second", 2)
+	v.SetDefault("fetcher.rate_limit.burst", 4)
+	v.SetDefault("fetcher.region_concurrency", 4)
+	v.SetDefault("fetcher.bing.api_base", BingAPIBase)
+	v.SetDefault("fetcher.bing.image_host", BingImageHost)
+	v.SetDefault("fetcher.variant_concurrency", 0)
+	var defaultVariants []map[string]interface{}
+	for _, dv := range DefaultVariants {
+		defaultVariants = append(defaultVariants, map[string]interface{}{
+			"name":    dv.Name,
+			"width":   dv.Width,
+			"height":  dv.Height,
+			"fit":     "fill",
+			"anchor":  "center",
+			"quality": 100,
+		})
+	}
+	v.SetDefault("fetcher.variants", defaultVariants)
 	v.SetDefault("admin.password_bcrypt", "$2a$10$fYHPeWHmwObephJvtlyH1O8DIgaLk5TINbi9BOezo2M8cSjmJchka") // 默认密码: admin123
 
 	// 绑定环境变量
@@ -208,13 +404,13 @@ func Init(configPath string) error {
 		if targetConfigPath == "" {
 			targetConfigPath = "data/config.yaml"
 		}
-		fmt.Printf("Config file not found, creating default config at %s\n", targetConfigPath)
+		fmt.Fprintf(os.Stderr, "Config file not found, creating default config at %s\n", targetConfigPath)
 
 		var defaultCfg Config
 		if err := v.Unmarshal(&defaultCfg); err == nil {
 			data, _ := yaml.Marshal(&defaultCfg)
 			if err := os.WriteFile(targetConfigPath, data, 0644); err != nil {
-				fmt.Printf("Warning: Failed to create default config file: %v\n", err)
+				fmt.Fprintf(os.Stderr, "Warning: Failed to create default config file: %v\n", err)
 			}
 		}
 	}
@@ -227,7 +423,7 @@ func Init(configPath string) error {
 	GlobalConfig = &cfg
 
 	v.OnConfigChange(func(e fsnotify.Event) {
-		fmt.Println("Config file changed:", e.Name)
+		fmt.Fprintln(os.Stderr, "Config file changed:", e.Name)
 		var newCfg Config
 		if err := v.Unmarshal(&newCfg); err == nil {
 			configLock.Lock()
@@ -316,6 +512,15 @@ func GetTokenTTL() time.Duration {
 	return ttl
 }
 
+// GetOnDemandFetchCooldown 返回按需抓取的冷却时间，配置无效时默认 30 分钟
+func GetOnDemandFetchCooldown() time.Duration {
+	cooldown, err := time.ParseDuration(GetConfig().API.OnDemandFetchCooldown)
+	if err != nil || cooldown < 0 {
+		return 30 * time.Minute
+	}
+	return cooldown
+}
+
 // GetDefaultRegion 返回生效的默认地区编码
 func (c *Config) GetDefaultRegion() string {
 	if len(c.Fetcher.Regions) > 0 {
@@ -323,3 +528,26 @@ func (c *Config) GetDefaultRegion() string {
 	}
 	return BingMkt
 }
+
+// GetDefaultSource 返回默认图片源，接口未指定 source 时使用
+func (c *Config) GetDefaultSource() string {
+	if len(c.Fetcher.Sources) > 0 {
+		return c.Fetcher.Sources[0]
+	}
+	return SourceBing
+}
+
+// GetVariants 返回生效的变体矩阵，过滤掉不完整的配置项
+func (c *Config) GetVariants() []VariantConfig {
+	var variants []VariantConfig
+	for _, vc := range c.Fetcher.Variants {
+		if vc.Name == "" || vc.Width <= 0 || vc.Height <= 0 {
+			continue
+		}
+		variants = append(variants, vc)
+	}
+	if len(variants) == 0 {
+		return DefaultVariants
+	}
+	return variants
+}
@@ -65,3 +65,28 @@ func TestDebugFunctions(t *testing.T) {
 		t.Errorf("Expected formatted settings to contain server.port: 9999, got %s", formatted)
 	}
 }
+
+func TestDefaultVariants(t *testing.T) {
+	err := Init("")
+	if err != nil {
+		t.Fatalf("Failed to init config: %v", err)
+	}
+
+	variants := GetConfig().GetVariants()
+	if len(variants) != len(DefaultVariants) {
+		t.Fatalf("Expected %d default variants, got %d", len(DefaultVariants), len(variants))
+	}
+	if variants[1].Name != "1920x1080" || variants[1].Width != 1920 || variants[1].Height != 1080 {
+		t.Errorf("Unexpected default variant: %+v", variants[1])
+	}
+	if variants[1].Quality != 100 || variants[1].Fit != "fill" {
+		t.Errorf("Expected fill/100 defaults, got %+v", variants[1])
+	}
+
+	cfg := *GetConfig()
+	cfg.Fetcher.Variants = []VariantConfig{{Name: "2560x1440", Width: 2560, Height: 1440}, {Name: "broken"}}
+	custom := cfg.GetVariants()
+	if len(custom) != 1 || custom[0].Name != "2560x1440" {
+		t.Errorf("Expected only the valid custom variant, got %+v", custom)
+	}
+}
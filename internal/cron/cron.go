@@ -6,6 +6,7 @@ import (
 	"BingPaper/internal/config"
 	"BingPaper/internal/service/fetcher"
 	"BingPaper/internal/service/image"
+	"BingPaper/internal/service/job"
 	"BingPaper/internal/util"
 
 	"github.com/robfig/cron/v3"
@@ -27,12 +28,16 @@ func InitCron() {
 	_, err := c.AddFunc(cfg.Cron.DailySpec, func() {
 		util.Logger.Info("Running scheduled daily fetch")
 		f := fetcher.NewFetcher()
-		if err := f.Fetch(context.Background(), 1, false); err != nil {
+		params := map[string]interface{}{"n": 1, "trigger": "cron"}
+		if err := job.Run(job.TypeFetch, params, func(ctx context.Context) error {
+			_, err := f.Fetch(ctx, 1, false)
+			return err
+		}); err != nil {
 			util.Logger.Error("Scheduled fetch failed", zap.Error(err))
 		}
 
 		// 抓取后顺便清理
-		if err := image.CleanupOldImages(context.Background()); err != nil {
+		if err := job.Run(job.TypeCleanup, map[string]string{"trigger": "cron"}, image.CleanupOldImages); err != nil {
 			util.Logger.Error("Scheduled cleanup failed", zap.Error(err))
 		}
 	})
@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"context"
+	"errors"
 	"net/http"
 	"strconv"
 	"time"
@@ -9,6 +10,7 @@ import (
 	"BingPaper/internal/config"
 	"BingPaper/internal/service/fetcher"
 	"BingPaper/internal/service/image"
+	"BingPaper/internal/service/job"
 	"BingPaper/internal/service/token"
 
 	"github.com/gin-gonic/gin"
@@ -269,7 +271,8 @@ type ManualFetchRequest struct {
 // @Accept json
 // @Produce json
 // @Param request body ManualFetchRequest false "抓取天数"
-// @Success 200 {object} map[string]string
+// @Success 200 {object} map[string]interface{}
+// @Failure 500 {object} map[string]string
 // @Router /admin/fetch [post]
 func ManualFetch(c *gin.Context) {
 	var req ManualFetchRequest
@@ -288,15 +291,21 @@ func ManualFetch(c *gin.Context) {
 	}
 
 	f := fetcher.NewFetcher()
-	go func() {
-		_ = f.Fetch(context.Background(), req.N, req.Force)
-	}()
+	j, err := job.Submit(job.TypeFetch, req, func(ctx context.Context) error {
+		_, err := f.Fetch(ctx, req.N, req.Force)
+		return err
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"status":  "task started",
 		"message": "抓取任务已启动",
 		"n":       req.N,
 		"force":   req.Force,
+		"job_id":  j.ID,
 	})
 }
 
@@ -306,11 +315,61 @@ func ManualFetch(c *gin.Context) {
 // @Tags admin
 // @Security BearerAuth
 // @Produce json
-// @Success 200 {object} map[string]string
+// @Success 200 {object} map[string]interface{}
+// @Failure 500 {object} map[string]string
 // @Router /admin/cleanup [post]
 func ManualCleanup(c *gin.Context) {
-	go func() {
-		image.CleanupOldImages(context.Background())
-	}()
-	c.JSON(http.StatusOK, gin.H{"status": "task started"})
+	j, err := job.Submit(job.TypeCleanup, nil, image.CleanupOldImages)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "task started", "job_id": j.ID})
+}
+
+// RegenerateVariants 启动变体补齐任务
+// @Summary 启动变体补齐任务
+// @Description 遍历所有历史图片，从已存储的原图重新生成缺失或过期（变体矩阵参数变化）的变体，不会访问 Bing。可选校验存储对象是否丢失。
+// @Tags admin
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param request body fetcher.BackfillOptions false "补齐选项"
+// @Success 200 {object} map[string]string
+// @Failure 409 {object} map[string]string "已有补齐任务在运行"
+// @Router /admin/variants/regenerate [post]
+func RegenerateVariants(c *gin.Context) {
+	var opts fetcher.BackfillOptions
+	_ = c.ShouldBindJSON(&opts)
+
+	f := fetcher.NewFetcher()
+	if err := f.StartBackfill(opts); err != nil {
+		if errors.Is(err, fetcher.ErrBackfillRunning) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "message": "已有变体补齐任务在运行"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "task started",
+		"message": "变体补齐任务已启动",
+	})
+}
+
+// GetVariantBackfillStatus 获取变体补齐任务进度
+// @Summary 获取变体补齐任务进度
+// @Description 返回当前或最近一次变体补齐任务的状态与进度
+// @Tags admin
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {object} fetcher.BackfillProgress
+// @Router /admin/variants/regenerate [get]
+func GetVariantBackfillStatus(c *gin.Context) {
+	p, err := fetcher.GetBackfillProgress()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, p)
 }
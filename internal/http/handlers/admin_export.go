@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"BingPaper/internal/service/archive"
+	"BingPaper/internal/util"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// ExportArchive 导出图片归档
+// @Summary 导出图片归档
+// @Description 以 ZIP 或 tar.gz 流的形式导出图片及元数据。归档开头为 manifest.json 与 manifest.csv，图片位于 images/ 目录下（路径与存储 Key 一致）
+// @Tags admin
+// @Security BearerAuth
+// @Param mkt query string false "地区编码，为空表示全部地区"
+// @Param from query string false "起始日期 (YYYY-MM-DD，含)"
+// @Param to query string false "截止日期 (YYYY-MM-DD，含)"
+// @Param variant query string false "分辨率，多个以逗号分隔，为空表示全部"
+// @Param format query string false "图片格式，多个以逗号分隔，为空表示全部"
+// @Param archive query string false "归档格式 (zip, tar.gz)" default(zip)
+// @Produce application/zip
+// @Success 200 {file} file "归档文件"
+// @Failure 400 {object} map[string]string
+// @Router /admin/export [get]
+func ExportArchive(c *gin.Context) {
+	opts := archive.ExportOptions{
+		Mkt:      c.Query("mkt"),
+		From:     c.Query("from"),
+		To:       c.Query("to"),
+		Variants: archive.SplitList(c.Query("variant")),
+		Formats:  archive.SplitList(c.Query("format")),
+		Archive:  c.DefaultQuery("archive", archive.FormatZip),
+	}
+	if err := opts.Normalize(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("Content-Type", opts.ContentType())
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, opts.Filename()))
+	c.Status(http.StatusOK)
+
+	// 响应头已发送，之后的错误只能记录日志
+	if _, err := archive.Export(c.Request.Context(), opts, c.Writer); err != nil {
+		if !errors.Is(err, c.Request.Context().Err()) {
+			util.Logger.Error("Archive export failed", zap.Error(err))
+		}
+		_ = c.Error(err)
+	}
+}
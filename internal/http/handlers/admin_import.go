@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+
+	"BingPaper/internal/service/archive"
+	"BingPaper/internal/service/job"
+	"BingPaper/internal/util"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ImportArchive 导入图片归档
+// @Summary 导入图片归档
+// @Description 上传 zip 或 tar.gz 归档并在后台导入，不访问 Bing。归档中的 .json 文件作为元数据（兼容 Bing 接口返回的图片对象及导出的 manifest.json），原图文件按 OHR.Name_ROW123_UHD.jpg 等命名与元数据关联；没有元数据的文件需带有日期前缀（如 2024-01-15_OHR.Name_UHD.jpg）。变体会按当前配置重新生成
+// @Tags admin
+// @Security BearerAuth
+// @Accept multipart/form-data
+// @Produce json
+// @Param file formData file true "zip 或 tar.gz 归档"
+// @Param mkt formData string false "元数据中没有地区时使用的地区，默认使用 default_region"
+// @Param force formData bool false "覆盖已存在的同日同地区记录"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]string
+// @Router /admin/import [post]
+func ImportArchive(c *gin.Context) {
+	file, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "file is required"})
+		return
+	}
+	opts := archive.ImportOptions{
+		Mkt:   c.PostForm("mkt"),
+		Force: c.PostForm("force") == "true",
+	}
+	if opts.Mkt != "" && !util.IsValidRegion(opts.Mkt) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("[%s] is not a standard region code", opts.Mkt)})
+		return
+	}
+
+	tmp, err := os.CreateTemp("", "bingpaper-upload-*")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	tmp.Close()
+	if err := c.SaveUploadedFile(file, tmp.Name()); err != nil {
+		os.Remove(tmp.Name())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	params := map[string]interface{}{"filename": file.Filename, "size": file.Size, "mkt": opts.Mkt, "force": opts.Force}
+	j, err := job.Submit(job.TypeImport, params, func(ctx context.Context) error {
+		defer os.Remove(tmp.Name())
+		_, err := archive.ImportPath(ctx, tmp.Name(), opts)
+		return err
+	})
+	if err != nil {
+		os.Remove(tmp.Name())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "task started",
+		"message": "导入任务已启动",
+		"job_id":  j.ID,
+	})
+}
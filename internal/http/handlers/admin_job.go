@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"BingPaper/internal/service/job"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ListJobs 获取后台任务列表
+// @Summary 获取后台任务列表
+// @Description 按创建时间倒序列出抓取、清理、变体补齐等后台任务。支持分页(page, page_size)、限制数量(limit)以及按类型(type)和状态(state)过滤。
+// @Tags admin
+// @Security BearerAuth
+// @Param limit query int false "限制数量 (如果不使用分页，最大 200)" default(30)
+// @Param page query int false "页码 (从1开始)"
+// @Param page_size query int false "每页数量 (最大 200)"
+// @Param type query string false "任务类型 (fetch, cleanup, on_demand_fetch, variant_backfill)"
+// @Param state query string false "任务状态 (pending, running, succeeded, failed)"
+// @Produce json
+// @Success 200 {array} model.Job
+// @Router /admin/jobs [get]
+func ListJobs(c *gin.Context) {
+	limit := 30
+	offset := 0
+	if pageStr, pageSizeStr := c.Query("page"), c.Query("page_size"); pageStr != "" && pageSizeStr != "" {
+		page, _ := strconv.Atoi(pageStr)
+		pageSize, _ := strconv.Atoi(pageSizeStr)
+		if page < 1 {
+			page = 1
+		}
+		if pageSize < 1 {
+			pageSize = 30
+		}
+		limit = pageSize
+		offset = (page - 1) * pageSize
+	} else if limitStr := c.Query("limit"); limitStr != "" {
+		limit, _ = strconv.Atoi(limitStr)
+	}
+
+	jobs, err := job.List(limit, offset, c.Query("type"), c.Query("state"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, jobs)
+}
+
+// GetJob 获取后台任务详情
+// @Summary 获取后台任务详情
+// @Description 返回任务的状态、进度、日志和错误信息
+// @Tags admin
+// @Security BearerAuth
+// @Param id path int true "任务 ID"
+// @Produce json
+// @Success 200 {object} model.Job
+// @Failure 404 {object} map[string]string
+// @Router /admin/jobs/{id} [get]
+func GetJob(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid job id"})
+		return
+	}
+
+	j, err := job.Get(uint(id))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "job not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, j)
+}
+
+// CancelJob 取消正在执行的后台任务
+// @Summary 取消后台任务
+// @Description 请求取消正在执行的任务，任务在下一次检查点退出并标记为失败（错误信息为 canceled by admin）。已完成的进度（如已迁移的对象）会被保留
+// @Tags admin
+// @Security BearerAuth
+// @Param id path int true "任务 ID"
+// @Produce json
+// @Success 200 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string "任务未在运行"
+// @Router /admin/jobs/{id}/cancel [post]
+func CancelJob(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid job id"})
+		return
+	}
+
+	if _, err := job.Get(uint(id)); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "job not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if err := job.Cancel(uint(id)); err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "cancel requested"})
+}
@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"BingPaper/internal/service/fsck"
+	"BingPaper/internal/service/migration"
+
+	"github.com/gin-gonic/gin"
+)
+
+// MigrateStorage 启动存储迁移任务
+// @Summary 启动存储迁移任务
+// @Description 将所有变体对象从当前存储复制到目标存储（local/s3/webdav），逐个回读校验大小与 SHA-256。中断后再次执行会跳过已迁移的对象；update_config 为 true 且全部成功时改写 PublicURL、保存存储配置并立即切换到目标存储
+// @Tags admin
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param request body migration.StorageMigrationOptions true "迁移选项"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]string
+// @Failure 409 {object} map[string]string "已有迁移任务在运行"
+// @Router /admin/storage/migrate [post]
+func MigrateStorage(c *gin.Context) {
+	var opts migration.StorageMigrationOptions
+	if err := c.ShouldBindJSON(&opts); err != nil || opts.Target.Type == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request", "message": "请指定目标存储配置"})
+		return
+	}
+
+	j, err := migration.StartStorageMigration(opts)
+	if err != nil {
+		switch {
+		case errors.Is(err, migration.ErrMigrationRunning):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "message": "已有存储迁移任务在运行"})
+		case errors.Is(err, migration.ErrSameStorage):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "message": "目标存储不能与当前正在使用的存储相同"})
+		case errors.Is(err, migration.ErrInvalidTarget):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "message": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "task started",
+		"message": "存储迁移任务已启动",
+		"job_id":  j.ID,
+	})
+}
+
+// GetStorageMigrationStatus 获取存储迁移进度
+// @Summary 获取存储迁移进度
+// @Description 返回当前或最近一次存储迁移任务的状态与进度
+// @Tags admin
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {object} migration.StorageMigrationProgress
+// @Router /admin/storage/migrate [get]
+func GetStorageMigrationStatus(c *gin.Context) {
+	p, err := migration.GetStorageMigrationProgress()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, p)
+}
+
+// CheckStorage 启动存储一致性检查
+// @Summary 启动存储一致性检查
+// @Description 对比变体记录与存储中的对象，报告丢失的对象、大小不一致的对象和未被引用的孤儿对象（最近一小时内写入的对象不视为孤儿）。可选从原图重新生成有问题的变体，或删除孤儿对象
+// @Tags admin
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param request body fsck.Options false "检查选项"
+// @Success 200 {object} map[string]interface{}
+// @Failure 409 {object} map[string]string "已有检查任务在运行"
+// @Router /admin/storage/fsck [post]
+func CheckStorage(c *gin.Context) {
+	var opts fsck.Options
+	_ = c.ShouldBindJSON(&opts)
+
+	j, err := fsck.Start(opts)
+	if err != nil {
+		if errors.Is(err, fsck.ErrCheckRunning) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "message": "已有存储检查任务在运行"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "task started",
+		"message": "存储检查任务已启动",
+		"job_id":  j.ID,
+	})
+}
+
+// GetStorageCheckReport 获取存储一致性检查报告
+// @Summary 获取存储一致性检查报告
+// @Description 返回当前或最近一次存储检查的报告，每类问题最多列出 1000 条
+// @Tags admin
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {object} fsck.Report
+// @Router /admin/storage/fsck [get]
+func GetStorageCheckReport(c *gin.Context) {
+	report, err := fsck.GetReport()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
@@ -0,0 +1,209 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"BingPaper/internal/model"
+	"BingPaper/internal/service/webhook"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type WebhookRequest struct {
+	Name    string   `json:"name"`
+	URL     string   `json:"url" binding:"required"`
+	Secret  string   `json:"secret"`  // 为空时创建接口自动生成，更新接口保留原密钥
+	Events  []string `json:"events"`  // image.created, image.replaced, fetch.failed, cleanup.completed，为空表示全部
+	Mkts    []string `json:"mkts"`    // 地区过滤，为空表示全部
+	Enabled *bool    `json:"enabled"` // 默认 true
+}
+
+// CreateWebhookResponse 创建 Webhook 的响应，密钥只在创建时返回，之后不再可见
+type CreateWebhookResponse struct {
+	model.Webhook
+	Secret string `json:"secret"`
+}
+
+func (r WebhookRequest) apply(w *model.Webhook) {
+	w.Name = r.Name
+	w.URL = r.URL
+	if r.Secret != "" {
+		w.Secret = r.Secret
+	}
+	w.Events = r.Events
+	w.Mkts = r.Mkts
+	if r.Enabled != nil {
+		w.Enabled = *r.Enabled
+	}
+}
+
+// webhookFromParam 读取路径中的 Webhook，失败时已写入响应
+func webhookFromParam(c *gin.Context) (*model.Webhook, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid webhook id"})
+		return nil, false
+	}
+	w, err := webhook.Get(uint(id))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "webhook not found"})
+		return nil, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	return w, true
+}
+
+func sendWebhookError(c *gin.Context, err error) {
+	if errors.Is(err, webhook.ErrInvalidWebhook) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+}
+
+// ListWebhooks 获取 Webhook 列表
+// @Summary 获取 Webhook 列表
+// @Description 获取所有已注册的 Webhook
+// @Tags admin
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {array} model.Webhook
+// @Router /admin/webhooks [get]
+func ListWebhooks(c *gin.Context) {
+	hooks, err := webhook.List()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, hooks)
+}
+
+// CreateWebhook 注册 Webhook
+// @Summary 注册 Webhook
+// @Description 注册新的 Webhook。事件发生时以 POST 投递 JSON，请求头 X-BingPaper-Signature 为使用密钥计算的 HMAC-SHA256 签名 (sha256=<hex>)。密钥只在本接口的响应中返回一次，请妥善保存
+// @Tags admin
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param request body WebhookRequest true "Webhook 配置"
+// @Success 200 {object} CreateWebhookResponse
+// @Failure 400 {object} map[string]string
+// @Router /admin/webhooks [post]
+func CreateWebhook(c *gin.Context) {
+	var req WebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+
+	w := &model.Webhook{Enabled: true}
+	req.apply(w)
+	if err := webhook.Create(w); err != nil {
+		sendWebhookError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, CreateWebhookResponse{Webhook: *w, Secret: w.Secret})
+}
+
+// UpdateWebhook 更新 Webhook
+// @Summary 更新 Webhook
+// @Description 更新指定 Webhook 的配置，secret 为空时保留原密钥
+// @Tags admin
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param id path int true "Webhook ID"
+// @Param request body WebhookRequest true "Webhook 配置"
+// @Success 200 {object} model.Webhook
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /admin/webhooks/{id} [put]
+func UpdateWebhook(c *gin.Context) {
+	w, ok := webhookFromParam(c)
+	if !ok {
+		return
+	}
+	var req WebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+
+	req.apply(w)
+	if err := webhook.Update(w); err != nil {
+		sendWebhookError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, w)
+}
+
+// DeleteWebhook 删除 Webhook
+// @Summary 删除 Webhook
+// @Description 删除指定 Webhook 及其投递记录
+// @Tags admin
+// @Security BearerAuth
+// @Param id path int true "Webhook ID"
+// @Success 200 {object} map[string]string
+// @Router /admin/webhooks/{id} [delete]
+func DeleteWebhook(c *gin.Context) {
+	id, _ := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err := webhook.Delete(uint(id)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// ListWebhookDeliveries 获取 Webhook 投递记录
+// @Summary 获取 Webhook 投递记录
+// @Description 按时间倒序返回指定 Webhook 的投递记录，包含尝试次数、状态码和错误信息
+// @Tags admin
+// @Security BearerAuth
+// @Param id path int true "Webhook ID"
+// @Param limit query int false "限制数量" default(50)
+// @Produce json
+// @Success 200 {array} model.WebhookDelivery
+// @Router /admin/webhooks/{id}/deliveries [get]
+func ListWebhookDeliveries(c *gin.Context) {
+	id, _ := strconv.ParseUint(c.Param("id"), 10, 32)
+	limit := 50
+	if limitStr := c.Query("limit"); limitStr != "" {
+		limit, _ = strconv.Atoi(limitStr)
+	}
+
+	deliveries, err := webhook.ListDeliveries(uint(id), limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, deliveries)
+}
+
+// PingWebhook 测试 Webhook
+// @Summary 测试 Webhook
+// @Description 立即向指定 Webhook 发送一次 ping 事件（不重试），返回投递结果
+// @Tags admin
+// @Security BearerAuth
+// @Param id path int true "Webhook ID"
+// @Produce json
+// @Success 200 {object} model.WebhookDelivery
+// @Failure 404 {object} map[string]string
+// @Router /admin/webhooks/{id}/ping [post]
+func PingWebhook(c *gin.Context) {
+	w, ok := webhookFromParam(c)
+	if !ok {
+		return
+	}
+	d, err := webhook.Ping(w)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, d)
+}
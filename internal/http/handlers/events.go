@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"BingPaper/internal/service/event"
+	"BingPaper/internal/util"
+
+	"github.com/gin-gonic/gin"
+)
+
+// eventsHeartbeat SSE 心跳间隔，防止代理因连接空闲而断开
+var eventsHeartbeat = 30 * time.Second
+
+// Events 订阅新图片事件
+// @Summary 订阅新图片事件 (SSE)
+// @Description 以 Server-Sent Events 推送图片更新事件。抓取到新图片时推送 image.created，强制刷新覆盖已有图片时推送 image.replaced，事件 data 与图片元数据接口的返回一致。连接空闲时会定期发送注释行作为心跳。
+// @Tags image
+// @Param mkt query string false "仅接收指定地区的事件 (如 zh-CN, en-US)，为空时接收所有地区"
+// @Produce text/event-stream
+// @Success 200 {object} ImageMetaResp "事件 data 字段"
+// @Failure 400 {object} map[string]string
+// @Router /events [get]
+func Events(c *gin.Context) {
+	mkt := c.Query("mkt")
+	if mkt != "" && !util.IsValidRegion(mkt) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("[%s] is not a standard region code", mkt)})
+		return
+	}
+
+	events, cancel := event.Subscribe(mkt)
+	defer cancel()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no") // 禁用 Nginx 缓冲
+	c.Status(http.StatusOK)
+	_, _ = io.WriteString(c.Writer, ": connected\n\n")
+	c.Writer.Flush()
+
+	heartbeat := time.NewTicker(eventsHeartbeat)
+	defer heartbeat.Stop()
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case <-c.Request.Context().Done():
+			return false
+		case e, ok := <-events:
+			if !ok {
+				return false // 服务正在关闭
+			}
+			c.SSEvent(e.Type, formatMeta(e.Image))
+			return true
+		case <-heartbeat.C:
+			_, err := io.WriteString(w, ": ping\n\n")
+			return err == nil
+		}
+	})
+}
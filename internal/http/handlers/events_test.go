@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"BingPaper/internal/config"
+	"BingPaper/internal/model"
+	"BingPaper/internal/service/event"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEventsStream(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	require.NoError(t, config.Init(""))
+	config.GetConfig().API.Mode = "local"
+
+	r := gin.New()
+	r.GET("/api/v1/events", Events)
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/api/v1/events?mkt=zh-CN", nil)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	reader := bufio.NewReader(resp.Body)
+	line, err := reader.ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, ": connected\n", line)
+
+	// 其他地区的事件被过滤，只收到 zh-CN 的事件
+	event.Publish(event.Event{Type: event.TypeImageCreated, Image: &model.ImageRegion{Date: "2026-01-26", Mkt: "en-US", Title: "Other"}})
+	event.Publish(event.Event{Type: event.TypeImageCreated, Image: &model.ImageRegion{
+		Date:  "2026-01-26",
+		Mkt:   "zh-CN",
+		Title: "Today",
+		Variants: []model.ImageVariant{
+			{Variant: "UHD", Format: "jpg", StorageKey: "a.jpg"},
+		},
+	}})
+
+	var eventName, data string
+	for data == "" {
+		line, err := reader.ReadString('\n')
+		require.NoError(t, err)
+		line = strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(line, "event:"):
+			eventName = strings.TrimPrefix(line, "event:")
+		case strings.HasPrefix(line, "data:"):
+			data = strings.TrimPrefix(line, "data:")
+		}
+	}
+
+	assert.Equal(t, event.TypeImageCreated, eventName)
+	var meta map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(data), &meta))
+	assert.Equal(t, "Today", meta["title"])
+	assert.Equal(t, "zh-CN", meta["mkt"])
+	assert.Len(t, meta["variants"], 1)
+}
+
+func TestEventsRejectsInvalidRegion(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest(http.MethodGet, "/api/v1/events?mkt=not_a_region!", nil)
+
+	Events(c)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Zero(t, event.SubscriberCount())
+}
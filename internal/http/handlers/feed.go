@@ -0,0 +1,335 @@
+package handlers
+
+import (
+	"encoding/xml"
+	"fmt"
+	"html"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"BingPaper/internal/config"
+	"BingPaper/internal/model"
+	"BingPaper/internal/service/fetcher"
+	"BingPaper/internal/service/image"
+	"BingPaper/internal/util"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultFeedLimit = 20
+	maxFeedLimit     = 100
+)
+
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	Language      string    `xml:"language"`
+	LastBuildDate string    `xml:"lastBuildDate,omitempty"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string        `xml:"title"`
+	Link        string        `xml:"link"`
+	Description string        `xml:"description"`
+	GUID        rssGUID       `xml:"guid"`
+	PubDate     string        `xml:"pubDate"`
+	Enclosure   *rssEnclosure `xml:"enclosure,omitempty"`
+}
+
+type rssGUID struct {
+	IsPermaLink string `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+type rssEnclosure struct {
+	URL    string `xml:"url,attr"`
+	Length int64  `xml:"length,attr"`
+	Type   string `xml:"type,attr"`
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title   string      `xml:"title"`
+	ID      string      `xml:"id"`
+	Updated string      `xml:"updated"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Rel    string `xml:"rel,attr,omitempty"`
+	Href   string `xml:"href,attr"`
+	Type   string `xml:"type,attr,omitempty"`
+	Length int64  `xml:"length,attr,omitempty"`
+}
+
+type atomEntry struct {
+	Title   string      `xml:"title"`
+	ID      string      `xml:"id"`
+	Updated string      `xml:"updated"`
+	Links   []atomLink  `xml:"link"`
+	Summary string      `xml:"summary"`
+	Content atomContent `xml:"content"`
+}
+
+type atomContent struct {
+	Type  string `xml:"type,attr"`
+	Value string `xml:",chardata"`
+}
+
+// feedEntry RSS 与 Atom 共用的条目数据
+type feedEntry struct {
+	m         *model.ImageRegion
+	guid      string
+	published time.Time
+	link      string
+	enclosure *model.ImageVariant
+	imageURL  string
+	quizURL   string
+}
+
+// GetRSSFeed 获取 RSS 订阅
+// @Summary 获取 RSS 订阅
+// @Description 以 RSS 2.0 格式返回指定地区最近的每日图片，enclosure 指向所选分辨率和格式的图片
+// @Tags feed
+// @Param mkt query string false "地区编码 (如 zh-CN, en-US, ja-JP, en-AU, en-GB, de-DE, en-NZ, en-CA, en-IN, fr-FR, fr-CA, it-IT, es-ES, pt-BR, en-ROW)"
+// @Param source query string false "图片源 (如 bing)，为空时使用默认图片源"
+// @Param limit query int false "条目数量 (最大 100)" default(20)
+// @Param variant query string false "enclosure 分辨率" default(UHD)
+// @Param format query string false "enclosure 格式 (jpg, webp, avif)" default(jpg)
+// @Produce application/rss+xml
+// @Success 200 {string} string "RSS 2.0 XML"
+// @Router /feed/rss [get]
+func GetRSSFeed(c *gin.Context) {
+	source, mkt, entries, ok := loadFeedEntries(c)
+	if !ok {
+		return
+	}
+
+	channel := rssChannel{
+		Title:       feedTitle(source, mkt),
+		Link:        requestBaseURL(c) + "/",
+		Description: fmt.Sprintf("%s daily wallpapers for region %s", fetcher.LookupSourceInfo(source).Title, mkt),
+		Language:    mkt,
+		Items:       []rssItem{},
+	}
+	if len(entries) > 0 {
+		channel.LastBuildDate = entries[0].published.Format(time.RFC1123Z)
+	}
+
+	for _, e := range entries {
+		item := rssItem{
+			Title:       e.m.Title,
+			Link:        e.link,
+			Description: feedContentHTML(e),
+			GUID:        rssGUID{IsPermaLink: "false", Value: e.guid},
+			PubDate:     e.published.Format(time.RFC1123Z),
+		}
+		if e.enclosure != nil {
+			item.Enclosure = &rssEnclosure{URL: e.imageURL, Length: e.enclosure.Size, Type: fetcher.ContentTypeForFormat(e.enclosure.Format)}
+		}
+		channel.Items = append(channel.Items, item)
+	}
+
+	renderFeed(c, "application/rss+xml; charset=utf-8", rssFeed{Version: "2.0", Channel: channel})
+}
+
+// GetAtomFeed 获取 Atom 订阅
+// @Summary 获取 Atom 订阅
+// @Description 以 Atom 格式返回指定地区最近的每日图片，rel=enclosure 链接指向所选分辨率和格式的图片
+// @Tags feed
+// @Param mkt query string false "地区编码 (如 zh-CN, en-US, ja-JP, en-AU, en-GB, de-DE, en-NZ, en-CA, en-IN, fr-FR, fr-CA, it-IT, es-ES, pt-BR, en-ROW)"
+// @Param source query string false "图片源 (如 bing)，为空时使用默认图片源"
+// @Param limit query int false "条目数量 (最大 100)" default(20)
+// @Param variant query string false "enclosure 分辨率" default(UHD)
+// @Param format query string false "enclosure 格式 (jpg, webp, avif)" default(jpg)
+// @Produce application/atom+xml
+// @Success 200 {string} string "Atom XML"
+// @Router /feed/atom [get]
+func GetAtomFeed(c *gin.Context) {
+	source, mkt, entries, ok := loadFeedEntries(c)
+	if !ok {
+		return
+	}
+
+	base := requestBaseURL(c)
+	feed := atomFeed{
+		Title: feedTitle(source, mkt),
+		ID:    "urn:bingpaper:feed:" + feedURNPrefix(source) + mkt,
+		Links: []atomLink{
+			{Rel: "self", Href: base + c.Request.URL.RequestURI(), Type: "application/atom+xml"},
+			{Rel: "alternate", Href: base + "/"},
+		},
+		Entries: []atomEntry{},
+	}
+	// Atom 要求 updated 字段，没有条目时使用当前时间
+	feed.Updated = time.Now().UTC().Format(time.RFC3339)
+	if len(entries) > 0 {
+		feed.Updated = entries[0].published.Format(time.RFC3339)
+	}
+
+	for _, e := range entries {
+		entry := atomEntry{
+			Title:   e.m.Title,
+			ID:      e.guid,
+			Updated: e.published.Format(time.RFC3339),
+			Links:   []atomLink{{Rel: "alternate", Href: e.link}},
+			Summary: e.m.Copyright,
+			Content: atomContent{Type: "html", Value: feedContentHTML(e)},
+		}
+		if e.enclosure != nil {
+			entry.Links = append(entry.Links, atomLink{Rel: "enclosure", Href: e.imageURL, Type: fetcher.ContentTypeForFormat(e.enclosure.Format), Length: e.enclosure.Size})
+		}
+		feed.Entries = append(feed.Entries, entry)
+	}
+
+	renderFeed(c, "application/atom+xml; charset=utf-8", feed)
+}
+
+// loadFeedEntries 解析订阅参数并加载条目，返回图片源和地区，失败时已写入响应
+func loadFeedEntries(c *gin.Context) (string, string, []feedEntry, bool) {
+	mkt := c.Query("mkt")
+	if mkt == "" {
+		mkt = config.GetConfig().GetDefaultRegion()
+	}
+	source := c.Query("source")
+	if source == "" {
+		source = config.GetConfig().GetDefaultSource()
+	}
+	limit := defaultFeedLimit
+	if limitStr := c.Query("limit"); limitStr != "" {
+		n, err := strconv.Atoi(limitStr)
+		if err != nil || n < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be a positive integer"})
+			return "", "", nil, false
+		}
+		limit = min(n, maxFeedLimit)
+	}
+	variant := c.DefaultQuery("variant", "UHD")
+	format := c.DefaultQuery("format", "jpg")
+
+	images, err := image.GetImageList(limit, 0, "", mkt, source)
+	if err != nil {
+		util.Logger.Error("Failed to load images for feed", zap.String("mkt", mkt), zap.String("source", source), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return "", "", nil, false
+	}
+
+	base := requestBaseURL(c)
+	siteURL := fetcher.LookupSourceInfo(source).SiteURL
+	entries := make([]feedEntry, 0, len(images))
+	for i := range images {
+		m := &images[i]
+		e := feedEntry{
+			m:         m,
+			guid:      feedGUID(m),
+			published: feedPublished(m),
+			enclosure: selectVariant(m.Variants, variant, format),
+		}
+		if e.enclosure != nil {
+			e.imageURL = absoluteURL(base, variantURL(m, e.enclosure))
+		}
+		e.link = m.CopyrightLink
+		if e.link == "" {
+			e.link = e.imageURL
+		}
+		// Quiz 通常是图片源站点下的相对路径，无法补全时不输出
+		if m.Quiz != "" && (siteURL != "" || !strings.HasPrefix(m.Quiz, "/")) {
+			e.quizURL = absoluteURL(siteURL, m.Quiz)
+		}
+		entries = append(entries, e)
+	}
+	return source, mkt, entries, true
+}
+
+// feedGUID 返回条目的稳定 ID，同一图片源、地区、日期的图片即使被强制刷新也保持不变（HSH 变化除外）
+func feedGUID(m *model.ImageRegion) string {
+	prefix := "urn:bingpaper:" + feedURNPrefix(m.Source) + m.Mkt + ":" + m.Date
+	if m.HSH == "" {
+		return prefix
+	}
+	return prefix + ":" + m.HSH
+}
+
+// feedURNPrefix 返回 ID 中的图片源部分。Bing 图片源省略源名称，保持与引入多图片源之前的 ID 一致，
+// 避免阅读器把已读条目当作新条目重复推送
+func feedURNPrefix(source string) string {
+	if source == config.SourceBing || source == "" {
+		return ""
+	}
+	return source + ":"
+}
+
+// feedPublished 优先使用 Bing 返回的 fullstartdate (UTC, yyyyMMddHHmm)，否则取日期零点
+func feedPublished(m *model.ImageRegion) time.Time {
+	if t, err := time.Parse("200601021504", m.FullStartDate); err == nil {
+		return t
+	}
+	if t, err := time.Parse("2006-01-02", m.Date); err == nil {
+		return t
+	}
+	return m.CreatedAt.UTC()
+}
+
+func feedTitle(source, mkt string) string {
+	if source == config.SourceBing || source == "" {
+		return fmt.Sprintf("BingPaper - %s", mkt)
+	}
+	return fmt.Sprintf("BingPaper - %s - %s", fetcher.LookupSourceInfo(source).Title, mkt)
+}
+
+func feedContentHTML(e feedEntry) string {
+	var sb strings.Builder
+	if e.imageURL != "" {
+		fmt.Fprintf(&sb, `<p><img src="%s" alt="%s"/></p>`, html.EscapeString(e.imageURL), html.EscapeString(e.m.Title))
+	}
+	fmt.Fprintf(&sb, "<p>%s</p>", html.EscapeString(e.m.Copyright))
+	if e.quizURL != "" {
+		fmt.Fprintf(&sb, `<p><a href="%s">Quiz</a></p>`, html.EscapeString(e.quizURL))
+	}
+	return sb.String()
+}
+
+// requestBaseURL 返回对外访问地址，未配置 server.base_url 时根据请求推断
+func requestBaseURL(c *gin.Context) string {
+	if base := config.GetConfig().Server.BaseURL; base != "" {
+		return strings.TrimSuffix(base, "/")
+	}
+	scheme := "http"
+	if c.Request.TLS != nil {
+		scheme = "https"
+	}
+	if proto := c.GetHeader("X-Forwarded-Proto"); proto != "" {
+		scheme = proto
+	}
+	return fmt.Sprintf("%s://%s", scheme, c.Request.Host)
+}
+
+func absoluteURL(base, u string) string {
+	if strings.HasPrefix(u, "/") {
+		return base + u
+	}
+	return u
+}
+
+func renderFeed(c *gin.Context, contentType string, v interface{}) {
+	data, err := xml.MarshalIndent(v, "", "  ")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.Header("Cache-Control", "public, max-age=3600")
+	c.Data(http.StatusOK, contentType, append([]byte(xml.Header), data...))
+}
@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"BingPaper/internal/config"
+	"BingPaper/internal/model"
+	"BingPaper/internal/repo"
+	"BingPaper/internal/util"
+
+	"github.com/gin-gonic/gin"
+	"github.com/glebarez/sqlite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+func setupFeedTest(t *testing.T) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	require.NoError(t, config.Init(""))
+	config.GetConfig().API.Mode = "local"
+	util.Logger = zap.NewNop()
+
+	db, err := gorm.Open(sqlite.Open(fmt.Sprintf("file:%s?mode=memory&cache=shared", t.Name())), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, repo.AutoMigrateModels(db))
+	repo.DB = db
+
+	for _, m := range []model.ImageRegion{
+		{Date: "2026-01-25", Mkt: "zh-CN", HSH: "hsh25", ImageName: "Older", Title: "Older", FullStartDate: "202601241600"},
+		{Date: "2026-01-26", Mkt: "zh-CN", HSH: "hsh26", ImageName: "Newer", Title: "Newer & Brighter", Copyright: "© Someone", CopyrightLink: "https://www.bing.com/search?q=newer", Quiz: "/search?q=quiz", FullStartDate: "202601251600"},
+		{Date: "2026-01-26", Mkt: "en-US", HSH: "hshUS", ImageName: "US", Title: "US"},
+		{Date: "2026-01-26", Mkt: "zh-CN", Source: "other", HSH: "hshOther", ImageName: "other-Other", Title: "Other", Quiz: "/quiz"},
+	} {
+		require.NoError(t, db.Create(&m).Error)
+	}
+	require.NoError(t, db.Create(&model.ImageVariant{ImageName: "Newer", Variant: "UHD", Format: "jpg", Size: 1234, StorageKey: "Newer_UHD.jpg"}).Error)
+	require.NoError(t, db.Create(&model.ImageVariant{ImageName: "Newer", Variant: "1920x1080", Format: "webp", Size: 567, StorageKey: "Newer_1920x1080.webp"}).Error)
+
+	r := gin.New()
+	r.GET("/api/v1/feed/rss", GetRSSFeed)
+	r.GET("/api/v1/feed/atom", GetAtomFeed)
+	return r
+}
+
+func TestRSSFeed(t *testing.T) {
+	r := setupFeedTest(t)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/api/v1/feed/rss?mkt=zh-CN&variant=1920x1080&format=webp", nil)
+	req.Host = "paper.example.com"
+	r.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Header().Get("Content-Type"), "application/rss+xml")
+
+	var feed rssFeed
+	require.NoError(t, xml.Unmarshal(w.Body.Bytes(), &feed))
+	require.Len(t, feed.Channel.Items, 2)
+	assert.Equal(t, "Bing daily wallpapers for region zh-CN", feed.Channel.Description)
+
+	item := feed.Channel.Items[0]
+	assert.Equal(t, "Newer & Brighter", item.Title)
+	assert.Equal(t, "https://www.bing.com/search?q=newer", item.Link)
+	assert.Equal(t, "urn:bingpaper:zh-CN:2026-01-26:hsh26", item.GUID.Value)
+	assert.Equal(t, "false", item.GUID.IsPermaLink)
+	assert.Equal(t, "Sun, 25 Jan 2026 16:00:00 +0000", item.PubDate)
+	require.NotNil(t, item.Enclosure)
+	assert.Equal(t, "http://paper.example.com/api/v1/image/date/2026-01-26?variant=1920x1080&format=webp&mkt=zh-CN", item.Enclosure.URL)
+	assert.Equal(t, int64(567), item.Enclosure.Length)
+	assert.Equal(t, "image/webp", item.Enclosure.Type)
+	assert.Contains(t, item.Description, "<p>© Someone</p>")
+	assert.Contains(t, item.Description, `<a href="https://www.bing.com/search?q=quiz">Quiz</a>`)
+
+	// 没有变体的条目不输出 enclosure
+	assert.Nil(t, feed.Channel.Items[1].Enclosure)
+}
+
+func TestAtomFeed(t *testing.T) {
+	r := setupFeedTest(t)
+	config.GetConfig().Server.BaseURL = "https://paper.example.com"
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/api/v1/feed/atom?mkt=zh-CN&limit=1", nil)
+	r.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Header().Get("Content-Type"), "application/atom+xml")
+
+	var feed atomFeed
+	require.NoError(t, xml.Unmarshal(w.Body.Bytes(), &feed))
+	assert.Equal(t, "urn:bingpaper:feed:zh-CN", feed.ID)
+	assert.Equal(t, "2026-01-25T16:00:00Z", feed.Updated)
+	require.Len(t, feed.Entries, 1)
+
+	entry := feed.Entries[0]
+	assert.Equal(t, "urn:bingpaper:zh-CN:2026-01-26:hsh26", entry.ID)
+	assert.Equal(t, "© Someone", entry.Summary)
+	require.Len(t, entry.Links, 2)
+	assert.Equal(t, "enclosure", entry.Links[1].Rel)
+	assert.Equal(t, "https://paper.example.com/api/v1/image/date/2026-01-26?variant=UHD&format=jpg&mkt=zh-CN", entry.Links[1].Href)
+	assert.Equal(t, "image/jpeg", entry.Links[1].Type)
+}
+
+func TestFeedOtherSource(t *testing.T) {
+	r := setupFeedTest(t)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/api/v1/feed/rss?mkt=zh-CN&source=other", nil)
+	r.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var feed rssFeed
+	require.NoError(t, xml.Unmarshal(w.Body.Bytes(), &feed))
+	assert.Equal(t, "other daily wallpapers for region zh-CN", feed.Channel.Description)
+	require.Len(t, feed.Channel.Items, 1)
+
+	// 同一地区同一天的不同图片源条目 ID 不同；未知站点的相对 Quiz 链接不输出
+	item := feed.Channel.Items[0]
+	assert.Equal(t, "urn:bingpaper:other:zh-CN:2026-01-26:hshOther", item.GUID.Value)
+	assert.NotContains(t, item.Description, "Quiz")
+}
+
+func TestFeedRejectsInvalidLimit(t *testing.T) {
+	r := setupFeedTest(t)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/api/v1/feed/rss?limit=abc", nil)
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
@@ -1,15 +1,19 @@
 package handlers
 
 import (
-	"context"
+	"bytes"
+	"errors"
 	"fmt"
+	"hash/fnv"
 	"io"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	"BingPaper/internal/config"
 	"BingPaper/internal/model"
+	"BingPaper/internal/service/fetcher"
 	"BingPaper/internal/service/image"
 	"BingPaper/internal/storage"
 	"BingPaper/internal/util"
@@ -29,6 +33,7 @@ type ImageVariantResp struct {
 type ImageMetaResp struct {
 	Date          string             `json:"date"`
 	Mkt           string             `json:"mkt"`
+	Source        string             `json:"source"`
 	Title         string             `json:"title"`
 	Copyright     string             `json:"copyright"`
 	CopyrightLink string             `json:"copyrightlink"`
@@ -44,18 +49,28 @@ type ImageMetaResp struct {
 // @Description 根据参数返回今日必应图片流或重定向
 // @Tags image
 // @Param mkt query string false "地区编码 (如 zh-CN, en-US, ja-JP, en-AU, en-GB, de-DE, en-NZ, en-CA, en-IN, fr-FR, fr-CA, it-IT, es-ES, pt-BR, en-ROW)"
-// @Param variant query string false "分辨率 (UHD, 1920x1080, 1366x768, 1280x720, 1024x768, 800x600, 800x480, 640x480, 640x360, 480x360, 400x240, 320x240)" default(UHD)
-// @Param format query string false "格式 (jpg)" default(jpg)
+// @Param source query string false "图片源 (如 bing)，为空时使用默认图片源"
+// @Param variant query string false "分辨率 (UHD 及 fetcher.variants 中配置的变体，默认 1920x1200, 1920x1080, 1080x1920, 1366x768, 1280x768, 1024x768, 800x600, 800x480, 768x1280, 720x1280, 640x480, 480x800, 400x240, 320x240, 240x320)" default(UHD)
+// @Param format query string false "格式 (jpg, webp, avif)，为空时根据 Accept 头协商"
+// @Param w query int false "按需缩放宽度 (像素)，与 h 至少指定一个时忽略 variant"
+// @Param h query int false "按需缩放高度 (像素)"
+// @Param fit query string false "缩放模式 (fill: 居中裁剪填满, fit: 等比缩放不裁剪)" default(fill)
+// @Param Accept header string false "可接受的图片类型 (如 image/avif, image/webp)"
 // @Produce image/jpeg
+// @Produce image/webp
+// @Produce image/avif
 // @Success 200 {file} binary
-// @Success 202 {object} map[string]string "按需抓取任务已启动"
+// @Success 206 {file} binary "Range 请求返回的部分内容"
+// @Success 304 "If-None-Match / If-Modified-Since 命中，内容未修改"
+// @Success 202 {object} map[string]interface{} "按需抓取任务已启动，job_id 可用于查询任务状态"
+// @Failure 400 {object} map[string]string "缩放参数不合法或超出限制"
 // @Failure 404 {object} map[string]string "图片未找到，响应体包含具体原因"
 // @Router /image/today [get]
+// @Router /image/today [head]
 func GetToday(c *gin.Context) {
 	mkt := c.Query("mkt")
-	imgRegion, err := image.GetTodayImage(mkt)
-	if err == image.ErrFetchStarted {
-		c.JSON(http.StatusAccepted, gin.H{"message": fmt.Sprintf("On-demand fetch started for region [%s]. Please try again later.", mkt)})
+	imgRegion, err := image.GetTodayImage(mkt, c.Query("source"))
+	if sendFetchStarted(c, err) {
 		return
 	}
 	if err != nil {
@@ -70,16 +85,16 @@ func GetToday(c *gin.Context) {
 // @Description 获取今日必应图片的标题、版权等元数据
 // @Tags image
 // @Param mkt query string false "地区编码 (如 zh-CN, en-US, ja-JP, en-AU, en-GB, de-DE, en-NZ, en-CA, en-IN, fr-FR, fr-CA, it-IT, es-ES, pt-BR, en-ROW)"
+// @Param source query string false "图片源 (如 bing)，为空时使用默认图片源"
 // @Produce json
 // @Success 200 {object} ImageMetaResp
-// @Success 202 {object} map[string]string "按需抓取任务已启动"
+// @Success 202 {object} map[string]interface{} "按需抓取任务已启动，job_id 可用于查询任务状态"
 // @Failure 404 {object} map[string]string "图片未找到，响应体包含具体原因"
 // @Router /image/today/meta [get]
 func GetTodayMeta(c *gin.Context) {
 	mkt := c.Query("mkt")
-	imgRegion, err := image.GetTodayImage(mkt)
-	if err == image.ErrFetchStarted {
-		c.JSON(http.StatusAccepted, gin.H{"message": fmt.Sprintf("On-demand fetch started for region [%s]. Please try again later.", mkt)})
+	imgRegion, err := image.GetTodayImage(mkt, c.Query("source"))
+	if sendFetchStarted(c, err) {
 		return
 	}
 	if err != nil {
@@ -95,19 +110,29 @@ func GetTodayMeta(c *gin.Context) {
 // @Description 随机返回一张已抓取的图片流或重定向
 // @Tags image
 // @Param mkt query string false "地区编码 (如 zh-CN, en-US, ja-JP, en-AU, en-GB, de-DE, en-NZ, en-CA, en-IN, fr-FR, fr-CA, it-IT, es-ES, pt-BR, en-ROW)"
+// @Param source query string false "图片源 (如 bing)，为空时使用默认图片源"
 // @Param variant query string false "分辨率" default(UHD)
-// @Param format query string false "格式" default(jpg)
+// @Param format query string false "格式 (jpg, webp, avif)，为空时根据 Accept 头协商"
+// @Param w query int false "按需缩放宽度 (像素)，与 h 至少指定一个时忽略 variant"
+// @Param h query int false "按需缩放高度 (像素)"
+// @Param fit query string false "缩放模式 (fill: 居中裁剪填满, fit: 等比缩放不裁剪)" default(fill)
+// @Param Accept header string false "可接受的图片类型 (如 image/avif, image/webp)"
 // @Produce image/jpeg
+// @Produce image/webp
+// @Produce image/avif
 // @Success 200 {file} binary
-// @Success 202 {object} map[string]string "按需抓取任务已启动"
+// @Success 206 {file} binary "Range 请求返回的部分内容"
+// @Success 304 "If-None-Match / If-Modified-Since 命中，内容未修改"
+// @Success 202 {object} map[string]interface{} "按需抓取任务已启动，job_id 可用于查询任务状态"
+// @Failure 400 {object} map[string]string "缩放参数不合法或超出限制"
 // @Failure 404 {object} map[string]string "图片未找到，响应体包含具体原因"
 // @Router /image/random [get]
+// @Router /image/random [head]
 // GetRandom 获取随机图片
 func GetRandom(c *gin.Context) {
 	mkt := c.Query("mkt")
-	imgRegion, err := image.GetRandomImage(mkt)
-	if err == image.ErrFetchStarted {
-		c.JSON(http.StatusAccepted, gin.H{"message": fmt.Sprintf("On-demand fetch started for region [%s]. Please try again later.", mkt)})
+	imgRegion, err := image.GetRandomImage(mkt, c.Query("source"))
+	if sendFetchStarted(c, err) {
 		return
 	}
 	if err != nil {
@@ -122,16 +147,16 @@ func GetRandom(c *gin.Context) {
 // @Description 随机获取一张已抓取图片的元数据
 // @Tags image
 // @Param mkt query string false "地区编码 (如 zh-CN, en-US, ja-JP, en-AU, en-GB, de-DE, en-NZ, en-CA, en-IN, fr-FR, fr-CA, it-IT, es-ES, pt-BR, en-ROW)"
+// @Param source query string false "图片源 (如 bing)，为空时使用默认图片源"
 // @Produce json
 // @Success 200 {object} ImageMetaResp
-// @Success 202 {object} map[string]string "按需抓取任务已启动"
+// @Success 202 {object} map[string]interface{} "按需抓取任务已启动，job_id 可用于查询任务状态"
 // @Failure 404 {object} map[string]string "图片未找到，响应体包含具体原因"
 // @Router /image/random/meta [get]
 func GetRandomMeta(c *gin.Context) {
 	mkt := c.Query("mkt")
-	imgRegion, err := image.GetRandomImage(mkt)
-	if err == image.ErrFetchStarted {
-		c.JSON(http.StatusAccepted, gin.H{"message": fmt.Sprintf("On-demand fetch started for region [%s]. Please try again later.", mkt)})
+	imgRegion, err := image.GetRandomImage(mkt, c.Query("source"))
+	if sendFetchStarted(c, err) {
 		return
 	}
 	if err != nil {
@@ -148,19 +173,29 @@ func GetRandomMeta(c *gin.Context) {
 // @Tags image
 // @Param date path string true "日期 (yyyy-mm-dd)"
 // @Param mkt query string false "地区编码 (如 zh-CN, en-US, ja-JP, en-AU, en-GB, de-DE, en-NZ, en-CA, en-IN, fr-FR, fr-CA, it-IT, es-ES, pt-BR, en-ROW)"
+// @Param source query string false "图片源 (如 bing)，为空时使用默认图片源"
 // @Param variant query string false "分辨率" default(UHD)
-// @Param format query string false "格式" default(jpg)
+// @Param format query string false "格式 (jpg, webp, avif)，为空时根据 Accept 头协商"
+// @Param w query int false "按需缩放宽度 (像素)，与 h 至少指定一个时忽略 variant"
+// @Param h query int false "按需缩放高度 (像素)"
+// @Param fit query string false "缩放模式 (fill: 居中裁剪填满, fit: 等比缩放不裁剪)" default(fill)
+// @Param Accept header string false "可接受的图片类型 (如 image/avif, image/webp)"
 // @Produce image/jpeg
+// @Produce image/webp
+// @Produce image/avif
 // @Success 200 {file} binary
-// @Success 202 {object} map[string]string "按需抓取任务已启动"
+// @Success 206 {file} binary "Range 请求返回的部分内容"
+// @Success 304 "If-None-Match / If-Modified-Since 命中，内容未修改"
+// @Success 202 {object} map[string]interface{} "按需抓取任务已启动，job_id 可用于查询任务状态"
+// @Failure 400 {object} map[string]string "缩放参数不合法或超出限制"
 // @Failure 404 {object} map[string]string "图片未找到，响应体包含具体原因"
 // @Router /image/date/{date} [get]
+// @Router /image/date/{date} [head]
 func GetByDate(c *gin.Context) {
 	date := c.Param("date")
 	mkt := c.Query("mkt")
-	imgRegion, err := image.GetImageByDate(date, mkt)
-	if err == image.ErrFetchStarted {
-		c.JSON(http.StatusAccepted, gin.H{"message": fmt.Sprintf("On-demand fetch started for region [%s]. Please try again later.", mkt)})
+	imgRegion, err := image.GetImageByDate(date, mkt, c.Query("source"))
+	if sendFetchStarted(c, err) {
 		return
 	}
 	if err != nil {
@@ -176,17 +211,17 @@ func GetByDate(c *gin.Context) {
 // @Tags image
 // @Param date path string true "日期 (yyyy-mm-dd)"
 // @Param mkt query string false "地区编码 (如 zh-CN, en-US, ja-JP, en-AU, en-GB, de-DE, en-NZ, en-CA, en-IN, fr-FR, fr-CA, it-IT, es-ES, pt-BR, en-ROW)"
+// @Param source query string false "图片源 (如 bing)，为空时使用默认图片源"
 // @Produce json
 // @Success 200 {object} ImageMetaResp
-// @Success 202 {object} map[string]string "按需抓取任务已启动"
+// @Success 202 {object} map[string]interface{} "按需抓取任务已启动，job_id 可用于查询任务状态"
 // @Failure 404 {object} map[string]string "图片未找到，响应体包含具体原因"
 // @Router /image/date/{date}/meta [get]
 func GetByDateMeta(c *gin.Context) {
 	date := c.Param("date")
 	mkt := c.Query("mkt")
-	imgRegion, err := image.GetImageByDate(date, mkt)
-	if err == image.ErrFetchStarted {
-		c.JSON(http.StatusAccepted, gin.H{"message": fmt.Sprintf("On-demand fetch started for region [%s]. Please try again later.", mkt)})
+	imgRegion, err := image.GetImageByDate(date, mkt, c.Query("source"))
+	if sendFetchStarted(c, err) {
 		return
 	}
 	if err != nil {
@@ -206,6 +241,7 @@ func GetByDateMeta(c *gin.Context) {
 // @Param page_size query int false "每页数量"
 // @Param month query string false "按月份过滤 (格式: YYYY-MM)"
 // @Param mkt query string false "地区编码 (如 zh-CN, en-US, ja-JP, en-AU, en-GB, de-DE, en-NZ, en-CA, en-IN, fr-FR, fr-CA, it-IT, es-ES, pt-BR, en-ROW)"
+// @Param source query string false "图片源 (如 bing)，为空时使用默认图片源"
 // @Produce json
 // @Success 200 {array} ImageMetaResp
 // @Router /images [get]
@@ -246,7 +282,7 @@ func ListImages(c *gin.Context) {
 		offset = 0
 	}
 
-	images, err := image.GetImageList(limit, offset, month, mkt)
+	images, err := image.GetImageList(limit, offset, month, mkt, c.Query("source"))
 	if err != nil {
 		util.Logger.Error("ListImages service call failed", zap.Error(err))
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
@@ -282,6 +318,19 @@ func ListGlobalTodayImages(c *gin.Context) {
 	c.JSON(http.StatusOK, result)
 }
 
+// sendFetchStarted 在图片正在按需抓取时返回 202 及负责抓取的任务 ID
+func sendFetchStarted(c *gin.Context, err error) bool {
+	var started *image.FetchStartedError
+	if !errors.As(err, &started) {
+		return false
+	}
+	c.JSON(http.StatusAccepted, gin.H{
+		"message": fmt.Sprintf("On-demand fetch started for region [%s]. Please try again later.", started.Mkt),
+		"job_id":  started.JobID,
+	})
+	return true
+}
+
 func sendImageNotFound(c *gin.Context, mkt string) {
 	cfg := config.GetConfig().API
 	message := "image not found"
@@ -310,39 +359,103 @@ func sendImageNotFound(c *gin.Context, mkt string) {
 }
 
 func handleImageResponse(c *gin.Context, m *model.ImageRegion, maxAge int) {
-	variant := c.DefaultQuery("variant", "UHD")
-	format := c.DefaultQuery("format", "jpg")
-
-	var selected *model.ImageVariant
-	for _, v := range m.Variants {
-		if v.Variant == variant && v.Format == format {
-			selected = &v
-			break
-		}
+	if c.Query("w") != "" || c.Query("h") != "" {
+		handleResizedResponse(c, m, maxAge)
+		return
 	}
 
-	if selected == nil && len(m.Variants) > 0 {
-		// 回退逻辑
-		selected = &m.Variants[0]
+	variant := c.DefaultQuery("variant", "UHD")
+	format := c.Query("format")
+	if format == "" {
+		// 未显式指定格式时根据 Accept 头协商
+		c.Header("Vary", "Accept")
+		format = negotiateFormat(c.GetHeader("Accept"), availableFormats(m.Variants, variant))
 	}
 
+	selected := selectVariant(m.Variants, variant, format)
+
 	if selected == nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "variant not found"})
 		return
 	}
 
+	serveVariant(c, m, selected, maxAge)
+}
+
+// handleResizedResponse 处理 w/h/fit 参数的按需缩放请求
+func handleResizedResponse(c *gin.Context, m *model.ImageRegion, maxAge int) {
+	width, errW := parseDimension(c.Query("w"))
+	height, errH := parseDimension(c.Query("h"))
+	if errW != nil || errH != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "w and h must be non-negative integers"})
+		return
+	}
+
+	format := c.Query("format")
+	if format == "" {
+		c.Header("Vary", "Accept")
+		enabled := map[string]bool{}
+		for _, f := range fetcher.EnabledFormats() {
+			enabled[f] = true
+		}
+		format = negotiateFormat(c.GetHeader("Accept"), enabled)
+	}
+
+	req := image.ResizeRequest{
+		Width:  width,
+		Height: height,
+		Fit:    c.DefaultQuery("fit", image.FitFill),
+		Format: format,
+	}
+	selected, err := image.GetResizedVariant(c.Request.Context(), m, req)
+	if err != nil {
+		switch {
+		case errors.Is(err, image.ErrResizeDisabled), errors.Is(err, image.ErrResizeNotAllowed):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, image.ErrSourceNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		case errors.Is(err, fetcher.ErrEncoderUnavailable):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "requested format is not available"})
+		default:
+			util.Logger.Error("Failed to derive resized variant", zap.String("image_name", m.ImageName), zap.Error(err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to resize image"})
+		}
+		return
+	}
+
+	serveVariant(c, m, selected, maxAge)
+}
+
+func parseDimension(s string) (int, error) {
+	if s == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid dimension: %s", s)
+	}
+	return n, nil
+}
+
+func serveVariant(c *gin.Context, m *model.ImageRegion, selected *model.ImageVariant, maxAge int) {
 	mode := config.GetConfig().API.Mode
 	if mode == "redirect" {
-		if selected.PublicURL != "" {
+		if url, expires, ok := presignVariant(c, selected); ok {
+			// 重定向不能比预签名 URL 缓存得更久
+			if remaining := int(time.Until(expires).Seconds()) / 2; maxAge <= 0 || maxAge > remaining {
+				maxAge = remaining
+			}
+			c.Header("Cache-Control", fmt.Sprintf("private, max-age=%d", maxAge))
+			c.Redirect(http.StatusFound, url)
+		} else if selected.PublicURL != "" {
 			if maxAge > 0 {
 				c.Header("Cache-Control", fmt.Sprintf("public, max-age=%d", maxAge))
 			} else {
 				c.Header("Cache-Control", "no-cache, no-store, must-revalidate")
 			}
 			c.Redirect(http.StatusFound, selected.PublicURL)
-		} else if m.URLBase != "" {
-			// 兜底重定向到原始 Bing
-			bingURL := fmt.Sprintf("https://www.bing.com%s_%s.jpg", m.URLBase, selected.Variant)
+		} else if bingURL, ok := bingImageURL(m, selected.Variant); ok && selected.Format == "jpg" {
+			// 兜底重定向到原始 Bing（Bing 仅提供 jpg）
 			if maxAge > 0 {
 				c.Header("Cache-Control", fmt.Sprintf("public, max-age=%d", maxAge))
 			} else {
@@ -350,45 +463,264 @@ func handleImageResponse(c *gin.Context, m *model.ImageRegion, maxAge int) {
 			}
 			c.Redirect(http.StatusFound, bingURL)
 		} else {
-			serveLocal(c, selected.StorageKey, m.Date, maxAge)
+			serveLocal(c, selected, maxAge)
 		}
 	} else {
-		serveLocal(c, selected.StorageKey, m.Date, maxAge)
+		serveLocal(c, selected, maxAge)
 	}
 }
 
-func serveLocal(c *gin.Context, key string, etag string, maxAge int) {
-	if etag != "" {
-		c.Header("ETag", fmt.Sprintf("\"%s\"", etag))
-		if c.GetHeader("If-None-Match") == fmt.Sprintf("\"%s\"", etag) {
-			c.AbortWithStatus(http.StatusNotModified)
-			return
+// presignVariant 在存储支持并开启预签名时生成变体的限时 URL
+func presignVariant(c *gin.Context, v *model.ImageVariant) (string, time.Time, bool) {
+	p, ok := storage.GlobalStorage().(storage.Presigner)
+	if !ok {
+		return "", time.Time{}, false
+	}
+	url, expires, err := p.PresignedURL(c.Request.Context(), v.StorageKey)
+	if err != nil {
+		if !errors.Is(err, storage.ErrPresignDisabled) {
+			util.Logger.Warn("Failed to presign image url", zap.String("key", v.StorageKey), zap.Error(err))
 		}
+		return "", time.Time{}, false
 	}
+	return url, expires, true
+}
 
-	reader, contentType, err := storage.GlobalStorage.Get(context.Background(), key)
-	if err != nil {
-		util.Logger.Error("Failed to get image from storage", zap.String("key", key), zap.Error(err))
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get image"})
-		return
+// selectVariant 按分辨率和格式挑选变体。
+// 找不到精确匹配时优先回退到同分辨率的 jpg，其次回退到第一个变体。
+func selectVariant(variants []model.ImageVariant, variant, format string) *model.ImageVariant {
+	var sameVariant *model.ImageVariant
+	for i := range variants {
+		v := &variants[i]
+		if v.Variant != variant {
+			continue
+		}
+		if v.Format == format {
+			return v
+		}
+		if sameVariant == nil || v.Format == "jpg" {
+			sameVariant = v
+		}
 	}
-	defer reader.Close()
+	if sameVariant != nil {
+		return sameVariant
+	}
+	if len(variants) > 0 {
+		return &variants[0]
+	}
+	return nil
+}
+
+// acceptFormats Accept 媒体类型与存储格式的对应关系，按优先级（体积从小到大）排列
+var acceptFormats = []struct {
+	mime   string
+	format string
+}{
+	{"image/avif", "avif"},
+	{"image/webp", "webp"},
+	{"image/jpeg", "jpg"},
+}
+
+// availableFormats 返回指定分辨率已存储的格式集合
+func availableFormats(variants []model.ImageVariant, variant string) map[string]bool {
+	available := map[string]bool{}
+	for _, v := range variants {
+		if v.Variant == variant {
+			available[v.Format] = true
+		}
+	}
+	return available
+}
+
+// negotiateFormat 根据 Accept 头在可用格式中选择最合适的一种。
+// q 值相同时优先选择体积更小的格式，无可接受的格式时回退到 jpg。
+func negotiateFormat(accept string, available map[string]bool) string {
+	weights := parseAccept(accept)
+	best, bestQ := "jpg", 0.0
+	for _, af := range acceptFormats {
+		if !available[af.format] {
+			continue
+		}
+		q, ok := weights[af.mime]
+		if !ok {
+			// 通配符只对 jpg 生效，避免向未声明支持的客户端返回新格式
+			if af.format != "jpg" {
+				continue
+			}
+			if q, ok = weights["image/*"]; !ok {
+				q, ok = weights["*/*"]
+			}
+			if !ok && accept == "" {
+				q, ok = 1, true
+			}
+			if !ok {
+				continue
+			}
+		}
+		if q > bestQ {
+			best, bestQ = af.format, q
+		}
+	}
+	return best
+}
+
+// parseAccept 解析 Accept 头，返回媒体类型到 q 值的映射
+func parseAccept(accept string) map[string]float64 {
+	weights := map[string]float64{}
+	for _, part := range strings.Split(accept, ",") {
+		fields := strings.Split(part, ";")
+		mediaType := strings.ToLower(strings.TrimSpace(fields[0]))
+		if mediaType == "" {
+			continue
+		}
+		q := 1.0
+		for _, param := range fields[1:] {
+			k, v, ok := strings.Cut(strings.TrimSpace(param), "=")
+			if ok && strings.EqualFold(k, "q") {
+				if parsed, err := strconv.ParseFloat(v, 64); err == nil {
+					q = parsed
+				}
+			}
+		}
+		weights[mediaType] = q
+	}
+	return weights
+}
+
+// serveLocal 从存储读取变体并输出，支持 HEAD、Range 以及 If-None-Match / If-Modified-Since 条件请求
+func serveLocal(c *gin.Context, v *model.ImageVariant, maxAge int) {
+	ctx := c.Request.Context()
 
-	if contentType != "" {
-		c.Header("Content-Type", contentType)
+	store := storage.GlobalStorage()
+
+	// 元数据获取失败不影响输出内容，只是缺少 Last-Modified 等响应头
+	stat, err := store.Stat(ctx, v.StorageKey)
+	if err != nil {
+		util.Logger.Debug("Failed to stat image in storage", zap.String("key", v.StorageKey), zap.Error(err))
+	}
+	modTime := stat.LastModified
+	if modTime.IsZero() {
+		modTime = v.CreatedAt
 	}
 
+	etag := variantETag(v, stat)
+	c.Header("ETag", etag)
 	if maxAge > 0 {
 		c.Header("Cache-Control", fmt.Sprintf("public, max-age=%d", maxAge))
 	} else {
 		c.Header("Cache-Control", "no-cache, no-store, must-revalidate")
 	}
-	io.Copy(c.Writer, reader)
+	if !modTime.IsZero() {
+		c.Header("Last-Modified", modTime.UTC().Format(http.TimeFormat))
+	}
+	// 在读取对象之前处理条件请求，避免命中缓存时访问远程存储
+	if notModified(c.Request, etag, modTime) {
+		c.AbortWithStatus(http.StatusNotModified)
+		return
+	}
+
+	// HEAD 请求不需要内容，已知大小时直接按元数据响应，不访问对象内容
+	isHead := c.Request.Method == http.MethodHead
+	if isHead && stat.Size > 0 {
+		writeContentHeaders(c, v, stat.ContentType, stat.Size)
+		c.Status(http.StatusOK)
+		return
+	}
+
+	reader, contentType, err := store.Get(ctx, v.StorageKey)
+	if err != nil {
+		util.Logger.Error("Failed to get image from storage", zap.String("key", v.StorageKey), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get image"})
+		return
+	}
+	defer reader.Close()
+
+	if contentType == "" {
+		contentType = stat.ContentType
+	}
+
+	if content, ok := reader.(io.ReadSeeker); ok {
+		writeContentHeaders(c, v, contentType, 0)
+		http.ServeContent(c.Writer, c.Request, "", modTime, content)
+		return
+	}
+
+	// 远程存储返回的流不可定位：非 Range 请求直接流式输出
+	if isHead || c.Request.Header.Get("Range") == "" {
+		writeContentHeaders(c, v, contentType, stat.Size)
+		c.Status(http.StatusOK)
+		if isHead {
+			return
+		}
+		if _, err := io.Copy(c.Writer, reader); err != nil {
+			util.Logger.Debug("Failed to stream image", zap.String("key", v.StorageKey), zap.Error(err))
+		}
+		return
+	}
+
+	// Range 需要可定位的内容，先读入内存（单张图片通常只有几 MB）
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		util.Logger.Error("Failed to read image from storage", zap.String("key", v.StorageKey), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get image"})
+		return
+	}
+	writeContentHeaders(c, v, contentType, 0)
+	http.ServeContent(c.Writer, c.Request, "", modTime, bytes.NewReader(data))
 }
 
-func formatMetaSummary(m *model.ImageRegion) gin.H {
-	cfg := config.GetConfig()
+// writeContentHeaders 设置内容相关的响应头，size 大于 0 时同时设置 Content-Length
+func writeContentHeaders(c *gin.Context, v *model.ImageVariant, contentType string, size int64) {
+	if contentType == "" {
+		contentType = fetcher.ContentTypeForFormat(v.Format)
+	}
+	c.Header("Content-Type", contentType)
+	c.Header("Accept-Ranges", "bytes")
+	if size > 0 {
+		c.Header("Content-Length", strconv.FormatInt(size, 10))
+	}
+}
 
+// variantETag 返回变体的强校验 ETag：优先使用内容的 SHA-256，其次使用存储提供的 ETag，
+// 都没有时由存储 Key 与大小推导
+func variantETag(v *model.ImageVariant, stat storage.ObjectStat) string {
+	switch {
+	case v.Checksum != "":
+		return fmt.Sprintf("\"%s\"", v.Checksum)
+	case stat.ETag != "":
+		return fmt.Sprintf("\"%s\"", stat.ETag)
+	}
+	size := stat.Size
+	if size == 0 {
+		size = v.Size
+	}
+	h := fnv.New64a()
+	h.Write([]byte(v.StorageKey))
+	return fmt.Sprintf("\"%x-%x\"", h.Sum64(), size)
+}
+
+// notModified 判断条件请求是否可以返回 304，If-None-Match 存在时忽略 If-Modified-Since
+func notModified(r *http.Request, etag string, modTime time.Time) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		for _, candidate := range strings.Split(inm, ",") {
+			candidate = strings.TrimSpace(candidate)
+			if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+				return true
+			}
+		}
+		return false
+	}
+	if ims := r.Header.Get("If-Modified-Since"); ims != "" && !modTime.IsZero() {
+		t, err := http.ParseTime(ims)
+		return err == nil && !modTime.Truncate(time.Second).After(t)
+	}
+	return false
+}
+
+func formatMetaSummary(m *model.ImageRegion) gin.H {
 	// 找到最小的变体
 	var smallest *model.ImageVariant
 	for i := range m.Variants {
@@ -411,17 +743,11 @@ func formatMetaSummary(m *model.ImageRegion) gin.H {
 
 	variants := []gin.H{}
 	if smallest != nil {
-		url := smallest.PublicURL
-		if url == "" && cfg.API.Mode == "redirect" && m.URLBase != "" {
-			url = fmt.Sprintf("https://www.bing.com%s_%s.jpg", m.URLBase, smallest.Variant)
-		} else if cfg.API.Mode == "local" || url == "" {
-			url = fmt.Sprintf("%s/api/v1/image/date/%s?variant=%s&format=%s&mkt=%s", cfg.Server.BaseURL, m.Date, smallest.Variant, smallest.Format, m.Mkt)
-		}
 		variants = append(variants, gin.H{
 			"variant":     smallest.Variant,
 			"format":      smallest.Format,
 			"size":        smallest.Size,
-			"url":         url,
+			"url":         variantURL(m, smallest),
 			"storage_key": smallest.StorageKey,
 		})
 	}
@@ -429,6 +755,7 @@ func formatMetaSummary(m *model.ImageRegion) gin.H {
 	return gin.H{
 		"date":          m.Date,
 		"mkt":           m.Mkt,
+		"source":        m.Source,
 		"title":         m.Title,
 		"copyright":     m.Copyright,
 		"copyrightlink": m.CopyrightLink,
@@ -440,21 +767,35 @@ func formatMetaSummary(m *model.ImageRegion) gin.H {
 	}
 }
 
-func formatMeta(m *model.ImageRegion) gin.H {
+// bingImageURL 返回 Bing 图片在 fetcher.bing.image_host 上的原始地址，非 Bing 图片源的记录返回 false
+func bingImageURL(m *model.ImageRegion, variant string) (string, bool) {
+	if m.URLBase == "" || (m.Source != "" && m.Source != config.SourceBing) {
+		return "", false
+	}
+	return fmt.Sprintf("%s%s_%s.jpg", config.GetConfig().Fetcher.Bing.GetImageHost(), m.URLBase, variant), true
+}
+
+// variantURL 返回变体对外的访问地址：local 模式指向本服务接口，redirect 模式优先使用存储的公共地址
+func variantURL(m *model.ImageRegion, v *model.ImageVariant) string {
 	cfg := config.GetConfig()
+	url := v.PublicURL
+	if bingURL, ok := bingImageURL(m, v.Variant); url == "" && cfg.API.Mode == "redirect" && ok {
+		url = bingURL
+	} else if cfg.API.Mode == "local" || url == "" {
+		url = fmt.Sprintf("%s/api/v1/image/date/%s?variant=%s&format=%s&mkt=%s", cfg.Server.BaseURL, m.Date, v.Variant, v.Format, m.Mkt)
+	}
+	return url
+}
+
+func formatMeta(m *model.ImageRegion) gin.H {
 	variants := []gin.H{}
-	for _, v := range m.Variants {
-		url := v.PublicURL
-		if url == "" && cfg.API.Mode == "redirect" && m.URLBase != "" {
-			url = fmt.Sprintf("https://www.bing.com%s_%s.jpg", m.URLBase, v.Variant)
-		} else if cfg.API.Mode == "local" || url == "" {
-			url = fmt.Sprintf("%s/api/v1/image/date/%s?variant=%s&format=%s&mkt=%s", cfg.Server.BaseURL, m.Date, v.Variant, v.Format, m.Mkt)
-		}
+	for i := range m.Variants {
+		v := &m.Variants[i]
 		variants = append(variants, gin.H{
 			"variant":     v.Variant,
 			"format":      v.Format,
 			"size":        v.Size,
-			"url":         url,
+			"url":         variantURL(m, v),
 			"storage_key": v.StorageKey,
 		})
 	}
@@ -462,6 +803,7 @@ func formatMeta(m *model.ImageRegion) gin.H {
 	return gin.H{
 		"date":          m.Date,
 		"mkt":           m.Mkt,
+		"source":        m.Source,
 		"title":         m.Title,
 		"copyright":     m.Copyright,
 		"copyrightlink": m.CopyrightLink,
@@ -533,26 +875,11 @@ func GetRegions(c *gin.Context) {
 	c.JSON(http.StatusOK, result)
 }
 
-// compareResolution 比较两个分辨率变体的大小。
+// compareResolution 比较两个分辨率变体的大小（按像素面积）。
 // 返回 < 0 表示 v1 < v2，返回 > 0 表示 v1 > v2，返回 0 表示相等。
 func compareResolution(v1, v2 string) int {
-	resOrder := map[string]int{
-		"320x240":   1,
-		"400x240":   2,
-		"480x360":   3,
-		"640x360":   4,
-		"640x480":   5,
-		"800x480":   6,
-		"800x600":   7,
-		"1024x768":  8,
-		"1280x720":  9,
-		"1366x768":  10,
-		"1920x1080": 11,
-		"UHD":       12,
-	}
-
-	o1, ok1 := resOrder[v1]
-	o2, ok2 := resOrder[v2]
+	a1, ok1 := variantArea(v1)
+	a2, ok2 := variantArea(v2)
 
 	if !ok1 && !ok2 {
 		return strings.Compare(v1, v2)
@@ -564,5 +891,22 @@ func compareResolution(v1, v2 string) int {
 		return -1
 	}
 
-	return o1 - o2
+	return a1 - a2
+}
+
+// variantArea 返回变体的像素面积，优先使用配置的变体矩阵，其次解析 WxH 形式的名称
+func variantArea(name string) (int, bool) {
+	if name == "UHD" {
+		return 3840 * 2160, true
+	}
+	for _, v := range config.GetConfig().GetVariants() {
+		if v.Name == name {
+			return v.Width * v.Height, true
+		}
+	}
+	var w, h int
+	if n, _ := fmt.Sscanf(name, "%dx%d", &w, &h); n == 2 && w > 0 && h > 0 {
+		return w * h, true
+	}
+	return 0, false
 }
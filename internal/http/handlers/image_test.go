@@ -1,15 +1,24 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"BingPaper/internal/config"
 	"BingPaper/internal/model"
+	"BingPaper/internal/storage"
+	"BingPaper/internal/storage/local"
+	"BingPaper/internal/util"
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
 )
 
 func TestHandleImageResponseRedirect(t *testing.T) {
@@ -126,3 +135,316 @@ func TestGetRegions(t *testing.T) {
 		assert.Equal(t, "ja-JP", regions[1]["value"])
 	})
 }
+
+func TestSelectVariant(t *testing.T) {
+	variants := []model.ImageVariant{
+		{Variant: "640x480", Format: "jpg"},
+		{Variant: "UHD", Format: "webp"},
+		{Variant: "UHD", Format: "jpg"},
+	}
+
+	t.Run("exact match", func(t *testing.T) {
+		v := selectVariant(variants, "UHD", "webp")
+		assert.Equal(t, "UHD", v.Variant)
+		assert.Equal(t, "webp", v.Format)
+	})
+
+	t.Run("missing format falls back to jpg of same variant", func(t *testing.T) {
+		v := selectVariant(variants, "UHD", "avif")
+		assert.Equal(t, "UHD", v.Variant)
+		assert.Equal(t, "jpg", v.Format)
+	})
+
+	t.Run("missing variant falls back to first", func(t *testing.T) {
+		v := selectVariant(variants, "1920x1080", "jpg")
+		assert.Equal(t, "640x480", v.Variant)
+	})
+
+	t.Run("no variants", func(t *testing.T) {
+		assert.Nil(t, selectVariant(nil, "UHD", "jpg"))
+	})
+}
+
+func TestNegotiateFormat(t *testing.T) {
+	variants := []model.ImageVariant{
+		{Variant: "UHD", Format: "jpg"},
+		{Variant: "UHD", Format: "webp"},
+		{Variant: "640x480", Format: "jpg"},
+	}
+
+	tests := []struct {
+		name     string
+		accept   string
+		variant  string
+		expected string
+	}{
+		{"empty accept", "", "UHD", "jpg"},
+		{"browser accept prefers webp", "image/avif,image/webp,image/apng,*/*;q=0.8", "UHD", "webp"},
+		{"avif not stored", "image/avif", "UHD", "jpg"},
+		{"webp rejected", "image/webp;q=0,image/*", "UHD", "jpg"},
+		{"higher q wins", "image/webp;q=0.5,image/jpeg", "UHD", "jpg"},
+		{"variant without webp", "image/webp", "640x480", "jpg"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, negotiateFormat(tt.accept, availableFormats(variants, tt.variant)))
+		})
+	}
+}
+
+func TestHandleImageResponseVaryAccept(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	config.Init("")
+	config.GetConfig().API.Mode = "redirect"
+
+	imgRegion := &model.ImageRegion{
+		Date: "2026-01-26",
+		Variants: []model.ImageVariant{
+			{Variant: "UHD", Format: "jpg", PublicURL: "http://cdn.example.com/a.jpg"},
+			{Variant: "UHD", Format: "webp", PublicURL: "http://cdn.example.com/a.webp"},
+		},
+	}
+
+	t.Run("negotiates webp from Accept", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request, _ = http.NewRequest("GET", "/api/v1/image/today", nil)
+		c.Request.Header.Set("Accept", "image/webp,*/*")
+
+		handleImageResponse(c, imgRegion, 0)
+
+		assert.Equal(t, http.StatusFound, w.Code)
+		assert.Equal(t, "http://cdn.example.com/a.webp", w.Header().Get("Location"))
+		assert.Equal(t, "Accept", w.Header().Get("Vary"))
+	})
+
+	t.Run("explicit format ignores Accept", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request, _ = http.NewRequest("GET", "/api/v1/image/today?format=jpg", nil)
+		c.Request.Header.Set("Accept", "image/webp,*/*")
+
+		handleImageResponse(c, imgRegion, 0)
+
+		assert.Equal(t, "http://cdn.example.com/a.jpg", w.Header().Get("Location"))
+		assert.Empty(t, w.Header().Get("Vary"))
+	})
+}
+
+func TestHandleImageResponseResizeValidation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	config.Init("")
+	config.GetConfig().API.Resize.Enabled = true
+	config.GetConfig().API.Resize.MaxDimension = 3840
+	config.GetConfig().API.Resize.AllowedSizes = nil
+
+	imgRegion := &model.ImageRegion{
+		Date:     "2026-01-26",
+		Variants: []model.ImageVariant{{Variant: "UHD", Format: "jpg"}},
+	}
+
+	tests := []struct {
+		name  string
+		query string
+	}{
+		{"non numeric width", "w=abc"},
+		{"exceeds max dimension", "w=5000&h=1000"},
+		{"unknown fit", "w=100&h=100&fit=stretch"},
+		{"unknown format", "w=100&format=gif"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request, _ = http.NewRequest("GET", "/api/v1/image/today?"+tt.query, nil)
+
+			handleImageResponse(c, imgRegion, 0)
+
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+		})
+	}
+
+	t.Run("size outside allow-list", func(t *testing.T) {
+		config.GetConfig().API.Resize.AllowedSizes = []string{"2560x1440"}
+		defer func() { config.GetConfig().API.Resize.AllowedSizes = nil }()
+
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request, _ = http.NewRequest("GET", "/api/v1/image/today?w=3440&h=1440", nil)
+
+		handleImageResponse(c, imgRegion, 0)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("resize disabled", func(t *testing.T) {
+		config.GetConfig().API.Resize.Enabled = false
+		defer func() { config.GetConfig().API.Resize.Enabled = true }()
+
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request, _ = http.NewRequest("GET", "/api/v1/image/today?w=1170&h=2532", nil)
+
+		handleImageResponse(c, imgRegion, 0)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
+
+func TestCompareResolution(t *testing.T) {
+	config.Init("")
+	config.GetConfig().Fetcher.Variants = nil
+
+	assert.Less(t, compareResolution("320x240", "1280x768"), 0)
+	assert.Greater(t, compareResolution("UHD", "1920x1200"), 0)
+	assert.Less(t, compareResolution("2560x1440", "UHD"), 0, "unconfigured WxH names are parsed")
+	assert.Greater(t, compareResolution("custom", "1920x1080"), 0, "unknown names sort last")
+
+	config.GetConfig().Fetcher.Variants = []config.VariantConfig{{Name: "phone", Width: 1170, Height: 2532}}
+	defer func() { config.GetConfig().Fetcher.Variants = nil }()
+	assert.Greater(t, compareResolution("phone", "1920x1080"), 0)
+}
+
+func TestServeLocal(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	util.Logger = zap.NewNop()
+
+	s, err := local.NewLocalStorage(t.TempDir())
+	assert.NoError(t, err)
+	_, err = s.Put(context.Background(), "Img/Img_UHD.jpg", strings.NewReader("jpeg-bytes"), "image/jpeg")
+	assert.NoError(t, err)
+	storage.SetGlobalStorage(s)
+
+	v := &model.ImageVariant{Variant: "UHD", Format: "jpg", StorageKey: "Img/Img_UHD.jpg", Checksum: "abc123"}
+	serve := func(method string, headers map[string]string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request, _ = http.NewRequest(method, "/api/v1/image/today", nil)
+		for k, val := range headers {
+			c.Request.Header.Set(k, val)
+		}
+		serveLocal(c, v, 60)
+		c.Writer.WriteHeaderNow()
+		return w
+	}
+
+	w := serve("GET", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "jpeg-bytes", w.Body.String())
+	assert.Equal(t, "image/jpeg", w.Header().Get("Content-Type"))
+	assert.Equal(t, "10", w.Header().Get("Content-Length"))
+	assert.Equal(t, `"abc123"`, w.Header().Get("ETag"))
+	assert.Equal(t, "bytes", w.Header().Get("Accept-Ranges"))
+	lastModified := w.Header().Get("Last-Modified")
+	_, err = http.ParseTime(lastModified)
+	assert.NoError(t, err)
+
+	t.Run("Range", func(t *testing.T) {
+		w := serve("GET", map[string]string{"Range": "bytes=5-"})
+		assert.Equal(t, http.StatusPartialContent, w.Code)
+		assert.Equal(t, "bytes", w.Body.String())
+		assert.Equal(t, "bytes 5-9/10", w.Header().Get("Content-Range"))
+	})
+
+	t.Run("If-None-Match", func(t *testing.T) {
+		assert.Equal(t, http.StatusNotModified, serve("GET", map[string]string{"If-None-Match": `"other", "abc123"`}).Code)
+		assert.Equal(t, http.StatusOK, serve("GET", map[string]string{"If-None-Match": `"other"`, "If-Modified-Since": lastModified}).Code)
+	})
+
+	t.Run("If-Modified-Since", func(t *testing.T) {
+		assert.Equal(t, http.StatusNotModified, serve("GET", map[string]string{"If-Modified-Since": lastModified}).Code)
+		assert.Equal(t, http.StatusOK, serve("GET", map[string]string{"If-Modified-Since": "Mon, 02 Jan 2006 15:04:05 GMT"}).Code)
+	})
+
+	t.Run("HEAD", func(t *testing.T) {
+		w := serve("HEAD", nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Empty(t, w.Body.String())
+		assert.Equal(t, "10", w.Header().Get("Content-Length"))
+	})
+
+	t.Run("stream", func(t *testing.T) {
+		remote := &streamStorage{LocalStorage: s}
+		storage.SetGlobalStorage(remote)
+		defer storage.SetGlobalStorage(s)
+
+		w := serve("GET", nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "jpeg-bytes", w.Body.String())
+		assert.Equal(t, "10", w.Header().Get("Content-Length"))
+
+		w = serve("GET", map[string]string{"Range": "bytes=5-"})
+		assert.Equal(t, http.StatusPartialContent, w.Code)
+		assert.Equal(t, "bytes", w.Body.String())
+
+		// HEAD 按元数据响应，不读取对象
+		gets := remote.gets.Load()
+		w = serve("HEAD", nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "10", w.Header().Get("Content-Length"))
+		assert.Equal(t, "image/jpeg", w.Header().Get("Content-Type"))
+		assert.Equal(t, gets, remote.gets.Load())
+	})
+
+	t.Run("ETag without checksum is per variant", func(t *testing.T) {
+		stat := storage.ObjectStat{Size: 10}
+		a := variantETag(&model.ImageVariant{StorageKey: "Img/Img_UHD.jpg"}, stat)
+		b := variantETag(&model.ImageVariant{StorageKey: "Img/Img_UHD.webp"}, stat)
+		assert.NotEqual(t, a, b)
+		assert.Equal(t, `"etag"`, variantETag(&model.ImageVariant{}, storage.ObjectStat{ETag: "etag"}))
+	})
+}
+
+// streamStorage 模拟远程存储：Get 返回不可定位的流
+type streamStorage struct {
+	*local.LocalStorage
+	gets atomic.Int32
+}
+
+func (s *streamStorage) Get(ctx context.Context, key string) (io.ReadCloser, string, error) {
+	s.gets.Add(1)
+	r, contentType, err := s.LocalStorage.Get(ctx, key)
+	if err != nil {
+		return nil, "", err
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{r, r}, contentType, nil
+}
+
+type presignStorage struct {
+	*local.LocalStorage
+	expires time.Time
+}
+
+func (p *presignStorage) PresignedURL(ctx context.Context, key string) (string, time.Time, error) {
+	return "https://bucket.example.com/" + key + "?X-Amz-Signature=abc", p.expires, nil
+}
+
+func TestServeVariantPresigned(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	assert.NoError(t, config.Init(""))
+	config.GetConfig().API.Mode = "redirect"
+
+	s, err := local.NewLocalStorage(t.TempDir())
+	assert.NoError(t, err)
+	storage.SetGlobalStorage(&presignStorage{LocalStorage: s, expires: time.Now().Add(time.Hour)})
+	defer func() { storage.SetGlobalStorage(s) }()
+
+	m := &model.ImageRegion{Date: "2026-01-26", Mkt: "zh-CN", URLBase: "/th?id=OHR.TestImage"}
+	v := &model.ImageVariant{Variant: "UHD", Format: "jpg", StorageKey: "TestImage/TestImage_UHD.jpg", PublicURL: "https://bucket.s3.amazonaws.com/TestImage/TestImage_UHD.jpg"}
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest("GET", "/api/v1/image/today", nil)
+
+	serveVariant(c, m, v, 86400)
+
+	assert.Equal(t, http.StatusFound, w.Code)
+	assert.Equal(t, "https://bucket.example.com/TestImage/TestImage_UHD.jpg?X-Amz-Signature=abc", w.Header().Get("Location"))
+	// max-age 不超过预签名剩余有效期的一半
+	assert.Equal(t, "private, max-age=1799", w.Header().Get("Cache-Control"))
+}
@@ -41,16 +41,27 @@ func SetupRouter(webFS embed.FS) *gin.Engine {
 		img.Use(middleware.StatMiddleware())
 		{
 			img.GET("/today", handlers.GetToday)
+			img.HEAD("/today", handlers.GetToday)
 			img.GET("/today/meta", handlers.GetTodayMeta)
 			img.GET("/random", handlers.GetRandom)
+			img.HEAD("/random", handlers.GetRandom)
 			img.GET("/random/meta", handlers.GetRandomMeta)
 			img.GET("/date/:date", handlers.GetByDate)
+			img.HEAD("/date/:date", handlers.GetByDate)
 			img.GET("/date/:date/meta", handlers.GetByDateMeta)
 		}
 		api.GET("/images", middleware.StatMiddleware(), handlers.ListImages)
 		api.GET("/images/global/today", middleware.StatMiddleware(), handlers.ListGlobalTodayImages)
 		api.GET("/regions", handlers.GetRegions)
 		api.GET("/layout", handlers.GetLayout)
+		api.GET("/events", handlers.Events)
+
+		feed := api.Group("/feed")
+		feed.Use(middleware.StatMiddleware())
+		{
+			feed.GET("/rss", handlers.GetRSSFeed)
+			feed.GET("/atom", handlers.GetAtomFeed)
+		}
 
 		// 管理接口
 		admin := api.Group("/admin")
@@ -76,6 +87,24 @@ func SetupRouter(webFS embed.FS) *gin.Engine {
 
 				authorized.POST("/fetch", handlers.ManualFetch)
 				authorized.POST("/cleanup", handlers.ManualCleanup)
+				authorized.POST("/variants/regenerate", handlers.RegenerateVariants)
+				authorized.GET("/variants/regenerate", handlers.GetVariantBackfillStatus)
+				authorized.POST("/storage/migrate", handlers.MigrateStorage)
+				authorized.GET("/storage/migrate", handlers.GetStorageMigrationStatus)
+				authorized.POST("/storage/fsck", handlers.CheckStorage)
+				authorized.GET("/storage/fsck", handlers.GetStorageCheckReport)
+				authorized.GET("/jobs", handlers.ListJobs)
+				authorized.GET("/jobs/:id", handlers.GetJob)
+				authorized.POST("/jobs/:id/cancel", handlers.CancelJob)
+				authorized.GET("/export", handlers.ExportArchive)
+				authorized.POST("/import", handlers.ImportArchive)
+
+				authorized.GET("/webhooks", handlers.ListWebhooks)
+				authorized.POST("/webhooks", handlers.CreateWebhook)
+				authorized.PUT("/webhooks/:id", handlers.UpdateWebhook)
+				authorized.DELETE("/webhooks/:id", handlers.DeleteWebhook)
+				authorized.GET("/webhooks/:id/deliveries", handlers.ListWebhookDeliveries)
+				authorized.POST("/webhooks/:id/ping", handlers.PingWebhook)
 
 				authorized.GET("/layout", handlers.GetLayout)
 				authorized.PUT("/layout", handlers.UpdateLayout)
@@ -8,8 +8,9 @@ import (
 
 type ImageRegion struct {
 	ID            uint           `gorm:"primaryKey" json:"id"`
-	Date          string         `gorm:"uniqueIndex:idx_date_mkt;index:idx_mkt_date,priority:2;type:varchar(10)" json:"date"` // YYYY-MM-DD
-	Mkt           string         `gorm:"uniqueIndex:idx_date_mkt;index:idx_mkt_date,priority:1;type:varchar(10)" json:"mkt"`  // zh-CN, en-US etc.
+	Date          string         `gorm:"uniqueIndex:idx_date_mkt_source;index:idx_mkt_date,priority:2;type:varchar(10)" json:"date"` // YYYY-MM-DD
+	Mkt           string         `gorm:"uniqueIndex:idx_date_mkt_source;index:idx_mkt_date,priority:1;type:varchar(10)" json:"mkt"`  // zh-CN, en-US etc.
+	Source        string         `gorm:"uniqueIndex:idx_date_mkt_source;type:varchar(32);default:bing" json:"source"`                // 图片源: bing 等
 	HSH           string         `gorm:"type:varchar(64)" json:"hsh"`
 	URLBase       string         `json:"urlbase"`
 	ImageName     string         `gorm:"index;type:varchar(100)" json:"image_name"`
@@ -33,6 +34,8 @@ type ImageVariant struct {
 	StorageKey string    `json:"storage_key"`
 	PublicURL  string    `json:"public_url"`
 	Size       int64     `json:"size"`
+	Spec       string    `gorm:"type:varchar(64)" json:"spec"`           // 生成参数指纹，用于判断变体是否过期
+	Checksum   string    `gorm:"index;type:varchar(64)" json:"checksum"` // 内容的 SHA-256，历史数据可能为空
 	CreatedAt  time.Time `json:"created_at"`
 }
 
@@ -46,6 +49,56 @@ type Token struct {
 	UpdatedAt time.Time `json:"updated_at"`
 }
 
+type Job struct {
+	ID         uint       `gorm:"primaryKey" json:"id"`
+	Type       string     `gorm:"index;type:varchar(32)" json:"type"`  // fetch, cleanup, on_demand_fetch, variant_backfill 等
+	State      string     `gorm:"index;type:varchar(16)" json:"state"` // pending, running, succeeded, failed
+	Params     string     `gorm:"type:text" json:"params"`             // 任务参数 (JSON)
+	Total      int        `json:"total"`                               // 总工作量，0 表示未知
+	Processed  int        `json:"processed"`                           // 已完成的工作量
+	Logs       string     `gorm:"size:4294967295" json:"logs"`         // 日志 (按行)，MySQL 下为 longtext，其他数据库为 text
+	Result     string     `gorm:"size:4294967295" json:"result"`       // 任务结果 (JSON)，如抓取报告
+	Error      string     `gorm:"type:text" json:"error"`
+	CreatedAt  time.Time  `json:"created_at"`
+	StartedAt  *time.Time `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at"`
+}
+
+type Webhook struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Name      string    `json:"name"`
+	URL       string    `json:"url"`
+	Secret    string    `json:"-"`                                       // HMAC-SHA256 签名密钥，只在创建时返回
+	Events    []string  `gorm:"serializer:json;type:text" json:"events"` // 订阅的事件类型，为空表示全部
+	Mkts      []string  `gorm:"serializer:json;type:text" json:"mkts"`   // 地区过滤，为空表示全部
+	Enabled   bool      `json:"enabled"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type WebhookDelivery struct {
+	ID          uint       `gorm:"primaryKey" json:"id"`
+	WebhookID   uint       `gorm:"index" json:"webhook_id"`
+	Event       string     `gorm:"type:varchar(32)" json:"event"`
+	Payload     string     `gorm:"type:text" json:"payload"`
+	Attempts    int        `json:"attempts"`
+	StatusCode  int        `json:"status_code"` // 最后一次请求的 HTTP 状态码，0 表示请求未完成
+	Success     bool       `json:"success"`
+	Error       string     `gorm:"type:text" json:"error"`
+	CreatedAt   time.Time  `json:"created_at"`
+	DeliveredAt *time.Time `json:"delivered_at"` // 最后一次尝试的时间
+}
+
+// StorageMigrationItem 存储迁移中已复制并校验通过的对象，用于中断后续传
+type StorageMigrationItem struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	Target     string    `gorm:"uniqueIndex:idx_target_key;type:varchar(128)" json:"target"` // 目标存储位置标识
+	StorageKey string    `gorm:"uniqueIndex:idx_target_key;type:varchar(255)" json:"storage_key"`
+	Size       int64     `json:"size"`
+	Checksum   string    `gorm:"type:varchar(64)" json:"checksum"` // SHA-256
+	CreatedAt  time.Time `json:"created_at"`
+}
+
 type ApiStat struct {
 	ID        uint      `gorm:"primaryKey" json:"id"`
 	Date      string    `gorm:"uniqueIndex:idx_date_endpoint_mkt;type:varchar(10)" json:"date"` // YYYY-MM-DD
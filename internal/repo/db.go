@@ -132,12 +132,26 @@ func BuildDBRuntimeConfig(baseCfg *config.Config, dbCfg config.DBConfig) *config
 }
 
 func AutoMigrateModels(db *gorm.DB) error {
-	return db.AutoMigrate(
+	if err := db.AutoMigrate(
 		&model.ImageRegion{},
 		&model.ImageVariant{},
 		&model.Token{},
 		&model.ApiStat{},
-	)
+		&model.Job{},
+		&model.Webhook{},
+		&model.WebhookDelivery{},
+		&model.StorageMigrationItem{},
+	); err != nil {
+		return err
+	}
+
+	// 引入图片源后唯一索引改为 (date, mkt, source)，旧的 (date, mkt) 索引会阻止不同图片源写入同一天
+	if m := db.Migrator(); m.HasIndex(&model.ImageRegion{}, "idx_date_mkt") {
+		if err := m.DropIndex(&model.ImageRegion{}, "idx_date_mkt"); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func ValidateDBConnection(baseCfg *config.Config, dbCfg config.DBConfig) error {
@@ -16,6 +16,7 @@ type MigrationStats struct {
 	ImageVariants int `json:"image_variants"`
 	Tokens        int `json:"tokens"`
 	ApiStats      int `json:"api_stats"`
+	Webhooks      int `json:"webhooks"`
 }
 
 var migrationMu sync.Mutex
@@ -89,6 +90,9 @@ func MigrateDataToNewDB(oldDB *gorm.DB, baseCfg *config.Config, targetDB config.
 	if err := newDB.Session(&gorm.Session{AllowGlobalUpdate: true}).Delete(&model.ApiStat{}).Error; err != nil {
 		return stats, fmt.Errorf("failed to clear ApiStats: %w", err)
 	}
+	if err := newDB.Session(&gorm.Session{AllowGlobalUpdate: true}).Delete(&model.Webhook{}).Error; err != nil {
+		return stats, fmt.Errorf("failed to clear Webhooks: %w", err)
+	}
 
 	// 4. 开始迁移数据
 	// 使用事务确保迁移的原子性
@@ -113,6 +117,11 @@ func MigrateDataToNewDB(oldDB *gorm.DB, baseCfg *config.Config, targetDB config.
 			return err
 		}
 
+		stats.Webhooks, err = migrateTable[model.Webhook](oldDB, tx, "Webhook")
+		if err != nil {
+			return err
+		}
+
 		return nil
 	}); err != nil {
 		return stats, err
@@ -122,7 +131,8 @@ func MigrateDataToNewDB(oldDB *gorm.DB, baseCfg *config.Config, targetDB config.
 		zap.Int("image_regions", stats.ImageRegions),
 		zap.Int("image_variants", stats.ImageVariants),
 		zap.Int("tokens", stats.Tokens),
-		zap.Int("api_stats", stats.ApiStats))
+		zap.Int("api_stats", stats.ApiStats),
+		zap.Int("webhooks", stats.Webhooks))
 
 	return stats, nil
 }
@@ -0,0 +1,379 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"slices"
+	"strconv"
+	"time"
+
+	"BingPaper/internal/model"
+	"BingPaper/internal/repo"
+	"BingPaper/internal/storage"
+	"BingPaper/internal/util"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+const (
+	FormatZip   = "zip"
+	FormatTarGz = "tar.gz"
+
+	ManifestJSON = "manifest.json"
+	ManifestCSV  = "manifest.csv"
+	imagesDir    = "images"
+)
+
+var ErrInvalidOptions = errors.New("invalid export options")
+
+// ExportOptions 导出筛选条件
+type ExportOptions struct {
+	Mkt      string   // 地区，为空表示全部
+	From     string   // 起始日期 (YYYY-MM-DD，含)，为空表示不限
+	To       string   // 截止日期 (YYYY-MM-DD，含)，为空表示不限
+	Variants []string // 分辨率，为空表示全部
+	Formats  []string // 图片格式，为空表示全部
+	Archive  string   // zip | tar.gz，默认 zip
+}
+
+// ManifestVariant 清单中的变体条目，Path 为归档内的相对路径
+type ManifestVariant struct {
+	Variant    string `json:"variant"`
+	Format     string `json:"format"`
+	Size       int64  `json:"size"`
+	Spec       string `json:"spec,omitempty"`
+	StorageKey string `json:"storage_key"`
+	Path       string `json:"path"`
+}
+
+// ManifestEntry 清单中的图片条目，对应一条 ImageRegion 记录
+type ManifestEntry struct {
+	Date          string            `json:"date"`
+	Mkt           string            `json:"mkt"`
+	Source        string            `json:"source,omitempty"`
+	HSH           string            `json:"hsh"`
+	URLBase       string            `json:"urlbase"`
+	ImageName     string            `json:"image_name"`
+	Title         string            `json:"title"`
+	Copyright     string            `json:"copyright"`
+	CopyrightLink string            `json:"copyrightlink"`
+	Quiz          string            `json:"quiz"`
+	StartDate     string            `json:"startdate"`
+	FullStartDate string            `json:"fullstartdate"`
+	Variants      []ManifestVariant `json:"variants"`
+}
+
+// Manifest 归档清单
+type Manifest struct {
+	Version    int             `json:"version"`
+	ExportedAt time.Time       `json:"exported_at"`
+	Images     []ManifestEntry `json:"images"`
+}
+
+// Normalize 校验并补全导出参数
+func (o *ExportOptions) Normalize() error {
+	if o.Archive == "" {
+		o.Archive = FormatZip
+	}
+	if o.Archive == "tgz" {
+		o.Archive = FormatTarGz
+	}
+	if o.Archive != FormatZip && o.Archive != FormatTarGz {
+		return fmt.Errorf("%w: archive must be zip or tar.gz", ErrInvalidOptions)
+	}
+	for _, d := range []string{o.From, o.To} {
+		if d == "" {
+			continue
+		}
+		if _, err := time.Parse("2006-01-02", d); err != nil {
+			return fmt.Errorf("%w: invalid date %q, expected YYYY-MM-DD", ErrInvalidOptions, d)
+		}
+	}
+	if o.Mkt != "" && !util.IsValidRegion(o.Mkt) {
+		return fmt.Errorf("%w: [%s] is not a standard region code", ErrInvalidOptions, o.Mkt)
+	}
+	return nil
+}
+
+// Filename 返回建议的下载文件名
+func (o ExportOptions) Filename() string {
+	mkt := o.Mkt
+	if mkt == "" {
+		mkt = "all"
+	}
+	name := "bingpaper-" + mkt
+	if o.From != "" {
+		name += "-" + o.From
+	}
+	if o.To != "" {
+		name += "-" + o.To
+	}
+	return name + "." + o.Archive
+}
+
+// ContentType 返回归档的 MIME 类型
+func (o ExportOptions) ContentType() string {
+	if o.Archive == FormatTarGz {
+		return "application/gzip"
+	}
+	return "application/zip"
+}
+
+// BuildManifest 根据筛选条件从数据库生成清单
+func BuildManifest(opts ExportOptions) (*Manifest, error) {
+	tx := repo.DB.Model(&model.ImageRegion{}).Order("date asc, mkt asc")
+	if opts.Mkt != "" {
+		tx = tx.Where("mkt = ?", opts.Mkt)
+	}
+	if opts.From != "" {
+		tx = tx.Where("date >= ?", opts.From)
+	}
+	if opts.To != "" {
+		tx = tx.Where("date <= ?", opts.To)
+	}
+
+	var regions []model.ImageRegion
+	err := tx.Preload("Variants", func(db *gorm.DB) *gorm.DB {
+		if len(opts.Variants) > 0 {
+			db = db.Where("variant IN ?", opts.Variants)
+		}
+		if len(opts.Formats) > 0 {
+			db = db.Where("format IN ?", opts.Formats)
+		}
+		return db.Order("size desc, id asc")
+	}).Find(&regions).Error
+	if err != nil {
+		return nil, err
+	}
+
+	m := &Manifest{Version: 1, ExportedAt: time.Now(), Images: make([]ManifestEntry, 0, len(regions))}
+	for _, r := range regions {
+		entry := ManifestEntry{
+			Date:          r.Date,
+			Mkt:           r.Mkt,
+			Source:        r.Source,
+			HSH:           r.HSH,
+			URLBase:       r.URLBase,
+			ImageName:     r.ImageName,
+			Title:         r.Title,
+			Copyright:     r.Copyright,
+			CopyrightLink: r.CopyrightLink,
+			Quiz:          r.Quiz,
+			StartDate:     r.StartDate,
+			FullStartDate: r.FullStartDate,
+			Variants:      make([]ManifestVariant, 0, len(r.Variants)),
+		}
+		for _, v := range r.Variants {
+			entry.Variants = append(entry.Variants, ManifestVariant{
+				Variant:    v.Variant,
+				Format:     v.Format,
+				Size:       v.Size,
+				Spec:       v.Spec,
+				StorageKey: v.StorageKey,
+				Path:       path.Join(imagesDir, v.StorageKey),
+			})
+		}
+		m.Images = append(m.Images, entry)
+	}
+	return m, nil
+}
+
+// archiveWriter 屏蔽 zip 与 tar.gz 的差异
+type archiveWriter interface {
+	WriteFile(name string, r io.Reader, size int64) error
+	Close() error
+}
+
+type zipWriter struct{ zw *zip.Writer }
+
+func (w *zipWriter) WriteFile(name string, r io.Reader, size int64) error {
+	// 图片本身已压缩，使用 Store 避免无意义的 CPU 开销
+	method := zip.Store
+	if path.Ext(name) == ".json" || path.Ext(name) == ".csv" {
+		method = zip.Deflate
+	}
+	f, err := w.zw.CreateHeader(&zip.FileHeader{Name: name, Method: method, Modified: time.Now()})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, r)
+	return err
+}
+
+func (w *zipWriter) Close() error { return w.zw.Close() }
+
+type tarGzWriter struct {
+	gz *gzip.Writer
+	tw *tar.Writer
+}
+
+func (w *tarGzWriter) WriteFile(name string, r io.Reader, size int64) error {
+	// tar 头部需要准确的大小，大小未知时先读入内存
+	if size < 0 {
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		r, size = bytes.NewReader(data), int64(len(data))
+	}
+	if err := w.tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: size, ModTime: time.Now()}); err != nil {
+		return err
+	}
+	_, err := io.Copy(w.tw, r)
+	return err
+}
+
+func (w *tarGzWriter) Close() error {
+	if err := w.tw.Close(); err != nil {
+		return err
+	}
+	return w.gz.Close()
+}
+
+func newArchiveWriter(format string, out io.Writer) archiveWriter {
+	if format == FormatTarGz {
+		gz := gzip.NewWriter(out)
+		return &tarGzWriter{gz: gz, tw: tar.NewWriter(gz)}
+	}
+	return &zipWriter{zw: zip.NewWriter(out)}
+}
+
+// ExportStats 导出结果统计
+type ExportStats struct {
+	Images  int `json:"images"`
+	Files   int `json:"files"`
+	Skipped int `json:"skipped"` // 存储中读取失败而未写入归档的文件数
+}
+
+// Export 将清单及图片以流的方式写入 out。
+// 清单位于归档开头，便于导入时顺序处理；多个地区共用的图片只写入一次。
+// 读取失败的图片会被跳过并记录日志，不会中断导出。
+func Export(ctx context.Context, opts ExportOptions, out io.Writer) (ExportStats, error) {
+	var stats ExportStats
+	if err := opts.Normalize(); err != nil {
+		return stats, err
+	}
+
+	m, err := BuildManifest(opts)
+	if err != nil {
+		return stats, err
+	}
+	stats.Images = len(m.Images)
+
+	aw := newArchiveWriter(opts.Archive, out)
+
+	manifestJSON, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return stats, err
+	}
+	if err := aw.WriteFile(ManifestJSON, bytes.NewReader(manifestJSON), int64(len(manifestJSON))); err != nil {
+		return stats, err
+	}
+	manifestCSV, err := m.CSV()
+	if err != nil {
+		return stats, err
+	}
+	if err := aw.WriteFile(ManifestCSV, bytes.NewReader(manifestCSV), int64(len(manifestCSV))); err != nil {
+		return stats, err
+	}
+
+	written := make(map[string]bool)
+	for _, img := range m.Images {
+		for _, v := range img.Variants {
+			if written[v.Path] {
+				continue
+			}
+			if err := ctx.Err(); err != nil {
+				return stats, err
+			}
+			written[v.Path] = true
+
+			if err := exportFile(ctx, aw, v); err != nil {
+				var archiveErr *archiveWriteError
+				if errors.As(err, &archiveErr) {
+					return stats, archiveErr.err
+				}
+				util.Logger.Warn("Skipping variant in export", zap.String("key", v.StorageKey), zap.Error(err))
+				stats.Skipped++
+				continue
+			}
+			stats.Files++
+		}
+	}
+
+	if err := aw.Close(); err != nil {
+		return stats, err
+	}
+	util.Logger.Info("Export completed",
+		zap.Int("images", stats.Images),
+		zap.Int("files", stats.Files),
+		zap.Int("skipped", stats.Skipped))
+	return stats, nil
+}
+
+// archiveWriteError 写入归档失败（通常是客户端断开），此时无法继续导出
+type archiveWriteError struct{ err error }
+
+func (e *archiveWriteError) Error() string { return e.err.Error() }
+
+func exportFile(ctx context.Context, aw archiveWriter, v ManifestVariant) error {
+	reader, _, err := storage.GlobalStorage().Get(ctx, v.StorageKey)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	// 变体的 Size 可能不准确（如历史数据为 0），tar 需要真实大小，因此统一读入内存
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return err
+	}
+	if err := aw.WriteFile(v.Path, bytes.NewReader(data), int64(len(data))); err != nil {
+		return &archiveWriteError{err: err}
+	}
+	return nil
+}
+
+// csvHeader 清单 CSV 的列，每行对应一个 (图片, 变体)
+var csvHeader = []string{"date", "mkt", "image_name", "title", "copyright", "copyrightlink", "hsh", "variant", "format", "size", "path"}
+
+// CSV 将清单展开为每个变体一行的 CSV
+func (m *Manifest) CSV() ([]byte, error) {
+	buf := new(bytes.Buffer)
+	w := csv.NewWriter(buf)
+	if err := w.Write(csvHeader); err != nil {
+		return nil, err
+	}
+	for _, img := range m.Images {
+		for _, v := range img.Variants {
+			row := []string{img.Date, img.Mkt, img.ImageName, img.Title, img.Copyright, img.CopyrightLink, img.HSH,
+				v.Variant, v.Format, strconv.FormatInt(v.Size, 10), v.Path}
+			if err := w.Write(row); err != nil {
+				return nil, err
+			}
+		}
+	}
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
+
+// SplitList 解析逗号分隔的参数列表，忽略空项
+func SplitList(s string) []string {
+	var out []string
+	for _, item := range bytes.Split([]byte(s), []byte(",")) {
+		if v := string(bytes.TrimSpace(item)); v != "" && !slices.Contains(out, v) {
+			out = append(out, v)
+		}
+	}
+	return out
+}
@@ -0,0 +1,138 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"BingPaper/internal/model"
+	"BingPaper/internal/repo"
+	"BingPaper/internal/storage"
+	"BingPaper/internal/storage/local"
+	"BingPaper/internal/util"
+
+	"github.com/glebarez/sqlite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+func setupTestData(t *testing.T) {
+	t.Helper()
+
+	util.Logger = zap.NewNop()
+	db, err := gorm.Open(sqlite.Open(fmt.Sprintf("file:%s?mode=memory&cache=shared", t.Name())), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, repo.AutoMigrateModels(db))
+	repo.DB = db
+
+	s, err := local.NewLocalStorage(t.TempDir())
+	require.NoError(t, err)
+	orig := storage.GlobalStorage()
+	storage.SetGlobalStorage(s)
+	t.Cleanup(func() { storage.SetGlobalStorage(orig) })
+
+	ctx := context.Background()
+	for _, r := range []model.ImageRegion{
+		{Date: "2026-01-24", Mkt: "zh-CN", ImageName: "Old", Title: "Old"},
+		{Date: "2026-01-25", Mkt: "zh-CN", ImageName: "Shared", Title: "Shared, \"quoted\""},
+		{Date: "2026-01-25", Mkt: "en-US", ImageName: "Shared", Title: "Shared"},
+		{Date: "2026-01-26", Mkt: "zh-CN", ImageName: "Missing", Title: "Missing"},
+	} {
+		require.NoError(t, db.Create(&r).Error)
+	}
+	for _, v := range []model.ImageVariant{
+		{ImageName: "Old", Variant: "UHD", Format: "jpg", StorageKey: "Old/Old_UHD.jpg"},
+		{ImageName: "Shared", Variant: "UHD", Format: "jpg", StorageKey: "Shared/Shared_UHD.jpg"},
+		{ImageName: "Shared", Variant: "640x480", Format: "webp", StorageKey: "Shared/Shared_640x480.webp"},
+		{ImageName: "Missing", Variant: "UHD", Format: "jpg", StorageKey: "Missing/Missing_UHD.jpg"},
+	} {
+		require.NoError(t, db.Create(&v).Error)
+		if v.ImageName == "Missing" {
+			continue
+		}
+		_, err := s.Put(ctx, v.StorageKey, strings.NewReader("data:"+v.StorageKey), "image/jpeg")
+		require.NoError(t, err)
+	}
+}
+
+func TestExportZip(t *testing.T) {
+	setupTestData(t)
+
+	var buf bytes.Buffer
+	stats, err := Export(context.Background(), ExportOptions{From: "2026-01-25"}, &buf)
+	require.NoError(t, err)
+	assert.Equal(t, ExportStats{Images: 3, Files: 2, Skipped: 1}, stats)
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	require.NoError(t, err)
+	var names []string
+	files := make(map[string]string)
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		require.NoError(t, err)
+		data, _ := io.ReadAll(rc)
+		rc.Close()
+		names = append(names, f.Name)
+		files[f.Name] = string(data)
+	}
+	// 清单位于开头，共享图片只写入一次
+	assert.Equal(t, []string{ManifestJSON, ManifestCSV, "images/Shared/Shared_UHD.jpg", "images/Shared/Shared_640x480.webp"}, names)
+	assert.Equal(t, "data:Shared/Shared_UHD.jpg", files["images/Shared/Shared_UHD.jpg"])
+
+	var m Manifest
+	require.NoError(t, json.Unmarshal([]byte(files[ManifestJSON]), &m))
+	require.Len(t, m.Images, 3)
+	assert.Equal(t, "en-US", m.Images[0].Mkt)
+	assert.Equal(t, "Missing", m.Images[2].ImageName)
+	require.Len(t, m.Images[1].Variants, 2)
+
+	rows, err := csv.NewReader(strings.NewReader(files[ManifestCSV])).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, rows, 6)
+	assert.Equal(t, csvHeader, rows[0])
+	assert.Equal(t, "Shared, \"quoted\"", rows[3][3])
+}
+
+func TestExportTarGzFiltered(t *testing.T) {
+	setupTestData(t)
+
+	var buf bytes.Buffer
+	stats, err := Export(context.Background(), ExportOptions{Mkt: "zh-CN", To: "2026-01-25", Variants: []string{"UHD"}, Archive: "tgz"}, &buf)
+	require.NoError(t, err)
+	assert.Equal(t, ExportStats{Images: 2, Files: 2}, stats)
+
+	gz, err := gzip.NewReader(&buf)
+	require.NoError(t, err)
+	tr := tar.NewReader(gz)
+	var names []string
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		names = append(names, h.Name)
+	}
+	assert.Equal(t, []string{ManifestJSON, ManifestCSV, "images/Old/Old_UHD.jpg", "images/Shared/Shared_UHD.jpg"}, names)
+}
+
+func TestExportOptionsNormalize(t *testing.T) {
+	o := ExportOptions{Mkt: "zh-CN", From: "2026-01-01"}
+	require.NoError(t, o.Normalize())
+	assert.Equal(t, FormatZip, o.Archive)
+	assert.Equal(t, "bingpaper-zh-CN-2026-01-01.zip", o.Filename())
+
+	assert.ErrorIs(t, (&ExportOptions{Archive: "rar"}).Normalize(), ErrInvalidOptions)
+	assert.ErrorIs(t, (&ExportOptions{From: "20260101"}).Normalize(), ErrInvalidOptions)
+	assert.Equal(t, []string{"UHD", "1920x1080"}, SplitList(" UHD,,1920x1080,UHD"))
+}
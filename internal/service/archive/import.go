@@ -0,0 +1,405 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"BingPaper/internal/config"
+	"BingPaper/internal/model"
+	"BingPaper/internal/service/fetcher"
+	"BingPaper/internal/service/job"
+	"BingPaper/internal/util"
+
+	"go.uber.org/zap"
+)
+
+// ImportOptions 导入参数
+type ImportOptions struct {
+	Mkt   string // 元数据中没有地区时使用的地区，默认使用 default_region
+	Force bool   // 覆盖已存在的同日同地区记录
+}
+
+// ImportStats 导入结果统计
+type ImportStats struct {
+	Images   int `json:"images"`   // 识别出的图片条目数
+	Imported int `json:"imported"` // 成功入库
+	Skipped  int `json:"skipped"`  // 已存在或缺少日期而跳过
+	Failed   int `json:"failed"`
+}
+
+// importEntry 导入的元数据条目，兼容 Bing 接口返回的图片对象以及导出清单中的条目
+type importEntry struct {
+	fetcher.BingImage
+	Date      string            `json:"date"`
+	Mkt       string            `json:"mkt"`
+	Source    string            `json:"source"` // 图片源，为空表示 bing
+	ImageName string            `json:"image_name"`
+	Variants  []ManifestVariant `json:"variants"` // 导出清单中的变体，按 path 定位归档内的文件
+
+	file string // 对应的原图文件
+}
+
+// imageFile 目录中的候选原图文件
+type imageFile struct {
+	path    string
+	name    string // 图片名称，与 ExtractImageName 的结果一致
+	urlBase string // 由文件名还原的 urlbase
+	date    string // 文件名中的日期前缀 (YYYY-MM-DD)，可能为空
+	rank    int64  // 分辨率越高越优先
+	jpeg    bool
+}
+
+var (
+	datePrefixPattern = regexp.MustCompile(`^(\d{4})-?(\d{2})-?(\d{2})[_\-. ]+(.+)$`)
+	resolutionPattern = regexp.MustCompile(`^(\d+)x(\d+)$`)
+)
+
+// parseImageFile 解析原图文件名，支持 OHR.Name_ROW123_UHD.jpg、Name_1920x1080.jpg
+// 以及带日期前缀的 2024-01-15_OHR.Name_EN-US123_UHD.jpg 等常见命名
+func parseImageFile(p string) (imageFile, bool) {
+	base := filepath.Base(p)
+	ext := strings.ToLower(filepath.Ext(base))
+	if ext != ".jpg" && ext != ".jpeg" && ext != ".png" {
+		return imageFile{}, false
+	}
+	stem := strings.TrimSuffix(base, filepath.Ext(base))
+
+	f := imageFile{path: p, jpeg: ext != ".png"}
+	if m := datePrefixPattern.FindStringSubmatch(stem); m != nil {
+		date := fmt.Sprintf("%s-%s-%s", m[1], m[2], m[3])
+		if _, err := time.Parse("2006-01-02", date); err == nil {
+			f.date = date
+			stem = m[4]
+		}
+	}
+
+	// 去掉末尾的分辨率后缀
+	if idx := strings.LastIndex(stem, "_"); idx != -1 {
+		suffix := stem[idx+1:]
+		if suffix == "UHD" {
+			f.rank = 1 << 40
+			stem = stem[:idx]
+		} else if m := resolutionPattern.FindStringSubmatch(suffix); m != nil {
+			w, _ := strconv.ParseInt(m[1], 10, 64)
+			h, _ := strconv.ParseInt(m[2], 10, 64)
+			f.rank = w * h
+			stem = stem[:idx]
+		}
+	}
+
+	f.name = fetcher.ExtractImageName(stem, "")
+	if f.name == "" {
+		return imageFile{}, false
+	}
+	f.urlBase = "/th?id=" + stem
+	return f, true
+}
+
+// better 判断 a 是否比 b 更适合作为原图
+func (a imageFile) better(b imageFile) bool {
+	if a.rank != b.rank {
+		return a.rank > b.rank
+	}
+	return a.jpeg && !b.jpeg
+}
+
+// parseMetadata 解析元数据文件，支持 {"images": [...]}、图片对象数组以及单个图片对象
+func parseMetadata(data []byte) []importEntry {
+	var doc struct {
+		Images []importEntry `json:"images"`
+	}
+	if err := json.Unmarshal(data, &doc); err == nil && len(doc.Images) > 0 {
+		return doc.Images
+	}
+	var list []importEntry
+	if err := json.Unmarshal(data, &list); err == nil {
+		return list
+	}
+	var single importEntry
+	if err := json.Unmarshal(data, &single); err == nil && (single.URLBase != "" || single.ImageName != "") {
+		return []importEntry{single}
+	}
+	return nil
+}
+
+// manifestFile 按清单变体的 path 在 dir 中定位原图文件，选择规则与 fetcher.SourceVariant 一致；
+// 没有可用文件时返回空。内容寻址布局导出的文件名不含图片名称，只能通过 path 关联。
+func manifestFile(dir string, variants []ManifestVariant) string {
+	root := filepath.Clean(dir) + string(os.PathSeparator)
+	candidates := make([]model.ImageVariant, 0, len(variants))
+	for _, v := range variants {
+		if v.Path == "" {
+			continue
+		}
+		p := filepath.Join(dir, filepath.FromSlash(v.Path))
+		if !strings.HasPrefix(p, root) {
+			continue
+		}
+		if info, err := os.Stat(p); err != nil || info.IsDir() {
+			continue
+		}
+		candidates = append(candidates, model.ImageVariant{Variant: v.Variant, Format: v.Format, Size: v.Size, Spec: v.Spec, StorageKey: p})
+	}
+	if src := fetcher.SourceVariant(candidates); src != nil {
+		return src.StorageKey
+	}
+	return ""
+}
+
+// normalize 补全条目的日期、图片名称与 urlbase，缺少日期时返回 false
+func (e *importEntry) normalize() bool {
+	if e.Date == "" && len(e.Enddate) == 8 {
+		e.Date = fmt.Sprintf("%s-%s-%s", e.Enddate[0:4], e.Enddate[4:6], e.Enddate[6:8])
+	}
+	if _, err := time.Parse("2006-01-02", e.Date); err != nil {
+		return false
+	}
+	e.Enddate = strings.ReplaceAll(e.Date, "-", "")
+
+	if e.URLBase == "" && e.ImageName != "" {
+		e.URLBase = "/th?id=OHR." + e.ImageName
+	}
+	// 入库时图片名称由 urlbase 推导，这里保持一致以便关联原图文件
+	e.ImageName = fetcher.ExtractImageName(e.URLBase, e.HSH)
+	return e.ImageName != ""
+}
+
+// ImportPath 导入目录或归档文件（zip / tar.gz）中的图片
+func ImportPath(ctx context.Context, path string, opts ImportOptions) (ImportStats, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return ImportStats{}, err
+	}
+	if info.IsDir() {
+		return ImportDir(ctx, path, opts)
+	}
+
+	dir, err := os.MkdirTemp("", "bingpaper-import-*")
+	if err != nil {
+		return ImportStats{}, err
+	}
+	defer os.RemoveAll(dir)
+
+	if err := ExtractArchive(path, dir); err != nil {
+		return ImportStats{}, err
+	}
+	return ImportDir(ctx, dir, opts)
+}
+
+// ImportDir 导入目录中的图片。
+// 目录中的 .json 文件作为元数据，按图片名称与原图文件关联；没有元数据的原图文件
+// 需要在文件名中带有日期前缀才能导入。同一图片存在多个分辨率时使用分辨率最高的文件。
+func ImportDir(ctx context.Context, dir string, opts ImportOptions) (ImportStats, error) {
+	var stats ImportStats
+	h := job.FromContext(ctx)
+
+	defaultMkt := opts.Mkt
+	if defaultMkt == "" {
+		defaultMkt = config.GetConfig().GetDefaultRegion()
+	}
+
+	files := make(map[string]imageFile)
+	var entries []importEntry
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		if strings.EqualFold(filepath.Ext(p), ".json") {
+			data, err := os.ReadFile(p)
+			if err != nil {
+				return err
+			}
+			parsed := parseMetadata(data)
+			if parsed == nil {
+				util.Logger.Warn("Ignoring unrecognized metadata file", zap.String("path", p))
+			}
+			entries = append(entries, parsed...)
+			return nil
+		}
+		if f, ok := parseImageFile(p); ok {
+			if cur, exists := files[f.name]; !exists || f.better(cur) {
+				files[f.name] = f
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return stats, err
+	}
+
+	// 关联元数据与原图文件：优先使用清单中记录的路径，其次按文件名中的图片名称匹配
+	var valid []importEntry
+	described := make(map[string]bool)
+	referenced := make(map[string]bool) // 清单中引用的文件
+	for _, e := range entries {
+		if !e.normalize() {
+			util.Logger.Warn("Skipping metadata entry without date or image name", zap.String("urlbase", e.URLBase))
+			stats.Skipped++
+			continue
+		}
+		described[e.ImageName] = true
+		for _, v := range e.Variants {
+			if v.Path != "" {
+				referenced[filepath.Join(dir, filepath.FromSlash(v.Path))] = true
+			}
+		}
+		if p := manifestFile(dir, e.Variants); p != "" {
+			e.file = p
+		} else if f, ok := files[e.ImageName]; ok {
+			e.file = f.path
+		}
+		valid = append(valid, e)
+	}
+
+	// 没有元数据的原图文件，仅凭文件名中的日期导入
+	var names []string
+	for name, f := range files {
+		if !described[name] && !referenced[f.path] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		f := files[name]
+		if f.date == "" {
+			util.Logger.Warn("Skipping image without metadata or date prefix", zap.String("path", f.path))
+			stats.Skipped++
+			continue
+		}
+		e := importEntry{Date: f.date, ImageName: f.name, file: f.path}
+		e.URLBase = f.urlBase
+		e.normalize()
+		valid = append(valid, e)
+	}
+
+	stats.Images = len(valid)
+	h.SetTotal(len(valid))
+	h.Logf("Importing %d images from %s", len(valid), dir)
+
+	fe := fetcher.NewFetcher()
+	var errs []error
+	for _, e := range valid {
+		if err := ctx.Err(); err != nil {
+			return stats, err
+		}
+
+		imported, err := importEntryImage(ctx, fe, e, defaultMkt, opts.Force)
+		switch {
+		case err != nil:
+			stats.Failed++
+			h.Logf("%s %s (%s): %v", e.Date, e.Mkt, e.ImageName, err)
+			util.Logger.Error("Failed to import image", zap.String("date", e.Date), zap.String("image_name", e.ImageName), zap.Error(err))
+			errs = append(errs, fmt.Errorf("%s %s: %w", e.Date, e.ImageName, err))
+		case imported:
+			stats.Imported++
+		default:
+			stats.Skipped++
+		}
+		h.Advance(1)
+	}
+
+	util.Logger.Info("Import completed",
+		zap.Int("images", stats.Images),
+		zap.Int("imported", stats.Imported),
+		zap.Int("skipped", stats.Skipped),
+		zap.Int("failed", stats.Failed))
+	return stats, errors.Join(errs...)
+}
+
+func importEntryImage(ctx context.Context, fe *fetcher.Fetcher, e importEntry, defaultMkt string, force bool) (bool, error) {
+	mkt := e.Mkt
+	if mkt == "" {
+		mkt = defaultMkt
+	}
+	if !util.IsValidRegion(mkt) {
+		return false, fmt.Errorf("invalid region %q", mkt)
+	}
+
+	return fe.ImportImage(ctx, e.Source, e.BingImage, mkt, force, func() ([]byte, error) {
+		if e.file == "" {
+			return nil, errors.New("image file not found")
+		}
+		return os.ReadFile(e.file)
+	})
+}
+
+// ExtractArchive 将 zip 或 tar.gz 归档解压到 dst，会拒绝指向 dst 之外的路径
+func ExtractArchive(src, dst string) error {
+	if zr, err := zip.OpenReader(src); err == nil {
+		defer zr.Close()
+		for _, f := range zr.File {
+			if f.FileInfo().IsDir() {
+				continue
+			}
+			rc, err := f.Open()
+			if err != nil {
+				return err
+			}
+			err = extractFile(dst, f.Name, rc)
+			rc.Close()
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	file, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		return errors.New("unsupported archive: expected zip or tar.gz")
+	}
+	defer gz.Close()
+
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		if err := extractFile(dst, hdr.Name, tr); err != nil {
+			return err
+		}
+	}
+}
+
+func extractFile(dst, name string, r io.Reader) error {
+	target := filepath.Join(dst, filepath.FromSlash(name))
+	if !strings.HasPrefix(target, filepath.Clean(dst)+string(os.PathSeparator)) {
+		return fmt.Errorf("illegal path in archive: %s", name)
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	out, err := os.Create(target)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	_, err = io.Copy(out, r)
+	return err
+}
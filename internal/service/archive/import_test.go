@@ -0,0 +1,192 @@
+package archive
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"BingPaper/internal/config"
+	"BingPaper/internal/model"
+	"BingPaper/internal/repo"
+	"BingPaper/internal/service/fetcher"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testJPEG(t *testing.T, w, h int) []byte {
+	t.Helper()
+
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for x := 0; x < w; x++ {
+		for y := 0; y < h; y++ {
+			img.Set(x, y, color.RGBA{R: uint8(x), G: uint8(y), B: 64, A: 255})
+		}
+	}
+	buf := new(bytes.Buffer)
+	require.NoError(t, jpeg.Encode(buf, img, &jpeg.Options{Quality: 90}))
+	return buf.Bytes()
+}
+
+func writeFile(t *testing.T, path string, data []byte) {
+	t.Helper()
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+	require.NoError(t, os.WriteFile(path, data, 0644))
+}
+
+// setupImportConfig 使用最小的变体矩阵，避免测试中生成大尺寸图片
+func setupImportConfig(t *testing.T) {
+	t.Helper()
+	require.NoError(t, config.Init(""))
+	config.GetConfig().Fetcher.Formats = []string{"jpg"}
+	config.GetConfig().Fetcher.Variants = []config.VariantConfig{{Name: "32x18", Width: 32, Height: 18}}
+}
+
+func TestParseImageFile(t *testing.T) {
+	f, ok := parseImageFile("x/OHR.MilwaukeeHall_ROW0871854348_UHD.jpg")
+	require.True(t, ok)
+	assert.Equal(t, "MilwaukeeHall", f.name)
+	assert.Equal(t, "/th?id=OHR.MilwaukeeHall_ROW0871854348", f.urlBase)
+	assert.Empty(t, f.date)
+
+	f, ok = parseImageFile("2024-01-15_OHR.Beta_EN-US999_1920x1080.jpeg")
+	require.True(t, ok)
+	assert.Equal(t, "Beta", f.name)
+	assert.Equal(t, "2024-01-15", f.date)
+	assert.Equal(t, int64(1920*1080), f.rank)
+
+	f, ok = parseImageFile("images/Gamma/Gamma_UHD.jpg")
+	require.True(t, ok)
+	assert.Equal(t, "Gamma", f.name)
+
+	_, ok = parseImageFile("OHR.Delta_ROW1_UHD.webp")
+	assert.False(t, ok)
+}
+
+func TestImportDir(t *testing.T) {
+	setupTestData(t)
+	setupImportConfig(t)
+	ctx := context.Background()
+
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "meta", "20240115.json"), []byte(`{"images":[{"enddate":"20240115","urlbase":"/th?id=OHR.Alpha_ZH-CN123","title":"Alpha","hsh":"h1"}]}`))
+	writeFile(t, filepath.Join(dir, "OHR.Alpha_ZH-CN123_1920x1080.jpg"), testJPEG(t, 64, 36))
+	writeFile(t, filepath.Join(dir, "OHR.Alpha_ZH-CN123_UHD.jpg"), testJPEG(t, 80, 45))
+	writeFile(t, filepath.Join(dir, "2024-01-16_OHR.Beta_EN-US999_UHD.jpg"), testJPEG(t, 64, 36))
+	writeFile(t, filepath.Join(dir, "OHR.Gamma_ROW1_UHD.jpg"), testJPEG(t, 64, 36))
+
+	stats, err := ImportDir(ctx, dir, ImportOptions{Mkt: "en-US"})
+	require.NoError(t, err)
+	assert.Equal(t, ImportStats{Images: 2, Imported: 2, Skipped: 1}, stats)
+
+	var alpha model.ImageRegion
+	require.NoError(t, repo.DB.Preload("Variants").Where("date = ? AND mkt = ?", "2024-01-15", "en-US").First(&alpha).Error)
+	assert.Equal(t, "Alpha", alpha.ImageName)
+	assert.Equal(t, "Alpha", alpha.Title)
+	assert.Equal(t, "/th?id=OHR.Alpha_ZH-CN123", alpha.URLBase)
+
+	// 使用分辨率最高的文件作为原图，并按配置生成变体矩阵
+	source := fetcher.SourceVariant(alpha.Variants)
+	require.NotNil(t, source)
+	assert.Equal(t, "80x45", source.Variant)
+	assert.Equal(t, "jpg", source.Format)
+	assert.Len(t, alpha.Variants, 2)
+
+	var beta model.ImageRegion
+	require.NoError(t, repo.DB.Where("date = ? AND mkt = ?", "2024-01-16", "en-US").First(&beta).Error)
+	assert.Equal(t, "Beta", beta.ImageName)
+	assert.Equal(t, "/th?id=OHR.Beta_EN-US999", beta.URLBase)
+
+	// 重复导入时已存在的记录被跳过
+	stats, err = ImportDir(ctx, dir, ImportOptions{Mkt: "en-US"})
+	require.NoError(t, err)
+	assert.Equal(t, ImportStats{Images: 2, Skipped: 3}, stats)
+}
+
+func TestExportImportRoundTrip(t *testing.T) {
+	setupTestData(t)
+	setupImportConfig(t)
+	ctx := context.Background()
+
+	src := filepath.Join(t.TempDir(), "src")
+	writeFile(t, filepath.Join(src, "2024-02-01_OHR.Round_ROW1_UHD.jpg"), testJPEG(t, 64, 36))
+	_, err := ImportDir(ctx, src, ImportOptions{Mkt: "ja-JP"})
+	require.NoError(t, err)
+
+	out := filepath.Join(t.TempDir(), "export.zip")
+	f, err := os.Create(out)
+	require.NoError(t, err)
+	_, err = Export(ctx, ExportOptions{Mkt: "ja-JP"}, f)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	require.NoError(t, repo.DB.Unscoped().Where("mkt = ?", "ja-JP").Delete(&model.ImageRegion{}).Error)
+
+	stats, err := ImportPath(ctx, out, ImportOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, ImportStats{Images: 1, Imported: 1}, stats)
+
+	var region model.ImageRegion
+	require.NoError(t, repo.DB.Where("date = ? AND mkt = ?", "2024-02-01", "ja-JP").First(&region).Error)
+	assert.Equal(t, "Round", region.ImageName)
+}
+
+func TestExportImportContentLayout(t *testing.T) {
+	setupTestData(t)
+	setupImportConfig(t)
+	config.GetConfig().Storage.Layout = config.StorageLayoutContent
+	ctx := context.Background()
+
+	src := filepath.Join(t.TempDir(), "src")
+	writeFile(t, filepath.Join(src, "2024-02-02_OHR.Hashed_ROW1_UHD.jpg"), testJPEG(t, 64, 36))
+	_, err := ImportDir(ctx, src, ImportOptions{Mkt: "ja-JP"})
+	require.NoError(t, err)
+
+	var variants []model.ImageVariant
+	require.NoError(t, repo.DB.Where("image_name = ?", "Hashed").Find(&variants).Error)
+	require.NotEmpty(t, variants)
+	for _, v := range variants {
+		require.True(t, fetcher.IsContentKey(v.StorageKey), v.StorageKey)
+	}
+
+	out := filepath.Join(t.TempDir(), "export.tar.gz")
+	f, err := os.Create(out)
+	require.NoError(t, err)
+	_, err = Export(ctx, ExportOptions{Mkt: "ja-JP", Archive: FormatTarGz}, f)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	require.NoError(t, repo.DB.Unscoped().Where("mkt = ?", "ja-JP").Delete(&model.ImageRegion{}).Error)
+	require.NoError(t, repo.DB.Where("image_name = ?", "Hashed").Delete(&model.ImageVariant{}).Error)
+
+	// 归档内的文件名只有哈希，需要按清单中的 path 找到原图
+	stats, err := ImportPath(ctx, out, ImportOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, ImportStats{Images: 1, Imported: 1}, stats)
+
+	var region model.ImageRegion
+	require.NoError(t, repo.DB.Preload("Variants").Where("date = ? AND mkt = ?", "2024-02-02", "ja-JP").First(&region).Error)
+	assert.Equal(t, "Hashed", region.ImageName)
+	source := fetcher.SourceVariant(region.Variants)
+	require.NotNil(t, source)
+	assert.Equal(t, "64x36", source.Variant)
+}
+
+func TestExtractArchiveRejectsTraversal(t *testing.T) {
+	buf := new(bytes.Buffer)
+	zw := zip.NewWriter(buf)
+	w, err := zw.Create("../evil.json")
+	require.NoError(t, err)
+	_, _ = w.Write([]byte("{}"))
+	require.NoError(t, zw.Close())
+
+	src := filepath.Join(t.TempDir(), "evil.zip")
+	require.NoError(t, os.WriteFile(src, buf.Bytes(), 0644))
+	assert.ErrorContains(t, ExtractArchive(src, t.TempDir()), "illegal path")
+}
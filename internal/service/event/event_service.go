@@ -0,0 +1,95 @@
+package event
+
+import (
+	"sync"
+
+	"BingPaper/internal/model"
+	"BingPaper/internal/util"
+
+	"go.uber.org/zap"
+)
+
+const (
+	TypeImageCreated  = "image.created"  // 新增了某地区某日的图片
+	TypeImageReplaced = "image.replaced" // 强制刷新覆盖了已有的图片记录
+)
+
+// subscriberBuffer 每个订阅者的缓冲事件数，消费过慢时新事件会被丢弃
+const subscriberBuffer = 16
+
+// Event 图片更新事件
+type Event struct {
+	Type  string
+	Image *model.ImageRegion // 已预加载 Variants
+}
+
+type subscriber struct {
+	ch  chan Event
+	mkt string
+}
+
+var (
+	mu          sync.RWMutex
+	subscribers = map[*subscriber]struct{}{}
+	closed      bool // 服务正在关闭，不再接受新的订阅
+)
+
+// Subscribe 订阅图片更新事件，mkt 非空时仅接收该地区的事件。
+// 返回的取消函数必须在不再消费时调用。服务关闭时返回的通道会被关闭。
+func Subscribe(mkt string) (<-chan Event, func()) {
+	s := &subscriber{ch: make(chan Event, subscriberBuffer), mkt: mkt}
+
+	mu.Lock()
+	if closed {
+		close(s.ch)
+	} else {
+		subscribers[s] = struct{}{}
+	}
+	mu.Unlock()
+
+	var once sync.Once
+	return s.ch, func() {
+		once.Do(func() {
+			mu.Lock()
+			delete(subscribers, s)
+			mu.Unlock()
+		})
+	}
+}
+
+// Close 关闭所有订阅者的事件通道，之后的订阅会立即得到已关闭的通道。
+// 应在 HTTP 服务关闭时调用，使长连接的订阅者及时退出。
+func Close() {
+	mu.Lock()
+	defer mu.Unlock()
+
+	closed = true
+	for s := range subscribers {
+		close(s.ch)
+		delete(subscribers, s)
+	}
+}
+
+// Publish 向所有匹配的订阅者广播事件，不会阻塞调用方
+func Publish(e Event) {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	for s := range subscribers {
+		if s.mkt != "" && e.Image != nil && s.mkt != e.Image.Mkt {
+			continue
+		}
+		select {
+		case s.ch <- e:
+		default:
+			util.Logger.Warn("Event subscriber is too slow, dropping event", zap.String("type", e.Type))
+		}
+	}
+}
+
+// SubscriberCount 返回当前订阅者数量
+func SubscriberCount() int {
+	mu.RLock()
+	defer mu.RUnlock()
+	return len(subscribers)
+}
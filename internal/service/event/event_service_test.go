@@ -0,0 +1,38 @@
+package event
+
+import (
+	"testing"
+
+	"BingPaper/internal/model"
+	"BingPaper/internal/util"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestClose(t *testing.T) {
+	util.Logger = zap.NewNop()
+	t.Cleanup(func() {
+		mu.Lock()
+		closed = false
+		mu.Unlock()
+	})
+
+	events, cancel := Subscribe("zh-CN")
+	defer cancel()
+	assert.Equal(t, 1, SubscriberCount())
+
+	Close()
+	_, ok := <-events
+	assert.False(t, ok)
+	assert.Zero(t, SubscriberCount())
+
+	// 关闭后发布事件不会 panic，新的订阅立即结束
+	assert.NotPanics(t, func() {
+		Publish(Event{Type: TypeImageCreated, Image: &model.ImageRegion{Mkt: "zh-CN"}})
+	})
+	late, cancelLate := Subscribe("")
+	defer cancelLate()
+	_, ok = <-late
+	assert.False(t, ok)
+}
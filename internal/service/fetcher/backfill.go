@@ -0,0 +1,264 @@
+package fetcher
+
+import (
+	"context"
+	"errors"
+	"image"
+	"time"
+
+	"BingPaper/internal/config"
+	"BingPaper/internal/model"
+	"BingPaper/internal/repo"
+	"BingPaper/internal/service/job"
+	"BingPaper/internal/storage"
+	"BingPaper/internal/util"
+
+	"go.uber.org/zap"
+)
+
+// ErrBackfillRunning 表示已有补齐任务在运行
+var ErrBackfillRunning = errors.New("variant backfill is already running")
+
+const (
+	BackfillIdle      = "idle"
+	BackfillRunning   = "running"
+	BackfillCompleted = "completed"
+	BackfillFailed    = "failed"
+)
+
+// BackfillOptions 变体补齐任务参数
+type BackfillOptions struct {
+	Force         bool `json:"force"`          // 无视参数指纹，重新生成全部变体
+	VerifyStorage bool `json:"verify_storage"` // 检查存储对象是否仍然存在，丢失的变体将被重新生成
+}
+
+// BackfillProgress 变体补齐任务进度
+type BackfillProgress struct {
+	State        string          `json:"state"`
+	Options      BackfillOptions `json:"options"`
+	Total        int             `json:"total"`     // 需要处理的图片数
+	Processed    int             `json:"processed"` // 已处理的图片数
+	Created      int             `json:"created"`   // 新生成的变体数
+	Updated      int             `json:"updated"`   // 因过期或丢失而重新生成的变体数
+	Failed       int             `json:"failed"`    // 处理失败的图片数
+	CurrentImage string          `json:"current_image"`
+	LastError    string          `json:"last_error,omitempty"`
+	StartedAt    *time.Time      `json:"started_at,omitempty"`
+	FinishedAt   *time.Time      `json:"finished_at,omitempty"`
+}
+
+// GetBackfillProgress 返回当前（或最近一次）补齐任务的进度，进度保存在补齐任务的结果中
+func GetBackfillProgress() (BackfillProgress, error) {
+	var p BackfillProgress
+	j, err := job.Latest(job.TypeVariantBackfill, &p)
+	if err != nil || j == nil {
+		return BackfillProgress{State: BackfillIdle}, err
+	}
+	switch j.State {
+	case job.StateSucceeded:
+		p.State = BackfillCompleted
+	case job.StateFailed:
+		p.State = BackfillFailed
+		p.LastError = j.Error
+	default:
+		p.State = BackfillRunning
+	}
+	if p.State != BackfillRunning {
+		p.CurrentImage = ""
+	}
+	p.StartedAt = j.StartedAt
+	p.FinishedAt = j.FinishedAt
+	return p, nil
+}
+
+// StartBackfill 在后台启动变体补齐任务，已有任务运行时返回 ErrBackfillRunning
+func (f *Fetcher) StartBackfill(opts BackfillOptions) error {
+	_, err := job.SubmitExclusive(job.TypeVariantBackfill, opts, func(ctx context.Context) error {
+		_, err := f.Backfill(ctx, opts)
+		return err
+	})
+	if errors.Is(err, job.ErrAlreadyRunning) {
+		return ErrBackfillRunning
+	}
+	return err
+}
+
+// Backfill 遍历所有图片，从已存储的原图重新生成缺失或过期的变体。
+// 与 ManualFetch 不同，该过程不会访问 Bing，因此可以修复超出 Bing 回溯窗口的历史图片。
+// 在任务中运行时，进度会同步写入任务结果。
+func (f *Fetcher) Backfill(ctx context.Context, opts BackfillOptions) (BackfillProgress, error) {
+	p := BackfillProgress{State: BackfillRunning, Options: opts}
+	var imageNames []string
+	if err := repo.DB.Model(&model.ImageRegion{}).Distinct().Order("image_name").Pluck("image_name", &imageNames).Error; err != nil {
+		return p, err
+	}
+
+	util.Logger.Info("Starting variant backfill",
+		zap.Int("images", len(imageNames)),
+		zap.Bool("force", opts.Force),
+		zap.Bool("verify_storage", opts.VerifyStorage))
+	p.Total = len(imageNames)
+	h := job.FromContext(ctx)
+	h.SetTotal(len(imageNames))
+
+	for _, name := range imageNames {
+		if err := ctx.Err(); err != nil {
+			return p, err
+		}
+		p.CurrentImage = name
+		h.SetResult(p)
+
+		created, updated, err := f.RepairVariants(ctx, name, opts)
+		p.Processed++
+		p.Created += created
+		p.Updated += updated
+		if err != nil {
+			p.Failed++
+			p.LastError = name + ": " + err.Error()
+		}
+		h.Advance(1)
+		if err != nil {
+			util.Logger.Error("Failed to backfill variants", zap.String("image_name", name), zap.Error(err))
+			h.Logf("[%s] failed: %v", name, err)
+			continue
+		}
+		if created+updated > 0 {
+			h.Logf("[%s] created=%d updated=%d", name, created, updated)
+			util.Logger.Info("Backfilled variants",
+				zap.String("image_name", name),
+				zap.Int("created", created),
+				zap.Int("updated", updated))
+		}
+	}
+
+	p.CurrentImage = ""
+	h.SetResult(p)
+	util.Logger.Info("Variant backfill completed",
+		zap.Int("images", p.Processed),
+		zap.Int("created", p.Created),
+		zap.Int("updated", p.Updated),
+		zap.Int("failed", p.Failed))
+	return p, nil
+}
+
+// RepairVariants 按当前变体矩阵修复单张图片的变体：
+// 缺失的记录会被创建，参数指纹不一致（或 Force）以及存储对象丢失的变体会被重新生成，作为来源的原图不会被重新生成。
+func (f *Fetcher) RepairVariants(ctx context.Context, imageName string, opts BackfillOptions) (created, updated int, err error) {
+	var existing []model.ImageVariant
+	if err := repo.DB.Where("image_name = ?", imageName).Find(&existing).Error; err != nil {
+		return 0, 0, err
+	}
+
+	original := SourceVariant(existing)
+	if original == nil {
+		return 0, 0, ErrSourceNotFound
+	}
+	// 旧版本下载的原图没有指纹，补上标记，之后不会被当作过期变体
+	if original.Spec == "" {
+		if err := repo.DB.Model(&model.ImageVariant{}).Where("id = ?", original.ID).Update("spec", originalSpec).Error; err != nil {
+			return 0, 0, err
+		}
+		original.Spec = originalSpec
+	}
+
+	rows := make(map[string]*model.ImageVariant, len(existing))
+	for i := range existing {
+		rows[existing[i].Variant+"."+existing[i].Format] = &existing[i]
+	}
+
+	var srcImg image.Image
+	loadSource := func() error {
+		if srcImg != nil {
+			return nil
+		}
+		var err error
+		srcImg, _, err = LoadSourceImage(ctx, existing)
+		return err
+	}
+
+	// needsWork 判断变体是否需要生成，返回 (需要生成, 是否为覆盖已有记录)
+	needsWork := func(name, format, spec string) (bool, bool) {
+		row, ok := rows[name+"."+format]
+		if !ok {
+			return true, false
+		}
+		// 原图是其他变体的来源，任何情况下都不重新生成
+		if row.ID == original.ID {
+			return false, false
+		}
+		// 没有指纹的旧记录按旧版本的生成参数比较，无法推算时视为过期
+		if opts.Force || effectiveSpec(row) != spec {
+			return true, true
+		}
+		if opts.VerifyStorage {
+			if exists, err := storage.GlobalStorage().Exists(ctx, row.StorageKey); err == nil && !exists {
+				util.Logger.Warn("Variant object missing from storage", zap.String("key", row.StorageKey))
+				return true, true
+			}
+		}
+		return false, false
+	}
+
+	generate := func(name string, render func() image.Image, formats []string, quality int, spec string) error {
+		var rendered image.Image
+		for _, format := range formats {
+			work, overwrite := needsWork(name, format, spec)
+			if !work {
+				continue
+			}
+			if err := loadSource(); err != nil {
+				return err
+			}
+			if rendered == nil {
+				rendered = render()
+			}
+			data, err := EncodeImage(ctx, rendered, format, quality)
+			if err != nil {
+				util.Logger.Warn("Failed to encode variant",
+					zap.String("image_name", imageName),
+					zap.String("variant", name),
+					zap.String("format", format),
+					zap.Error(err))
+				continue
+			}
+			if err := f.saveVariant(ctx, imageName, name, format, data, spec, overwrite); err != nil {
+				return err
+			}
+			if overwrite {
+				updated++
+			} else {
+				created++
+			}
+		}
+		return nil
+	}
+
+	if opts.VerifyStorage {
+		if exists, err := storage.GlobalStorage().Exists(ctx, original.StorageKey); err == nil && !exists {
+			return 0, 0, ErrSourceNotFound
+		}
+	}
+
+	// 原图的其他格式（原图本身的 jpg 不会被重新编码）
+	var originalFormats []string
+	for _, format := range EnabledFormats() {
+		if format != original.Format {
+			originalFormats = append(originalFormats, format)
+		}
+	}
+	if err := generate(original.Variant, func() image.Image { return srcImg }, originalFormats, DefaultQuality, originalSpec); err != nil {
+		return created, updated, err
+	}
+
+	for _, v := range config.GetConfig().GetVariants() {
+		if v.Name == original.Variant {
+			continue
+		}
+		v := v
+		if err := generate(v.Name, func() image.Image { return renderVariant(srcImg, v) }, variantFormats(v), variantQuality(v), variantSpec(v)); err != nil {
+			return created, updated, err
+		}
+	}
+
+	return created, updated, nil
+}
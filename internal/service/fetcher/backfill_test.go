@@ -0,0 +1,219 @@
+package fetcher
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"io"
+	"testing"
+	"time"
+
+	"BingPaper/internal/config"
+	"BingPaper/internal/model"
+	"BingPaper/internal/repo"
+	"BingPaper/internal/storage"
+	"BingPaper/internal/storage/local"
+	"BingPaper/internal/util"
+
+	"github.com/glebarez/sqlite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// setupTestEnv 初始化内存数据库、临时本地存储和默认配置
+func setupTestEnv(t *testing.T) {
+	t.Helper()
+
+	require.NoError(t, config.Init(""))
+	util.Logger = zap.NewNop()
+
+	db, err := gorm.Open(sqlite.Open(fmt.Sprintf("file:%s?mode=memory&cache=shared", t.Name())), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, repo.AutoMigrateModels(db))
+	repo.DB = db
+
+	s, err := local.NewLocalStorage(t.TempDir())
+	require.NoError(t, err)
+	storage.SetGlobalStorage(s)
+}
+
+func testJPEG(t *testing.T, w, h int) []byte {
+	t.Helper()
+
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for x := 0; x < w; x++ {
+		for y := 0; y < h; y++ {
+			img.Set(x, y, color.RGBA{R: uint8(x), G: uint8(y), B: 64, A: 255})
+		}
+	}
+	buf := new(bytes.Buffer)
+	require.NoError(t, jpeg.Encode(buf, img, &jpeg.Options{Quality: 90}))
+	return buf.Bytes()
+}
+
+func TestRepairVariants(t *testing.T) {
+	setupTestEnv(t)
+	ctx := context.Background()
+	f := &Fetcher{}
+
+	config.GetConfig().Fetcher.Formats = []string{"jpg"}
+	config.GetConfig().Fetcher.Variants = []config.VariantConfig{
+		{Name: "64x36", Width: 64, Height: 36},
+		{Name: "32x32", Width: 32, Height: 32, Fit: "fit"},
+	}
+
+	require.NoError(t, repo.DB.Create(&model.ImageRegion{Date: "2020-01-01", Mkt: "zh-CN", ImageName: "Old"}).Error)
+	require.NoError(t, f.saveVariant(ctx, "Old", "UHD", "jpg", testJPEG(t, 128, 72), originalSpec, false))
+
+	t.Run("creates missing variants from stored original", func(t *testing.T) {
+		created, updated, err := f.RepairVariants(ctx, "Old", BackfillOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, 2, created)
+		assert.Equal(t, 0, updated)
+
+		var v model.ImageVariant
+		require.NoError(t, repo.DB.Where("image_name = ? AND variant = ?", "Old", "32x32").First(&v).Error)
+		assert.Equal(t, "32x32/fit/center/q100", v.Spec)
+		ok, _ := storage.GlobalStorage().Exists(ctx, v.StorageKey)
+		assert.True(t, ok)
+	})
+
+	t.Run("nothing to do when up to date", func(t *testing.T) {
+		created, updated, err := f.RepairVariants(ctx, "Old", BackfillOptions{VerifyStorage: true})
+		require.NoError(t, err)
+		assert.Equal(t, 0, created+updated)
+	})
+
+	t.Run("regenerates outdated and lost variants", func(t *testing.T) {
+		config.GetConfig().Fetcher.Variants[0].Quality = 70
+		require.NoError(t, storage.GlobalStorage().Delete(ctx, f.generateKey("Old", "32x32", "jpg")))
+
+		created, updated, err := f.RepairVariants(ctx, "Old", BackfillOptions{VerifyStorage: true})
+		require.NoError(t, err)
+		assert.Equal(t, 0, created)
+		assert.Equal(t, 2, updated)
+
+		ok, _ := storage.GlobalStorage().Exists(ctx, f.generateKey("Old", "32x32", "jpg"))
+		assert.True(t, ok)
+	})
+
+	t.Run("regenerates legacy variants without spec", func(t *testing.T) {
+		require.NoError(t, repo.DB.Model(&model.ImageVariant{}).
+			Where("image_name = ? AND variant = ?", "Old", "32x32").Update("spec", "").Error)
+
+		created, updated, err := f.RepairVariants(ctx, "Old", BackfillOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, 0, created)
+		assert.Equal(t, 1, updated)
+
+		var v model.ImageVariant
+		require.NoError(t, repo.DB.Where("image_name = ? AND variant = ?", "Old", "32x32").First(&v).Error)
+		assert.Equal(t, "32x32/fit/center/q100", v.Spec)
+	})
+
+	t.Run("fails without an original", func(t *testing.T) {
+		_, _, err := f.RepairVariants(ctx, "Missing", BackfillOptions{})
+		assert.ErrorIs(t, err, ErrSourceNotFound)
+	})
+}
+
+func TestBackfillProgress(t *testing.T) {
+	setupTestEnv(t)
+	ctx := context.Background()
+	f := &Fetcher{}
+
+	config.GetConfig().Fetcher.Formats = []string{"jpg"}
+	config.GetConfig().Fetcher.Variants = []config.VariantConfig{{Name: "16x16", Width: 16, Height: 16}}
+
+	require.NoError(t, repo.DB.Create(&model.ImageRegion{Date: "2020-01-01", Mkt: "zh-CN", ImageName: "A"}).Error)
+	require.NoError(t, repo.DB.Create(&model.ImageRegion{Date: "2020-01-02", Mkt: "zh-CN", ImageName: "B"}).Error)
+	require.NoError(t, f.saveVariant(ctx, "A", "UHD", "jpg", testJPEG(t, 64, 64), originalSpec, false))
+
+	p, err := f.Backfill(ctx, BackfillOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, 2, p.Total)
+	assert.Equal(t, 2, p.Processed)
+	assert.Equal(t, 1, p.Created)
+	assert.Equal(t, 1, p.Failed)
+	assert.Contains(t, p.LastError, "B")
+
+	// 通过任务运行时，进度从任务结果中读取
+	require.NoError(t, f.StartBackfill(BackfillOptions{Force: true}))
+	require.Eventually(t, func() bool {
+		p, err = GetBackfillProgress()
+		return err == nil && p.State == BackfillCompleted
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.True(t, p.Options.Force)
+	assert.Equal(t, 2, p.Processed)
+	assert.Equal(t, 1, p.Updated)
+	assert.NotNil(t, p.FinishedAt)
+}
+
+func TestRepairVariantsKeepsDerivedVariants(t *testing.T) {
+	setupTestEnv(t)
+	ctx := context.Background()
+	f := &Fetcher{}
+
+	config.GetConfig().Fetcher.Formats = []string{"jpg"}
+	config.GetConfig().Fetcher.Variants = []config.VariantConfig{{Name: "32x18", Width: 32, Height: 18}}
+
+	require.NoError(t, repo.DB.Create(&model.ImageRegion{Date: "2020-01-01", Mkt: "zh-CN", ImageName: "Derived"}).Error)
+	require.NoError(t, f.saveVariant(ctx, "Derived", "UHD", "jpg", testJPEG(t, 64, 36), originalSpec, false))
+	// 按需缩放生成的同名变体与配置变体参数一致，不需要重新生成
+	_, err := f.SaveVariant(ctx, "Derived", "32x18", "jpg", testJPEG(t, 32, 18), DerivedSpec(32, 18, "fill"))
+	require.NoError(t, err)
+
+	created, updated, err := f.RepairVariants(ctx, "Derived", BackfillOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, 0, created+updated)
+	assert.Equal(t, "32x18/fit/center/q100", DerivedSpec(32, 18, "fit"))
+	assert.Equal(t, "800x0/resize/q100", DerivedSpec(800, 0, "fill"))
+}
+
+func TestRepairVariantsLegacyWithoutUHD(t *testing.T) {
+	setupTestEnv(t)
+	ctx := context.Background()
+	f := &Fetcher{}
+
+	config.GetConfig().Fetcher.Formats = []string{"jpg"}
+	config.GetConfig().Fetcher.Variants = []config.VariantConfig{
+		{Name: "1920x1200", Width: 1920, Height: 1200},
+		{Name: "1920x1080", Width: 1920, Height: 1080},
+		{Name: "32x18", Width: 32, Height: 18},
+	}
+
+	// 引入指纹之前的记录：没有 UHD，下载的 1920x1080 原图和由它放大生成的 1920x1200 都没有指纹
+	require.NoError(t, repo.DB.Create(&model.ImageRegion{Date: "2019-01-01", Mkt: "zh-CN", ImageName: "Legacy"}).Error)
+	original := testJPEG(t, 64, 36)
+	require.NoError(t, f.saveVariant(ctx, "Legacy", "1920x1080", "jpg", original, "", false))
+	require.NoError(t, f.saveVariant(ctx, "Legacy", "1920x1200", "jpg", testJPEG(t, 96, 60), "", false))
+
+	var existing []model.ImageVariant
+	require.NoError(t, repo.DB.Where("image_name = ?", "Legacy").Find(&existing).Error)
+	assert.Equal(t, "1920x1080", SourceVariant(existing).Variant)
+
+	created, updated, err := f.RepairVariants(ctx, "Legacy", BackfillOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, 1, created)
+	assert.Equal(t, 0, updated)
+
+	// 原图保持不变并被标记为原图
+	var v model.ImageVariant
+	require.NoError(t, repo.DB.Where("image_name = ? AND variant = ?", "Legacy", "1920x1080").First(&v).Error)
+	assert.Equal(t, originalSpec, v.Spec)
+	reader, _, err := storage.GlobalStorage().Get(ctx, v.StorageKey)
+	require.NoError(t, err)
+	data, err := io.ReadAll(reader)
+	reader.Close()
+	require.NoError(t, err)
+	assert.Equal(t, original, data)
+
+	created, updated, err = f.RepairVariants(ctx, "Legacy", BackfillOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, 0, created+updated)
+}
@@ -0,0 +1,120 @@
+package fetcher
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"BingPaper/internal/config"
+	"BingPaper/internal/util"
+
+	"go.uber.org/zap"
+)
+
+// ErrInvalidDownload 表示下载到的内容不是预期的图片（错误页、被截断、尺寸不符等）
+var ErrInvalidDownload = errors.New("invalid image download")
+
+// uhdMinWidth UHD 原图的最小宽度
+const uhdMinWidth = 3840
+
+const userAgent = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36"
+
+// downloadImage 下载图片，暂时性错误（含读取中断）会按重试策略重试
+func (f *Fetcher) downloadImage(ctx context.Context, url string) ([]byte, error) {
+	var data []byte
+	err := f.retry(ctx, url, func() error {
+		var err error
+		data, err = f.downloadOnce(ctx, url)
+		return err
+	})
+	return data, err
+}
+
+// downloadOnce 下载一次图片，校验状态码、Content-Type 与大小上限，并确认内容完整
+func (f *Fetcher) downloadOnce(ctx context.Context, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", userAgent)
+
+	resp, err := f.send(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: unexpected status %d", ErrInvalidDownload, resp.StatusCode)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "" {
+		mediaType, _, _ := mime.ParseMediaType(ct)
+		if !strings.HasPrefix(mediaType, "image/") {
+			return nil, fmt.Errorf("%w: unexpected content type %q", ErrInvalidDownload, ct)
+		}
+	}
+
+	limit := config.GetConfig().Fetcher.GetMaxDownloadBytes()
+	if resp.ContentLength > limit {
+		return nil, fmt.Errorf("%w: %d bytes exceeds limit of %d", ErrInvalidDownload, resp.ContentLength, limit)
+	}
+	// 已知长度时按长度一次分配缓冲区，避免读取大图时反复扩容
+	buf := new(bytes.Buffer)
+	if resp.ContentLength > 0 {
+		buf.Grow(int(resp.ContentLength))
+	}
+	if _, err := buf.ReadFrom(io.LimitReader(resp.Body, limit+1)); err != nil {
+		if ctx.Err() != nil {
+			return nil, err
+		}
+		// 连接中途断开等读取错误通常是暂时性的
+		return nil, &retryableError{err: fmt.Errorf("%w: read body after %d bytes: %v", ErrInvalidDownload, buf.Len(), err)}
+	}
+	if int64(buf.Len()) > limit {
+		return nil, fmt.Errorf("%w: body exceeds limit of %d bytes", ErrInvalidDownload, limit)
+	}
+	if resp.ContentLength >= 0 && int64(buf.Len()) != resp.ContentLength {
+		return nil, &retryableError{err: fmt.Errorf("%w: truncated body, got %d of %d bytes", ErrInvalidDownload, buf.Len(), resp.ContentLength)}
+	}
+	return buf.Bytes(), nil
+}
+
+// validateImage 校验原图可以解码且尺寸与变体名称相符：UHD 宽度至少 3840，WxH 需完全一致
+func validateImage(data []byte, variantName string) error {
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidDownload, err)
+	}
+	if variantName == "UHD" {
+		if cfg.Width < uhdMinWidth {
+			return fmt.Errorf("%w: UHD image is only %dx%d", ErrInvalidDownload, cfg.Width, cfg.Height)
+		}
+	} else if w, h, ok := parseVariantSize(variantName); ok && (cfg.Width != w || cfg.Height != h) {
+		return fmt.Errorf("%w: expected %s, got %dx%d", ErrInvalidDownload, variantName, cfg.Width, cfg.Height)
+	}
+	util.Logger.Debug("Downloaded image validated",
+		zap.String("variant", variantName),
+		zap.String("format", format),
+		zap.Int("width", cfg.Width),
+		zap.Int("height", cfg.Height),
+		zap.String("sha256", Checksum(data)))
+	return nil
+}
+
+// parseVariantSize 解析 WxH 形式的变体名称
+func parseVariantSize(name string) (int, int, bool) {
+	ws, hs, ok := strings.Cut(name, "x")
+	if !ok {
+		return 0, 0, false
+	}
+	w, errW := strconv.Atoi(ws)
+	h, errH := strconv.Atoi(hs)
+	return w, h, errW == nil && errH == nil
+}
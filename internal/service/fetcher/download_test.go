@@ -0,0 +1,92 @@
+package fetcher
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"BingPaper/internal/config"
+	"BingPaper/internal/util"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestDownloadImage(t *testing.T) {
+	require.NoError(t, config.Init(""))
+	config.GetConfig().Fetcher.MaxDownloadMB = 1
+	config.GetConfig().Fetcher.Retry.InitialBackoff = "1ms"
+	util.Logger = zap.NewNop()
+
+	jpg := testJPEG(t, 32, 18)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ok.jpg", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/jpeg")
+		w.Write(jpg)
+	})
+	mux.HandleFunc("/missing.jpg", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "<html>not found</html>", http.StatusNotFound)
+	})
+	mux.HandleFunc("/html.jpg", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte("<html></html>"))
+	})
+	mux.HandleFunc("/huge.jpg", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/jpeg")
+		w.Write([]byte(strings.Repeat("x", 2<<20)))
+	})
+	var truncatedCalls, flakyCalls atomic.Int32
+	mux.HandleFunc("/truncated.jpg", func(w http.ResponseWriter, r *http.Request) {
+		truncatedCalls.Add(1)
+		w.Header().Set("Content-Type", "image/jpeg")
+		w.Header().Set("Content-Length", "1000")
+		w.Write(jpg[:100])
+	})
+	// 第一次响应被截断，重试后成功
+	mux.HandleFunc("/flaky.jpg", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/jpeg")
+		w.Header().Set("Content-Length", strconv.Itoa(len(jpg)))
+		if flakyCalls.Add(1) == 1 {
+			w.Write(jpg[:len(jpg)/2])
+			return
+		}
+		w.Write(jpg)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	f := &Fetcher{httpClient: srv.Client()}
+	ctx := context.Background()
+
+	data, err := f.downloadImage(ctx, srv.URL+"/ok.jpg")
+	require.NoError(t, err)
+	assert.Equal(t, jpg, data)
+
+	for _, path := range []string{"/missing.jpg", "/html.jpg", "/huge.jpg"} {
+		_, err := f.downloadImage(ctx, srv.URL+path)
+		assert.ErrorIs(t, err, ErrInvalidDownload, path)
+	}
+	_, err = f.downloadImage(ctx, srv.URL+"/truncated.jpg")
+	assert.ErrorIs(t, err, ErrInvalidDownload)
+	assert.EqualValues(t, config.GetConfig().Fetcher.Retry.GetMaxAttempts(), truncatedCalls.Load())
+
+	data, err = f.downloadImage(ctx, srv.URL+"/flaky.jpg")
+	require.NoError(t, err)
+	assert.Equal(t, jpg, data)
+	assert.EqualValues(t, 2, flakyCalls.Load())
+}
+
+func TestValidateImage(t *testing.T) {
+	util.Logger = zap.NewNop()
+
+	assert.NoError(t, validateImage(testJPEG(t, 32, 18), "32x18"))
+	assert.ErrorIs(t, validateImage(testJPEG(t, 32, 18), "1920x1080"), ErrInvalidDownload)
+	assert.ErrorIs(t, validateImage(testJPEG(t, 1920, 1080), "UHD"), ErrInvalidDownload)
+	assert.ErrorIs(t, validateImage([]byte("<html>error</html>"), "UHD"), ErrInvalidDownload)
+	assert.NoError(t, validateImage(testJPEG(t, 64, 36), "custom"))
+}
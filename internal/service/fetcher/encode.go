@@ -0,0 +1,182 @@
+package fetcher
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"BingPaper/internal/config"
+	"BingPaper/internal/util"
+
+	"go.uber.org/zap"
+)
+
+const (
+	FormatJPEG = "jpg"
+	FormatWebP = "webp"
+	FormatAVIF = "avif"
+)
+
+// 有损格式在未单独配置质量（即默认的 100）时使用的编码质量，避免体积超过同尺寸的 JPEG
+const (
+	DefaultWebPQuality = 80
+	DefaultAVIFQuality = 60
+)
+
+// ErrEncoderUnavailable 表示当前运行环境缺少对应格式的编码器
+var ErrEncoderUnavailable = errors.New("image encoder unavailable")
+
+// externalEncoders 依赖外部命令编码的格式
+var externalEncoders = map[string]string{
+	FormatWebP: "cwebp",
+	FormatAVIF: "avifenc",
+}
+
+// encoderChecks 缓存外部编码器是否可用，format -> bool
+var encoderChecks sync.Map
+
+// encoderAvailable 判断格式的编码器是否可用，缺少外部编码器时只在首次检查时记录警告
+func encoderAvailable(format string) bool {
+	bin, ok := externalEncoders[format]
+	if !ok {
+		return true
+	}
+	if v, ok := encoderChecks.Load(format); ok {
+		return v.(bool)
+	}
+	_, err := exec.LookPath(bin)
+	if _, loaded := encoderChecks.LoadOrStore(format, err == nil); !loaded && err != nil {
+		util.Logger.Warn("Image encoder not found, skipping format", zap.String("format", format), zap.String("encoder", bin))
+	}
+	return err == nil
+}
+
+// availableFormats 过滤掉缺少编码器的格式
+func availableFormats(formats []string) []string {
+	result := formats[:0:0]
+	for _, f := range formats {
+		if encoderAvailable(f) {
+			result = append(result, f)
+		}
+	}
+	return result
+}
+
+// normalizeFormats 规范化配置中的格式列表：统一小写、去重、过滤不支持的格式。
+// jpg 始终保留且排在首位，保证每个变体至少有一份 JPEG。
+func normalizeFormats(formats []string) []string {
+	result := []string{FormatJPEG}
+	seen := map[string]bool{FormatJPEG: true}
+	for _, f := range formats {
+		f = strings.ToLower(strings.TrimSpace(f))
+		if f == "jpeg" {
+			f = FormatJPEG
+		}
+		if seen[f] {
+			continue
+		}
+		switch f {
+		case FormatWebP, FormatAVIF:
+			seen[f] = true
+			result = append(result, f)
+		}
+	}
+	return result
+}
+
+// EnabledFormats 返回当前配置中生效的变体格式列表，缺少编码器的格式不会生效
+func EnabledFormats() []string {
+	return availableFormats(normalizeFormats(config.GetConfig().Fetcher.Formats))
+}
+
+// ContentTypeForFormat 返回格式对应的 MIME 类型
+func ContentTypeForFormat(format string) string {
+	switch format {
+	case FormatWebP:
+		return "image/webp"
+	case FormatAVIF:
+		return "image/avif"
+	default:
+		return "image/jpeg"
+	}
+}
+
+// EncodeImage 将图片编码为指定格式，quality 为编码质量 (1-100)。
+// webp/avif 的 quality 为 DefaultQuality 时分别使用 DefaultWebPQuality、DefaultAVIFQuality。
+// 外部编码器随 ctx 取消而终止。
+func EncodeImage(ctx context.Context, img image.Image, format string, quality int) ([]byte, error) {
+	switch format {
+	case FormatJPEG:
+		buf := new(bytes.Buffer)
+		if err := jpeg.Encode(buf, img, &jpeg.Options{Quality: quality}); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	case FormatWebP:
+		// 纯 Go 的 WebP 编码器只支持无损模式，体积远大于 JPEG，因此使用 libwebp 的有损编码
+		if quality >= DefaultQuality {
+			quality = DefaultWebPQuality
+		}
+		return encodeExternal(ctx, img, externalEncoders[FormatWebP], FormatWebP, func(in, out string) []string {
+			return []string{"-quiet", "-q", strconv.Itoa(quality), in, "-o", out}
+		})
+	case FormatAVIF:
+		// 纯 Go 环境下没有可用的 AVIF 编码器
+		if quality >= DefaultQuality {
+			quality = DefaultAVIFQuality
+		}
+		return encodeExternal(ctx, img, externalEncoders[FormatAVIF], FormatAVIF, func(in, out string) []string {
+			return []string{"--speed", "6", "-q", strconv.Itoa(quality), in, out}
+		})
+	default:
+		return nil, fmt.Errorf("unsupported image format: %s", format)
+	}
+}
+
+// encodeExternal 调用外部编码器（cwebp、avifenc）进行编码：先将图片无损写成临时 PNG，
+// 再由 args 生成命令行参数转换为目标格式。未安装编码器时返回 ErrEncoderUnavailable。
+func encodeExternal(ctx context.Context, img image.Image, name, format string, args func(in, out string) []string) ([]byte, error) {
+	bin, err := exec.LookPath(name)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s not found in PATH", ErrEncoderUnavailable, name)
+	}
+
+	dir, err := os.MkdirTemp("", "bingpaper-"+format+"-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	inPath := filepath.Join(dir, "in.png")
+	outPath := filepath.Join(dir, "out."+format)
+
+	// 中间文件使用无损的 PNG，避免目标格式在 JPEG 的基础上再次有损压缩
+	src := new(bytes.Buffer)
+	if err := (&png.Encoder{CompressionLevel: png.BestSpeed}).Encode(src, img); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(inPath, src.Bytes(), 0644); err != nil {
+		return nil, err
+	}
+
+	cmd := exec.CommandContext(ctx, bin, args(inPath, outPath)...)
+	cmd.WaitDelay = time.Second
+	if out, err := cmd.CombinedOutput(); err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, fmt.Errorf("%s: %w", name, ctxErr)
+		}
+		return nil, fmt.Errorf("%s failed: %v: %s", name, err, strings.TrimSpace(string(out)))
+	}
+	return os.ReadFile(outPath)
+}
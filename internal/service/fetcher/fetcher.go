@@ -3,12 +3,10 @@ package fetcher
 import (
 	"bytes"
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"image"
 	"image/jpeg"
-	"io"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -18,10 +16,12 @@ import (
 	"BingPaper/internal/config"
 	"BingPaper/internal/model"
 	"BingPaper/internal/repo"
+	"BingPaper/internal/service/event"
+	"BingPaper/internal/service/job"
+	"BingPaper/internal/service/webhook"
 	"BingPaper/internal/storage"
 	"BingPaper/internal/util"
 
-	"github.com/disintegration/imaging"
 	"go.uber.org/zap"
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
@@ -46,6 +46,7 @@ type BingImage struct {
 
 type Fetcher struct {
 	httpClient *http.Client
+	limiter    *hostLimiter // 为 nil 时不限速
 }
 
 type fetchWindow struct {
@@ -61,7 +62,7 @@ func NewFetcher() *Fetcher {
 	transport.Proxy = http.ProxyFromEnvironment
 
 	// 检查是否有代理
-	dummyReq, _ := http.NewRequest("GET", "https://www.bing.com", nil)
+	dummyReq, _ := http.NewRequest("GET", config.GetConfig().Fetcher.Bing.GetAPIBase(), nil)
 	proxyURL, err := transport.Proxy(dummyReq)
 	if err == nil && proxyURL != nil {
 		util.Logger.Info("HTTP proxy detected from environment", zap.String("proxy", proxyURL.String()))
@@ -72,10 +73,13 @@ func NewFetcher() *Fetcher {
 			Timeout:   30 * time.Second,
 			Transport: transport,
 		},
+		limiter: sharedLimiter,
 	}
 }
 
-func (f *Fetcher) Fetch(ctx context.Context, n int, force bool) error {
+// Fetch 按配置的并发度从所有启用的图片源抓取各地区最近 n 天的图片，返回各地区结果汇总的报告。
+// 部分地区失败时同时返回报告和汇总后的错误；在任务中运行时报告会写入任务结果。
+func (f *Fetcher) Fetch(ctx context.Context, n int, force bool) (*FetchReport, error) {
 	if n <= 0 {
 		n = config.BingFetchN
 	}
@@ -89,25 +93,85 @@ func (f *Fetcher) Fetch(ctx context.Context, n int, force bool) error {
 		regions = []string{config.GetConfig().GetDefaultRegion()}
 	}
 
-	for _, mkt := range regions {
-		if err := f.fetchRegionDays(ctx, mkt, n, force); err != nil {
-			util.Logger.Error("Failed to fetch region images", zap.String("mkt", mkt), zap.Error(err))
+	sources := f.Sources()
+	workers := config.GetConfig().Fetcher.GetRegionConcurrency()
+
+	// 每个图片源的每个地区为一个抓取单元，不区分地区的图片源只有一个单元，图片关联到所有地区
+	report := &FetchReport{Days: n, Force: force, StartedAt: time.Now()}
+	var units []fetchUnit
+	for _, src := range sources {
+		if isRegionless(src) {
+			report.Regions = append(report.Regions, RegionResult{Source: src.Name()})
+			units = append(units, fetchUnit{src: src, mkts: regions})
+			continue
+		}
+		for _, mkt := range regions {
+			report.Regions = append(report.Regions, RegionResult{Source: src.Name(), Mkt: mkt})
+			units = append(units, fetchUnit{src: src, mkts: []string{mkt}})
 		}
 	}
 
-	util.Logger.Info("Fetch task completed")
-	return nil
+	h := job.FromContext(ctx)
+	h.SetTotal(len(units))
+	h.Logf("fetching %d day(s) for %d region(s) from %d source(s) with %d worker(s), force=%v", n, len(regions), len(sources), workers, force)
+
+	started := make([]bool, len(units))
+	cancelErr := runPool(ctx, workers, len(units), func(i int) {
+		started[i] = true
+		res := &report.Regions[i]
+		begin := time.Now()
+		err := f.fetchRegionDays(ctx, units[i].src, units[i].mkts, n, force, res)
+		res.finish(err, time.Since(begin))
+		if err != nil {
+			util.Logger.Error("Failed to fetch region images", zap.String("source", res.Source), zap.String("mkt", res.Mkt), zap.Error(err))
+			h.Logf("[%s] failed: %v", res.label(), err)
+			notifyFetchFailed(res.Source, res.Mkt, err)
+		} else {
+			h.Logf("[%s] ok: %d fetched, %d skipped, %d failed in %s", res.label(), res.Fetched, res.Skipped, res.Failed, res.Duration)
+		}
+		h.Advance(1)
+	})
+	// 取消后尚未开始的地区同样记为失败
+	for i := range report.Regions {
+		if !started[i] {
+			report.Regions[i].finish(cancelErr, 0)
+		}
+	}
+	report.FinishedAt = time.Now()
+	h.SetResult(report)
+
+	util.Logger.Info("Fetch task completed",
+		zap.Int("sources", len(sources)),
+		zap.Int("regions", len(regions)),
+		zap.Int("failed_regions", report.Failed()),
+		zap.Duration("elapsed", report.FinishedAt.Sub(report.StartedAt)))
+	return report, report.Err()
 }
 
-// FetchRegion 抓取指定地区的图片
+// FetchRegion 从 Bing 抓取指定地区的图片
 func (f *Fetcher) FetchRegion(ctx context.Context, mkt string, force bool) error {
-	return f.fetchRegionDays(ctx, mkt, config.BingFetchN, force)
+	src := sourceFactories[config.SourceBing](f)
+	err := f.fetchRegionDays(ctx, src, []string{mkt}, config.BingFetchN, force, &RegionResult{Source: src.Name(), Mkt: mkt})
+	if err != nil {
+		notifyFetchFailed(src.Name(), mkt, err)
+	}
+	return err
+}
+
+// fetchUnit 一个抓取单元：从 src 列出一次图片，并关联到 mkts 中的每个地区
+type fetchUnit struct {
+	src  Source
+	mkts []string
 }
 
-func (f *Fetcher) fetchRegionDays(ctx context.Context, mkt string, n int, force bool) error {
-	if !util.IsValidRegion(mkt) {
-		util.Logger.Warn("Skipping fetch for invalid region", zap.String("mkt", mkt))
-		return fmt.Errorf("invalid region code: %s", mkt)
+// fetchRegionDays 从 src 抓取 mkts 最近 n 天的图片，并将各图片的处理结果累计到 res。
+// mkts 有多个地区时仅用于不区分地区的图片源，图片列表只请求一次。
+func (f *Fetcher) fetchRegionDays(ctx context.Context, src Source, mkts []string, n int, force bool, res *RegionResult) error {
+	for _, mkt := range mkts {
+		if !util.IsValidRegion(mkt) {
+			util.Logger.Warn("Skipping fetch for invalid region", zap.String("mkt", mkt))
+			return fmt.Errorf("invalid region code: %s", mkt)
+		}
 	}
 	if n <= 0 {
 		n = config.BingFetchN
@@ -118,15 +182,17 @@ func (f *Fetcher) fetchRegionDays(ctx context.Context, mkt string, n int, force
 
 	windows := buildFetchWindows(n)
 	util.Logger.Info("Fetching images for region",
-		zap.String("mkt", mkt),
+		zap.String("source", src.Name()),
+		zap.Strings("mkts", mkts),
 		zap.Int("days", n),
 		zap.Int("batches", len(windows)),
 		zap.Bool("force", force))
 
 	for _, window := range windows {
-		if err := f.fetchByMkt(ctx, mkt, window.idx, window.n, force); err != nil {
+		if err := f.fetchByMkt(ctx, src, mkts, window.idx, window.n, force, res); err != nil {
 			util.Logger.Error("Failed to fetch images",
-				zap.String("mkt", mkt),
+				zap.String("source", src.Name()),
+				zap.Strings("mkts", mkts),
 				zap.Int("idx", window.idx),
 				zap.Int("n", window.n),
 				zap.Error(err))
@@ -157,51 +223,44 @@ func buildFetchWindows(totalDays int) []fetchWindow {
 	return windows
 }
 
-func (f *Fetcher) fetchByMkt(ctx context.Context, mkt string, idx int, n int, force bool) error {
-	lang := strings.Split(mkt, "-")[0]
-	url := fmt.Sprintf("%s?format=js&idx=%d&n=%d&uhd=1&mkt=%s&setlang=%s", config.BingAPIBase, idx, n, mkt, lang)
-	util.Logger.Info("Requesting Bing API", zap.String("url", url))
-
-	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
-	if err != nil {
-		util.Logger.Error("Failed to create Bing API request", zap.Error(err))
-		return err
-	}
-
-	// 添加请求头以增强地区/语言识别
-	req.Header.Set("Accept-Language", fmt.Sprintf("%s,%s;q=0.9", mkt, lang))
-	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36")
-
-	resp, err := f.httpClient.Do(req)
+func (f *Fetcher) fetchByMkt(ctx context.Context, src Source, mkts []string, idx int, n int, force bool, res *RegionResult) error {
+	images, err := src.List(ctx, mkts[0], idx, n)
 	if err != nil {
-		util.Logger.Error("Failed to request Bing API", zap.Error(err))
-		return err
-	}
-	defer resp.Body.Close()
-
-	util.Logger.Info("Received response from Bing API", zap.String("mkt", mkt), zap.Int("status", resp.StatusCode))
-
-	var bingResp BingResponse
-	if err := json.NewDecoder(resp.Body).Decode(&bingResp); err != nil {
-		util.Logger.Error("Failed to decode Bing API response", zap.Error(err))
 		return err
 	}
 
-	util.Logger.Info("Fetched images from Bing", zap.String("mkt", mkt), zap.Int("count", len(bingResp.Images)))
+	util.Logger.Info("Fetched image list", zap.String("source", src.Name()), zap.Strings("mkts", mkts), zap.Int("count", len(images)))
 
-	for _, bingImg := range bingResp.Images {
-		util.Logger.Info("Bing image metadata",
-			zap.String("mkt", mkt),
+	var errs []error
+images:
+	for _, bingImg := range images {
+		util.Logger.Info("Image metadata",
+			zap.String("source", src.Name()),
+			zap.Strings("mkts", mkts),
 			zap.String("date", bingImg.Enddate),
 			zap.String("title", bingImg.Title),
 			zap.String("hsh", bingImg.HSH))
 
-		if err := f.processImage(ctx, bingImg, mkt, force); err != nil {
-			util.Logger.Error("Failed to process image", zap.String("date", bingImg.Enddate), zap.String("mkt", mkt), zap.Error(err))
+		for _, mkt := range mkts {
+			if err := ctx.Err(); err != nil {
+				errs = append(errs, err)
+				break images
+			}
+			saved, err := f.processImage(ctx, src, bingImg, mkt, force)
+			switch {
+			case err != nil:
+				util.Logger.Error("Failed to process image", zap.String("date", bingImg.Enddate), zap.String("mkt", mkt), zap.Error(err))
+				errs = append(errs, fmt.Errorf("image %s: %w", bingImg.Enddate, err))
+				res.Failed++
+			case saved:
+				res.Fetched++
+			default:
+				res.Skipped++
+			}
 		}
 	}
 
-	return nil
+	return errors.Join(errs...)
 }
 
 func (f *Fetcher) deleteImageContentIfUnused(ctx context.Context, imageName string, excludingRegionID uint) {
@@ -223,27 +282,116 @@ func (f *Fetcher) deleteImageContentIfUnused(ctx context.Context, imageName stri
 		return
 	}
 
-	for _, variant := range variants {
-		if err := storage.GlobalStorage.Delete(ctx, variant.StorageKey); err != nil {
-			util.Logger.Warn("Failed to delete stale storage object",
-				zap.String("key", variant.StorageKey),
-				zap.Error(err))
-		}
-	}
-
 	if err := repo.DB.Where("image_name = ?", imageName).Delete(&model.ImageVariant{}).Error; err != nil {
 		util.Logger.Warn("Failed to delete stale image variants",
 			zap.String("image_name", imageName),
 			zap.Error(err))
+		return
+	}
+
+	keys := make([]string, 0, len(variants))
+	for _, variant := range variants {
+		keys = append(keys, variant.StorageKey)
 	}
+	ReleaseObjects(ctx, keys)
 }
 
-func (f *Fetcher) processImage(ctx context.Context, bingImg BingImage, mkt string, force bool) error {
+// processImage 下载并入库一张图片，返回 false 表示该地区当天已有记录而被跳过
+func (f *Fetcher) processImage(ctx context.Context, src Source, bingImg BingImage, mkt string, force bool) (bool, error) {
+	res, err := f.ingestImage(ctx, src.Name(), bingImg, mkt, force, func() ([]byte, string, error) {
+		imgURL, variantName, err := src.Resolve(ctx, bingImg)
+		if err != nil {
+			return nil, "", fmt.Errorf("resolve download url: %w", err)
+		}
+		util.Logger.Debug("Downloading image", zap.String("url", imgURL), zap.Bool("force", force))
+		data, err := f.downloadImage(ctx, imgURL)
+		if err == nil && variantName == "" {
+			variantName, err = detectVariantName(data)
+		} else if err == nil {
+			err = validateImage(data, variantName)
+		}
+		if err != nil {
+			util.Logger.Error("Failed to download image", zap.String("url", imgURL), zap.Error(err))
+			return nil, "", fmt.Errorf("download %s: %w", imgURL, err)
+		}
+		return data, variantName, nil
+	})
+	if err != nil || res.skipped {
+		return false, err
+	}
+
+	f.publishImageEvent(res.date, mkt, src.Name(), res.replaced)
+
+	// 保存今日额外文件，按地区存放，只取默认图片源的图片以免被其他图片源覆盖
+	today := time.Now().Format("2006-01-02")
+	if res.date == today && config.GetConfig().Feature.WriteDailyFiles && src.Name() == config.GetConfig().GetDefaultSource() {
+		if res.data != nil && res.srcImg != nil {
+			f.saveDailyFiles(res.srcImg, res.data, mkt)
+		}
+	}
+
+	return true, nil
+}
+
+// ImportImage 使用本地已有的原图数据入库一张图片，不访问 Bing。
+// 变体矩阵的生成与 ImageRegion 的写入与抓取流程一致，但不会触发事件和 Webhook。
+// 返回 false 表示该地区当天已有记录且未指定 force，因此被跳过。
+// source 为空时视为 Bing 图片。
+func (f *Fetcher) ImportImage(ctx context.Context, source string, bingImg BingImage, mkt string, force bool, load func() ([]byte, error)) (bool, error) {
+	if source == "" {
+		source = config.SourceBing
+	}
+	res, err := f.ingestImage(ctx, source, bingImg, mkt, force, func() ([]byte, string, error) {
+		data, err := load()
+		if err != nil {
+			return nil, "", err
+		}
+		variantName, err := detectVariantName(data)
+		if err != nil {
+			return nil, "", err
+		}
+		return data, variantName, nil
+	})
+	if err != nil {
+		return false, err
+	}
+	return !res.skipped, nil
+}
+
+// sourceVariantName 根据原图尺寸确定原图变体名称，与抓取时的 UHD / 1920x1080 命名保持一致
+func sourceVariantName(width, height int) string {
+	if width > 1920 {
+		return "UHD"
+	}
+	return fmt.Sprintf("%dx%d", width, height)
+}
+
+// detectVariantName 解析原图尺寸并返回对应的原图变体名称
+func detectVariantName(data []byte) (string, error) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidDownload, err)
+	}
+	return sourceVariantName(cfg.Width, cfg.Height), nil
+}
+
+type ingestResult struct {
+	date     string
+	skipped  bool // 地区当天已有记录且未强制覆盖
+	replaced bool // 覆盖了已有的地区记录
+	srcImg   image.Image
+	data     []byte
+}
+
+// ingestImage 写入一张图片的变体矩阵和地区记录。
+// load 返回原图数据及原图变体名称，仅在变体尚不存在（或 force）时调用。
+func (f *Fetcher) ingestImage(ctx context.Context, source string, bingImg BingImage, mkt string, force bool, load func() ([]byte, string, error)) (ingestResult, error) {
 	dateStr := fmt.Sprintf("%s-%s-%s", bingImg.Enddate[0:4], bingImg.Enddate[4:6], bingImg.Enddate[6:8])
+	res := ingestResult{date: dateStr}
 
 	// 1. 地区关联幂等检查
 	var existingRegion model.ImageRegion
-	if err := repo.DB.Where("date = ? AND mkt = ?", dateStr, mkt).First(&existingRegion).Error; err == nil {
+	if err := repo.DB.Where("date = ? AND mkt = ? AND source = ?", dateStr, mkt, source).First(&existingRegion).Error; err == nil {
 		if force {
 			util.Logger.Info("Force refresh enabled, existing ImageRegion will be overwritten",
 				zap.String("date", dateStr),
@@ -251,44 +399,26 @@ func (f *Fetcher) processImage(ctx context.Context, bingImg BingImage, mkt strin
 				zap.String("existing_image_name", existingRegion.ImageName))
 		} else {
 			util.Logger.Info("ImageRegion record already exists, skipping", zap.String("date", dateStr), zap.String("mkt", mkt), zap.String("title", bingImg.Title))
-			return nil
+			res.skipped = true
+			return res, nil
 		}
 	} else if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
-		return err
+		return res, err
 	}
-	if existingRegion.ID == 0 && !force {
-		// no existing row
-	} else if existingRegion.ID == 0 && force {
+	if existingRegion.ID == 0 && force {
 		util.Logger.Info("Force refresh enabled but no existing ImageRegion found, inserting new record",
 			zap.String("date", dateStr),
 			zap.String("mkt", mkt))
 	}
+	res.replaced = existingRegion.ID != 0
 
-	imageName := f.extractImageName(bingImg.URLBase, bingImg.HSH)
+	imageName := imageNameForSource(source, bingImg)
 
 	// 2. 处理变体
-	imgURL, variantName := f.probeUHD(ctx, bingImg.URLBase)
-	targetVariants := []struct {
-		name   string
-		width  int
-		height int
-	}{
-		{"1920x1200", 1920, 1200},
-		{"1920x1080", 1920, 1080},
-		{"1080x1920", 1080, 1920},
-		{"1366x768", 1366, 768},
-		{"1280x768", 1280, 768},
-		{"1024x768", 1024, 768},
-		{"800x600", 800, 600},
-		{"800x480", 800, 480},
-		{"768x1280", 768, 1280},
-		{"720x1280", 720, 1280},
-		{"640x480", 640, 480},
-		{"480x800", 480, 800},
-		{"400x240", 400, 240},
-		{"320x240", 320, 240},
-		{"240x320", 240, 320},
-	}
+	// 多个地区并发抓取到同一张图片时串行处理，后到的地区只关联已生成的变体
+	unlock := imageLocks.lock(imageName)
+	defer unlock()
+	targetVariants := config.GetConfig().GetVariants()
 
 	// 检查变体是否已存在 (通过 ImageName)
 	var existingVariants []model.ImageVariant
@@ -296,49 +426,39 @@ func (f *Fetcher) processImage(ctx context.Context, bingImg BingImage, mkt strin
 
 	allVariantsExist := len(existingVariants) > 0
 
-	var srcImg image.Image
-	var imgData []byte
-
 	if allVariantsExist && !force {
 		util.Logger.Debug("Image variants already exist for name, linking only", zap.String("imageName", imageName))
 	} else {
-		util.Logger.Debug("Downloading and processing image",
-			zap.String("url", imgURL),
-			zap.String("imageName", imageName),
-			zap.Bool("force", force))
-		var err error
-		imgData, err = f.downloadImage(ctx, imgURL)
+		util.Logger.Debug("Processing image", zap.String("imageName", imageName), zap.Bool("force", force))
+		imgData, variantName, err := load()
 		if err != nil {
-			util.Logger.Error("Failed to download image", zap.String("url", imgURL), zap.Error(err))
-			return err
+			return res, err
 		}
 
-		srcImg, _, err = image.Decode(bytes.NewReader(imgData))
+		srcImg, format, err := image.Decode(bytes.NewReader(imgData))
 		if err != nil {
 			util.Logger.Error("Failed to decode image data", zap.Error(err))
-			return err
+			return res, err
 		}
+		res.srcImg, res.data = srcImg, imgData
 
-		// 保存原图变体
-		if err := f.saveVariant(ctx, imageName, variantName, "jpg", imgData, force); err != nil {
-			util.Logger.Error("Failed to save original variant", zap.String("variant", variantName), zap.Error(err))
+		// 保存原图变体（jpg 直接使用原始数据，其余格式重新编码）
+		jpegData := imgData
+		if format != "jpeg" {
+			jpegData = nil
 		}
+		f.saveEncodedVariants(ctx, imageName, variantName, srcImg, jpegData, EnabledFormats(), DefaultQuality, originalSpec, force)
 
+		variants := make([]config.VariantConfig, 0, len(targetVariants))
 		for _, v := range targetVariants {
-			if v.name == variantName {
-				continue
-			}
-			resized := imaging.Fill(srcImg, v.width, v.height, imaging.Center, imaging.Lanczos)
-			buf := new(bytes.Buffer)
-			if err := jpeg.Encode(buf, resized, &jpeg.Options{Quality: 100}); err != nil {
-				util.Logger.Warn("Failed to encode jpeg", zap.String("variant", v.name), zap.Error(err))
-				continue
-			}
-			currentImgData := buf.Bytes()
-			if err := f.saveVariant(ctx, imageName, v.name, "jpg", currentImgData, force); err != nil {
-				util.Logger.Error("Failed to save variant", zap.String("variant", v.name), zap.Error(err))
+			if v.Name != variantName {
+				variants = append(variants, v)
 			}
 		}
+		// 取消时不写入地区记录，避免留下缺少变体的图片
+		if err := f.renderVariants(ctx, imageName, srcImg, variants, force); err != nil {
+			return res, err
+		}
 	}
 
 	// 3. 创建 ImageRegion 记录
@@ -348,6 +468,7 @@ func (f *Fetcher) processImage(ctx context.Context, bingImg BingImage, mkt strin
 		ImageName:     imageName,
 		Date:          dateStr,
 		Mkt:           mkt,
+		Source:        source,
 		Title:         bingImg.Title,
 		Copyright:     bingImg.Copyright,
 		CopyrightLink: bingImg.CopyrightLink,
@@ -357,11 +478,11 @@ func (f *Fetcher) processImage(ctx context.Context, bingImg BingImage, mkt strin
 	}
 
 	if err := repo.DB.Clauses(clause.OnConflict{
-		Columns:   []clause.Column{{Name: "date"}, {Name: "mkt"}},
+		Columns:   []clause.Column{{Name: "date"}, {Name: "mkt"}, {Name: "source"}},
 		UpdateAll: true,
 	}).Create(&regionRecord).Error; err != nil {
 		util.Logger.Error("Failed to create region record", zap.Error(err))
-		return err
+		return res, err
 	}
 
 	util.Logger.Info("Successfully saved/updated ImageRegion record to database",
@@ -373,18 +494,116 @@ func (f *Fetcher) processImage(ctx context.Context, bingImg BingImage, mkt strin
 		f.deleteImageContentIfUnused(ctx, existingRegion.ImageName, existingRegion.ID)
 	}
 
-	// 4. 保存今日额外文件
-	today := time.Now().Format("2006-01-02")
-	if dateStr == today && config.GetConfig().Feature.WriteDailyFiles {
-		if imgData != nil && srcImg != nil {
-			f.saveDailyFiles(srcImg, imgData, mkt)
+	return res, nil
+}
+
+// publishImageEvent 通知事件订阅者和 Webhook 某图片源某地区某日的图片已新增或被覆盖
+func (f *Fetcher) publishImageEvent(date, mkt, source string, replaced bool) {
+	var saved model.ImageRegion
+	if err := repo.DB.Where("date = ? AND mkt = ? AND source = ?", date, mkt, source).Preload("Variants", func(db *gorm.DB) *gorm.DB {
+		return db.Order("size asc")
+	}).First(&saved).Error; err != nil {
+		util.Logger.Warn("Failed to load image region for event", zap.String("date", date), zap.String("mkt", mkt), zap.Error(err))
+		return
+	}
+
+	eventType := event.TypeImageCreated
+	if replaced {
+		eventType = event.TypeImageReplaced
+	}
+	event.Publish(event.Event{Type: eventType, Image: &saved})
+	webhook.Dispatch(eventType, mkt, &saved)
+}
+
+// notifyFetchFailed 通知 Webhook 某图片源的某地区抓取失败
+func notifyFetchFailed(source, mkt string, err error) {
+	webhook.Dispatch(webhook.EventFetchFailed, mkt, map[string]string{
+		"source": source,
+		"mkt":    mkt,
+		"error":  err.Error(),
+	})
+}
+
+// encodedVariant 一个变体按某种格式编码后的数据
+type encodedVariant struct {
+	variant string
+	format  string
+	spec    string
+	data    []byte
+}
+
+// encodeVariant 将同一变体按配置的各个格式编码，编码失败的格式记录日志后跳过。
+// jpegData 不为空时直接作为 jpg 数据使用，避免对原图二次压缩。
+func encodeVariant(ctx context.Context, variant string, img image.Image, jpegData []byte, formats []string, quality int, spec string) []encodedVariant {
+	encoded := make([]encodedVariant, 0, len(formats))
+	for _, format := range formats {
+		data := jpegData
+		if format != FormatJPEG || data == nil {
+			var err error
+			data, err = EncodeImage(ctx, img, format, quality)
+			if err != nil {
+				util.Logger.Warn("Failed to encode variant",
+					zap.String("variant", variant),
+					zap.String("format", format),
+					zap.Error(err))
+				continue
+			}
 		}
+		encoded = append(encoded, encodedVariant{variant: variant, format: format, spec: spec, data: data})
 	}
+	return encoded
+}
 
-	return nil
+// saveEncodedVariants 将同一变体按配置的各个格式编码并保存
+func (f *Fetcher) saveEncodedVariants(ctx context.Context, imageName, variant string, img image.Image, jpegData []byte, formats []string, quality int, spec string, force bool) {
+	for _, ev := range encodeVariant(ctx, variant, img, jpegData, formats, quality, spec) {
+		f.saveEncoded(ctx, imageName, ev, force)
+	}
 }
 
-func (f *Fetcher) extractImageName(urlBase, hsh string) string {
+func (f *Fetcher) saveEncoded(ctx context.Context, imageName string, ev encodedVariant, force bool) {
+	if err := f.saveVariant(ctx, imageName, ev.variant, ev.format, ev.data, ev.spec, force); err != nil {
+		util.Logger.Error("Failed to save variant",
+			zap.String("variant", ev.variant),
+			zap.String("format", ev.format),
+			zap.Error(err))
+	}
+}
+
+// renderVariants 用 fetcher.variant_concurrency 个 worker 并发缩放和编码变体，
+// 编码结果在当前 goroutine 中依次写入存储和数据库。ctx 取消时返回其错误。
+func (f *Fetcher) renderVariants(ctx context.Context, imageName string, srcImg image.Image, variants []config.VariantConfig, force bool) error {
+	out := make(chan encodedVariant)
+	done := make(chan error, 1)
+	go func() {
+		done <- runPool(ctx, config.GetConfig().Fetcher.GetVariantConcurrency(), len(variants), func(i int) {
+			v := variants[i]
+			resized := renderVariant(srcImg, v)
+			for _, ev := range encodeVariant(ctx, v.Name, resized, nil, variantFormats(v), variantQuality(v), variantSpec(v)) {
+				select {
+				case out <- ev:
+				case <-ctx.Done():
+					return
+				}
+			}
+		})
+		close(out)
+	}()
+
+	for ev := range out {
+		if ctx.Err() != nil {
+			continue // 排空剩余结果，等待 worker 退出
+		}
+		f.saveEncoded(ctx, imageName, ev, force)
+	}
+	if err := <-done; err != nil {
+		return err
+	}
+	return ctx.Err()
+}
+
+// ExtractImageName 从 urlbase（或文件名）中提取图片名称，如 /th?id=OHR.MilwaukeeHall_ROW0871854348 -> MilwaukeeHall
+func ExtractImageName(urlBase, hsh string) string {
 	// 示例: /th?id=OHR.MilwaukeeHall_ROW0871854348
 	start := 0
 	if idx := strings.Index(urlBase, "OHR."); idx != -1 {
@@ -406,55 +625,94 @@ func (f *Fetcher) extractImageName(urlBase, hsh string) string {
 	return name
 }
 
+// probeUHD 检查 UHD 原图是否存在，存在时返回其地址，否则回退到 1920x1080
 func (f *Fetcher) probeUHD(ctx context.Context, urlBase string) (string, string) {
-	uhdURL := fmt.Sprintf("https://www.bing.com%s_UHD.jpg", urlBase)
+	host := config.GetConfig().Fetcher.Bing.GetImageHost()
+	fallback := fmt.Sprintf("%s%s_1920x1080.jpg", host, urlBase)
+	uhdURL := fmt.Sprintf("%s%s_UHD.jpg", host, urlBase)
 	req, err := http.NewRequestWithContext(ctx, "HEAD", uhdURL, nil)
 	if err != nil {
-		return fmt.Sprintf("https://www.bing.com%s_1920x1080.jpg", urlBase), "1920x1080"
+		return fallback, "1920x1080"
 	}
-	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36")
+	req.Header.Set("User-Agent", userAgent)
 
-	resp, err := f.httpClient.Do(req)
-	if err == nil && resp.StatusCode == http.StatusOK {
+	var ok bool
+	f.retry(ctx, uhdURL, func() error {
+		resp, err := f.send(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		ok = resp.StatusCode == http.StatusOK
+		return nil
+	})
+	if ok {
 		return uhdURL, "UHD"
 	}
-	return fmt.Sprintf("https://www.bing.com%s_1920x1080.jpg", urlBase), "1920x1080"
-}
-
-func (f *Fetcher) downloadImage(ctx context.Context, url string) ([]byte, error) {
-	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
-	if err != nil {
-		return nil, err
-	}
-	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36")
-
-	resp, err := f.httpClient.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-	return io.ReadAll(resp.Body)
+	return fallback, "1920x1080"
 }
 
 func (f *Fetcher) generateKey(imageName, variant, format string) string {
 	return fmt.Sprintf("%s/%s_%s.%s", imageName, imageName, variant, format)
 }
 
-func (f *Fetcher) saveVariant(ctx context.Context, imageName, variant, format string, data []byte, force bool) error {
+func (f *Fetcher) saveVariant(ctx context.Context, imageName, variant, format string, data []byte, spec string, force bool) error {
+	// 写入区间覆盖对象写入和变体记录，存储迁移切换存储时不会遗漏
+	defer storage.BeginWrite()()
 	key := f.generateKey(imageName, variant, format)
-	contentType := "image/jpeg"
-	if format == "webp" {
-		contentType = "image/webp"
+	store := storage.GlobalStorage()
+
+	var checksum string
+	var previous model.ImageVariant // 内容寻址布局下被覆盖的旧记录，其对象可能需要释放
+
+	if data != nil {
+		checksum = Checksum(data)
+	}
+	if contentAddressed() {
+		if data == nil {
+			return fmt.Errorf("variant %s/%s.%s has no data to address", imageName, variant, format)
+		}
+		err := repo.DB.Where("image_name = ? AND variant = ? AND format = ?", imageName, variant, format).Limit(1).Find(&previous).Error
+		if err != nil {
+			return err
+		}
+		if previous.ID != 0 && !force {
+			return nil
+		}
+		key = ContentKey(checksum, format)
+	}
+
+	if err := f.storeVariant(ctx, store, imageName, variant, format, key, data, spec, checksum, force); err != nil {
+		return err
+	}
+	if previous.StorageKey != "" && previous.StorageKey != key {
+		ReleaseObjects(ctx, []string{previous.StorageKey})
 	}
 
+	util.Logger.Info("Successfully saved ImageVariant record to database",
+		zap.String("image_name", imageName),
+		zap.String("variant", variant),
+		zap.String("format", format))
+
+	return nil
+}
+
+// storeVariant 写入（或复用）对象并保存变体记录。
+// 整个过程持有对象 Key 的锁，避免 ReleaseObjects 在确认对象存在之后、记录落库之前将其删除。
+func (f *Fetcher) storeVariant(ctx context.Context, store storage.Storage, imageName, variant, format, key string, data []byte, spec, checksum string, force bool) error {
+	defer objectLocks.lock(key)()
+
 	var size int64
 	var publicURL string
 
-	exists, _ := storage.GlobalStorage.Exists(ctx, key)
-	if exists && !force {
+	// 内容寻址布局下相同内容只存储一份，对象已存在时直接复用
+	exists, _ := store.Exists(ctx, key)
+	reuse := exists && (!force || contentAddressed())
+
+	if reuse {
 		util.Logger.Debug("Variant already exists in storage, linking", zap.String("key", key))
 		// 如果存在，尝试获取公共 URL
-		if pURL, ok := storage.GlobalStorage.PublicURL(key); ok {
+		if pURL, ok := store.PublicURL(key); ok {
 			publicURL = pURL
 		}
 
@@ -464,7 +722,7 @@ func (f *Fetcher) saveVariant(ctx context.Context, imageName, variant, format st
 		}
 	} else if data != nil {
 		util.Logger.Debug("Saving variant to storage", zap.String("key", key))
-		stored, err := storage.GlobalStorage.Put(ctx, key, bytes.NewReader(data), contentType)
+		stored, err := store.Put(ctx, key, bytes.NewReader(data), ContentTypeForFormat(format))
 		if err != nil {
 			return err
 		}
@@ -481,6 +739,8 @@ func (f *Fetcher) saveVariant(ctx context.Context, imageName, variant, format st
 		StorageKey: key,
 		PublicURL:  publicURL,
 		Size:       size,
+		Spec:       spec,
+		Checksum:   checksum,
 	}
 
 	onConflict := clause.OnConflict{
@@ -494,17 +754,19 @@ func (f *Fetcher) saveVariant(ctx context.Context, imageName, variant, format st
 		}
 	}
 
-	err := repo.DB.Clauses(onConflict).Create(&vRecord).Error
-	if err != nil {
-		return err
-	}
-
-	util.Logger.Info("Successfully saved ImageVariant record to database",
-		zap.String("image_name", imageName),
-		zap.String("variant", variant),
-		zap.String("format", format))
+	return repo.DB.Clauses(onConflict).Create(&vRecord).Error
+}
 
-	return nil
+// SaveVariant 保存一个派生变体（如按需缩放生成的尺寸）并返回落库后的记录，spec 为生成参数指纹（见 DerivedSpec）
+func (f *Fetcher) SaveVariant(ctx context.Context, imageName, variant, format string, data []byte, spec string) (*model.ImageVariant, error) {
+	if err := f.saveVariant(ctx, imageName, variant, format, data, spec, true); err != nil {
+		return nil, err
+	}
+	var record model.ImageVariant
+	if err := repo.DB.Where("image_name = ? AND variant = ? AND format = ?", imageName, variant, format).First(&record).Error; err != nil {
+		return nil, err
+	}
+	return &record, nil
 }
 
 func (f *Fetcher) saveDailyFiles(srcImg image.Image, originalData []byte, mkt string) {
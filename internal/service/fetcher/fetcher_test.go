@@ -1,9 +1,29 @@
 package fetcher
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"image"
+	"image/color"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
+
+	"BingPaper/internal/config"
+	"BingPaper/internal/model"
+	"BingPaper/internal/repo"
+	"BingPaper/internal/storage"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestBuildFetchWindows(t *testing.T) {
@@ -74,3 +94,204 @@ func TestBuildFetchWindows(t *testing.T) {
 		})
 	}
 }
+
+func TestNormalizeFormats(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, []string{"jpg"}, normalizeFormats(nil))
+	assert.Equal(t, []string{"jpg", "webp"}, normalizeFormats([]string{"webp", "JPEG", "webp"}))
+	assert.Equal(t, []string{"jpg", "webp", "avif"}, normalizeFormats([]string{" WebP ", "avif", "gif"}))
+}
+
+func TestEncodeImage(t *testing.T) {
+	t.Parallel()
+
+	img := image.NewRGBA(image.Rect(0, 0, 16, 9))
+	for x := 0; x < 16; x++ {
+		for y := 0; y < 9; y++ {
+			img.Set(x, y, color.RGBA{R: uint8(x * 16), G: uint8(y * 28), B: 128, A: 255})
+		}
+	}
+
+	jpgData, err := EncodeImage(context.Background(), img, FormatJPEG, DefaultQuality)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0xFF, 0xD8}, jpgData[:2])
+
+	// webp 依赖系统中的 cwebp，未安装时应返回 ErrEncoderUnavailable 以便调用方跳过
+	webpData, err := EncodeImage(context.Background(), img, FormatWebP, 80)
+	if errors.Is(err, ErrEncoderUnavailable) {
+		t.Log("cwebp not installed, skipping webp output check")
+	} else {
+		require.NoError(t, err)
+		assert.Equal(t, "RIFF", string(webpData[0:4]))
+		assert.Equal(t, "WEBP", string(webpData[8:12]))
+		assert.Equal(t, "VP8 ", string(webpData[12:16]), "webp should be lossy")
+	}
+
+	_, err = EncodeImage(context.Background(), img, "gif", DefaultQuality)
+	assert.Error(t, err)
+}
+
+func TestEncodeExternal(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not available")
+	}
+	img := image.NewRGBA(image.Rect(0, 0, 4, 4))
+
+	// 外部编码器收到的是无损的 PNG
+	data, err := encodeExternal(context.Background(), img, "sh", "test", func(in, out string) []string {
+		return []string{"-c", `cp "$0" "$1"`, in, out}
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "\x89PNG", string(data[:4]))
+
+	// 编码器卡住时随 ctx 终止
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err = encodeExternal(ctx, img, "sh", "test", func(in, out string) []string {
+		return []string{"-c", "exec sleep 10"}
+	})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), 5*time.Second)
+}
+
+func TestRenderVariant(t *testing.T) {
+	t.Parallel()
+
+	src := image.NewRGBA(image.Rect(0, 0, 400, 200))
+
+	filled := renderVariant(src, config.VariantConfig{Name: "100x100", Width: 100, Height: 100, Anchor: "top-left"})
+	assert.Equal(t, image.Rect(0, 0, 100, 100), filled.Bounds())
+
+	fitted := renderVariant(src, config.VariantConfig{Name: "100x100", Width: 100, Height: 100, Fit: "fit"})
+	assert.Equal(t, image.Rect(0, 0, 100, 50), fitted.Bounds())
+}
+
+func TestVariantQuality(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, DefaultQuality, variantQuality(config.VariantConfig{}))
+	assert.Equal(t, DefaultQuality, variantQuality(config.VariantConfig{Quality: 150}))
+	assert.Equal(t, 80, variantQuality(config.VariantConfig{Quality: 80}))
+}
+
+// bingFixture 用 testdata/bing 中录制的接口响应和样例图片替代 Bing 的本地服务
+type bingFixture struct {
+	*httptest.Server
+	mu       sync.Mutex
+	requests []string // 按顺序记录的 "METHOD path?query"
+}
+
+func newBingFixture(t *testing.T) *bingFixture {
+	t.Helper()
+
+	archive, err := os.ReadFile(filepath.Join("testdata", "bing", "HPImageArchive.json"))
+	require.NoError(t, err)
+	var recorded BingResponse
+	require.NoError(t, json.Unmarshal(archive, &recorded))
+	sample, err := os.ReadFile(filepath.Join("testdata", "bing", "sample_1920x1080.jpg"))
+	require.NoError(t, err)
+
+	known := make(map[string]bool)
+	for _, img := range recorded.Images {
+		known[strings.TrimPrefix(img.URLBase, "/th?id=")] = true
+	}
+
+	fx := &bingFixture{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/HPImageArchive.aspx", func(w http.ResponseWriter, r *http.Request) {
+		idx, _ := strconv.Atoi(r.URL.Query().Get("idx"))
+		n, _ := strconv.Atoi(r.URL.Query().Get("n"))
+		images := recorded.Images[min(idx, len(recorded.Images)):]
+		images = images[:min(n, len(images))]
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(BingResponse{Images: images})
+	})
+	mux.HandleFunc("/th", func(w http.ResponseWriter, r *http.Request) {
+		// 只录制了 1920x1080 的原图，UHD 探测返回 404 以走回退逻辑
+		id, ok := strings.CutSuffix(r.URL.Query().Get("id"), "_1920x1080.jpg")
+		if !ok || !known[id] {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "image/jpeg")
+		w.Write(sample)
+	})
+	fx.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fx.mu.Lock()
+		fx.requests = append(fx.requests, r.Method+" "+r.URL.RequestURI())
+		fx.mu.Unlock()
+		mux.ServeHTTP(w, r)
+	}))
+	t.Cleanup(fx.Close)
+
+	cfg := config.GetConfig()
+	cfg.Fetcher.Bing = config.BingConfig{APIBase: fx.URL + "/HPImageArchive.aspx", ImageHost: fx.URL}
+	cfg.Fetcher.RateLimit.RequestsPerSecond = 0
+	cfg.Fetcher.Retry = config.RetryConfig{MaxAttempts: 2, InitialBackoff: "1ms", MaxBackoff: "1ms"}
+	return fx
+}
+
+func (fx *bingFixture) count(prefix string) int {
+	fx.mu.Lock()
+	defer fx.mu.Unlock()
+	n := 0
+	for _, req := range fx.requests {
+		if strings.HasPrefix(req, prefix) {
+			n++
+		}
+	}
+	return n
+}
+
+func TestFetchWithFixtures(t *testing.T) {
+	setupTestEnv(t)
+	fx := newBingFixture(t)
+
+	cfg := config.GetConfig()
+	cfg.Fetcher.Regions = []string{"zh-CN", "en-US"}
+	cfg.Fetcher.Formats = []string{"jpg"}
+	cfg.Fetcher.Variants = []config.VariantConfig{{Name: "480x270", Width: 480, Height: 270}}
+	cfg.Feature.WriteDailyFiles = false
+
+	f := NewFetcher()
+	report, err := f.Fetch(context.Background(), 2, false)
+	require.NoError(t, err)
+	require.Len(t, report.Regions, 2)
+	for _, region := range report.Regions {
+		assert.Equal(t, 2, region.Fetched, region.Mkt)
+		assert.Zero(t, region.Failed, region.Mkt)
+	}
+	assert.Equal(t, 1, fx.count("GET /HPImageArchive.aspx?format=js&idx=0&n=2&uhd=1&mkt=zh-CN&setlang=zh"))
+
+	var regions []model.ImageRegion
+	require.NoError(t, repo.DB.Order("date desc, mkt asc").Find(&regions).Error)
+	require.Len(t, regions, 4)
+	assert.Equal(t, "2026-01-02", regions[0].Date)
+	assert.Equal(t, "en-US", regions[0].Mkt)
+	assert.Equal(t, "WinterLake", regions[0].ImageName)
+	assert.Equal(t, "A quiet winter morning", regions[0].Title)
+	assert.Equal(t, config.SourceBing, regions[0].Source)
+
+	// 原图直接存储，其余变体按矩阵生成；两个地区共用同一张图片的变体
+	var variants []model.ImageVariant
+	require.NoError(t, repo.DB.Where("image_name = ?", "WinterLake").Order("variant, format").Find(&variants).Error)
+	require.Len(t, variants, 2)
+	sample, err := os.ReadFile(filepath.Join("testdata", "bing", "sample_1920x1080.jpg"))
+	require.NoError(t, err)
+	assert.Equal(t, "1920x1080", variants[0].Variant)
+	assert.Equal(t, Checksum(sample), variants[0].Checksum)
+	for _, v := range variants {
+		exists, err := storage.GlobalStorage().Exists(context.Background(), v.StorageKey)
+		require.NoError(t, err)
+		assert.True(t, exists, v.StorageKey)
+	}
+	assert.Equal(t, 2, fx.count("GET /th?id=OHR."), "each image is downloaded once")
+
+	// 再次抓取时已有记录全部跳过，不再下载图片
+	report, err = f.Fetch(context.Background(), 2, false)
+	require.NoError(t, err)
+	assert.Equal(t, 2, report.Regions[0].Skipped)
+	assert.Equal(t, 2, fx.count("GET /th?id=OHR."))
+}
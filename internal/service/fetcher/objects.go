@@ -0,0 +1,78 @@
+package fetcher
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"BingPaper/internal/config"
+	"BingPaper/internal/model"
+	"BingPaper/internal/repo"
+	"BingPaper/internal/storage"
+	"BingPaper/internal/util"
+
+	"go.uber.org/zap"
+)
+
+// contentKeyPrefix 内容寻址布局下对象 Key 的前缀
+const contentKeyPrefix = "sha256/"
+
+// Checksum 返回数据的 SHA-256 (十六进制)
+func Checksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// ContentKey 返回内容寻址布局下的对象 Key，按哈希前两位分目录避免单目录文件过多
+func ContentKey(checksum, format string) string {
+	return fmt.Sprintf("%s%s/%s.%s", contentKeyPrefix, checksum[:2], checksum, format)
+}
+
+// IsContentKey 判断 Key 是否属于内容寻址布局
+func IsContentKey(key string) bool {
+	return strings.HasPrefix(key, contentKeyPrefix)
+}
+
+// contentAddressed 当前是否使用内容寻址布局
+func contentAddressed() bool {
+	return config.GetConfig().Storage.Layout == config.StorageLayoutContent
+}
+
+// objectLocks 按对象 Key 加锁，保证引用计数检查与删除之间不会有新的变体记录引用该对象
+var objectLocks = &keyedMutex{locks: make(map[string]*keyedLock)}
+
+// ReleaseObjects 删除不再被任何变体记录引用的对象。
+// 内容寻址布局下多个变体可能共用同一对象，因此需要在删除变体记录之后调用。
+func ReleaseObjects(ctx context.Context, keys []string) {
+	seen := make(map[string]bool, len(keys))
+	store := storage.GlobalStorage()
+	for _, key := range keys {
+		if key == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		if _, err := ReleaseObject(ctx, store, key); err != nil {
+			util.Logger.Warn("Failed to release storage object", zap.String("key", key), zap.Error(err))
+		}
+	}
+}
+
+// ReleaseObject 在对象没有被任何变体记录引用时将其删除，返回是否已删除。
+// 检查与删除期间持有对象 Key 的锁，与保存变体互斥。
+func ReleaseObject(ctx context.Context, s storage.Storage, key string) (bool, error) {
+	defer objectLocks.lock(key)()
+
+	var count int64
+	if err := repo.DB.Model(&model.ImageVariant{}).Where("storage_key = ?", key).Count(&count).Error; err != nil {
+		return false, fmt.Errorf("count references: %w", err)
+	}
+	if count > 0 {
+		return false, nil
+	}
+	if err := s.Delete(ctx, key); err != nil {
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,105 @@
+package fetcher
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"BingPaper/internal/config"
+	"BingPaper/internal/model"
+	"BingPaper/internal/repo"
+	"BingPaper/internal/storage"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestContentAddressedLayout(t *testing.T) {
+	setupTestEnv(t)
+	config.GetConfig().Storage.Layout = config.StorageLayoutContent
+	ctx := context.Background()
+	f := &Fetcher{}
+
+	data := testJPEG(t, 32, 18)
+	sum := Checksum(data)
+	key := ContentKey(sum, "jpg")
+	assert.Equal(t, "sha256/"+sum[:2]+"/"+sum+".jpg", key)
+
+	// 相同内容的两个变体共用一个对象
+	a, err := f.SaveVariant(ctx, "ImageA", "UHD", "jpg", data, "")
+	require.NoError(t, err)
+	b, err := f.SaveVariant(ctx, "ImageB", "UHD", "jpg", data, "")
+	require.NoError(t, err)
+	assert.Equal(t, key, a.StorageKey)
+	assert.Equal(t, key, b.StorageKey)
+	assert.Equal(t, sum, a.Checksum)
+	assert.Equal(t, int64(len(data)), b.Size)
+
+	// 非强制保存不会改变已有记录
+	require.NoError(t, f.saveVariant(ctx, "ImageA", "UHD", "jpg", testJPEG(t, 16, 9), "", false))
+	var row model.ImageVariant
+	require.NoError(t, repo.DB.Where("image_name = ?", "ImageA").First(&row).Error)
+	assert.Equal(t, key, row.StorageKey)
+
+	// 内容变化后旧对象仍被 ImageB 引用，不会被删除
+	other := testJPEG(t, 16, 9)
+	a, err = f.SaveVariant(ctx, "ImageA", "UHD", "jpg", other, "")
+	require.NoError(t, err)
+	assert.Equal(t, ContentKey(Checksum(other), "jpg"), a.StorageKey)
+	exists, err := storage.GlobalStorage().Exists(ctx, key)
+	require.NoError(t, err)
+	assert.True(t, exists)
+
+	// 最后一个引用删除后对象被释放
+	require.NoError(t, repo.DB.Where("image_name = ?", "ImageB").Delete(&model.ImageVariant{}).Error)
+	ReleaseObjects(ctx, []string{key, a.StorageKey})
+	exists, err = storage.GlobalStorage().Exists(ctx, key)
+	require.NoError(t, err)
+	assert.False(t, exists)
+	exists, err = storage.GlobalStorage().Exists(ctx, a.StorageKey)
+	require.NoError(t, err)
+	assert.True(t, exists)
+}
+
+func TestReleaseObjectWaitsForConcurrentSave(t *testing.T) {
+	setupTestEnv(t)
+	config.GetConfig().Storage.Layout = config.StorageLayoutContent
+	ctx := context.Background()
+	f := &Fetcher{}
+
+	data := testJPEG(t, 32, 18)
+	key := ContentKey(Checksum(data), "jpg")
+	_, err := storage.GlobalStorage().Put(ctx, key, bytes.NewReader(data), "image/jpeg")
+	require.NoError(t, err)
+
+	// 模拟保存变体期间（已确认对象存在、记录尚未落库）发起的释放
+	unlock := objectLocks.lock(key)
+	released := make(chan bool)
+	go func() {
+		deleted, err := ReleaseObject(ctx, storage.GlobalStorage(), key)
+		assert.NoError(t, err)
+		released <- deleted
+	}()
+	require.NoError(t, repo.DB.Create(&model.ImageVariant{ImageName: "Shared", Variant: "UHD", Format: "jpg", StorageKey: key}).Error)
+	unlock()
+
+	assert.False(t, <-released)
+	exists, err := storage.GlobalStorage().Exists(ctx, key)
+	require.NoError(t, err)
+	assert.True(t, exists)
+
+	// 保存过程本身会获取同一把锁，ReleaseObject 结束后才能复用对象
+	v, err := f.SaveVariant(ctx, "Other", "UHD", "jpg", data, "")
+	require.NoError(t, err)
+	assert.Equal(t, key, v.StorageKey)
+}
+
+func TestNameLayoutRecordsChecksum(t *testing.T) {
+	setupTestEnv(t)
+	data := testJPEG(t, 32, 18)
+
+	v, err := (&Fetcher{}).SaveVariant(context.Background(), "ImageA", "UHD", "jpg", data, "")
+	require.NoError(t, err)
+	assert.Equal(t, "ImageA/ImageA_UHD.jpg", v.StorageKey)
+	assert.Equal(t, Checksum(data), v.Checksum)
+}
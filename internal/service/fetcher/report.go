@@ -0,0 +1,145 @@
+package fetcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"BingPaper/internal/config"
+)
+
+// FetchReport 一次抓取任务的汇总结果，按配置的图片源、地区顺序排列
+type FetchReport struct {
+	Days       int            `json:"days"`
+	Force      bool           `json:"force"`
+	StartedAt  time.Time      `json:"started_at"`
+	FinishedAt time.Time      `json:"finished_at"`
+	Regions    []RegionResult `json:"regions"`
+}
+
+// RegionResult 单个图片源在单个地区的抓取结果
+type RegionResult struct {
+	Source   string `json:"source"`
+	Mkt      string `json:"mkt"`             // 不区分地区的图片源为空
+	Fetched  int    `json:"fetched"`         // 新增或覆盖的图片数
+	Skipped  int    `json:"skipped"`         // 已有记录而跳过的图片数
+	Failed   int    `json:"failed"`          // 处理失败的图片数
+	Error    string `json:"error,omitempty"` // 地区抓取失败的原因
+	Duration string `json:"duration"`
+
+	err error
+}
+
+// Failed 返回失败的地区数
+func (r *FetchReport) Failed() int {
+	n := 0
+	for _, region := range r.Regions {
+		if region.err != nil {
+			n++
+		}
+	}
+	return n
+}
+
+// Err 汇总各地区的错误，全部成功时返回 nil
+func (r *FetchReport) Err() error {
+	var errs []error
+	for _, region := range r.Regions {
+		if region.err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", region.label(), region.err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// label 返回日志中使用的地区标识，非 Bing 图片源带上源名称
+func (r *RegionResult) label() string {
+	if r.Source == "" || r.Source == config.SourceBing {
+		return r.Mkt
+	}
+	if r.Mkt == "" {
+		return r.Source
+	}
+	return r.Source + "/" + r.Mkt
+}
+
+func (r *RegionResult) finish(err error, elapsed time.Duration) {
+	r.err = err
+	if err != nil {
+		r.Error = err.Error()
+	}
+	r.Duration = elapsed.Round(time.Millisecond).String()
+}
+
+// runPool 用最多 workers 个 goroutine 对 [0, n) 依次调用 fn，全部完成后返回。
+// ctx 取消后不再派发新的任务（已开始的任务由 fn 自行响应 ctx），并返回 ctx 的错误。
+func runPool(ctx context.Context, workers, n int, fn func(i int)) error {
+	workers = max(min(workers, n), 1)
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				fn(i)
+			}
+		}()
+	}
+
+	var err error
+dispatch:
+	for i := 0; i < n; i++ {
+		// 优先响应取消，避免与空闲 worker 同时就绪时继续派发
+		if err = ctx.Err(); err != nil {
+			break
+		}
+		select {
+		case next <- i:
+		case <-ctx.Done():
+			err = ctx.Err()
+			break dispatch
+		}
+	}
+	close(next)
+	wg.Wait()
+	return err
+}
+
+// imageLocks 按图片名称加锁，避免并发入库同一张图片时重复下载和生成变体
+var imageLocks = &keyedMutex{locks: make(map[string]*keyedLock)}
+
+type keyedMutex struct {
+	mu    sync.Mutex
+	locks map[string]*keyedLock
+}
+
+type keyedLock struct {
+	mu   sync.Mutex
+	refs int
+}
+
+// lock 获取 key 对应的锁，返回解锁函数；没有等待者的锁会被回收
+func (m *keyedMutex) lock(key string) func() {
+	m.mu.Lock()
+	l, ok := m.locks[key]
+	if !ok {
+		l = &keyedLock{}
+		m.locks[key] = l
+	}
+	l.refs++
+	m.mu.Unlock()
+
+	l.mu.Lock()
+	return func() {
+		l.mu.Unlock()
+		m.mu.Lock()
+		l.refs--
+		if l.refs == 0 {
+			delete(m.locks, key)
+		}
+		m.mu.Unlock()
+	}
+}
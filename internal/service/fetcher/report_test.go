@@ -0,0 +1,121 @@
+package fetcher
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"BingPaper/internal/config"
+	"BingPaper/internal/model"
+	"BingPaper/internal/repo"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunPoolBoundsConcurrency(t *testing.T) {
+	var running, peak, calls atomic.Int32
+	err := runPool(context.Background(), 3, 10, func(i int) {
+		n := running.Add(1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+		running.Add(-1)
+		calls.Add(1)
+	})
+	require.NoError(t, err)
+	assert.Equal(t, int32(10), calls.Load())
+	assert.LessOrEqual(t, peak.Load(), int32(3))
+	assert.Greater(t, peak.Load(), int32(1))
+}
+
+func TestRunPoolStopsOnCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var calls atomic.Int32
+	err := runPool(ctx, 1, 10, func(i int) {
+		if calls.Add(1) == 2 {
+			cancel()
+		}
+	})
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, int32(2), calls.Load())
+}
+
+func TestFetchReportErr(t *testing.T) {
+	report := &FetchReport{Regions: make([]RegionResult, 2)}
+	report.Regions[0].Mkt = "zh-CN"
+	report.Regions[0].finish(nil, 1500*time.Millisecond)
+	report.Regions[1].Mkt = "en-US"
+	report.Regions[1].finish(errors.New("boom"), time.Second)
+
+	assert.Equal(t, "1.5s", report.Regions[0].Duration)
+	assert.Empty(t, report.Regions[0].Error)
+	assert.Equal(t, "boom", report.Regions[1].Error)
+	assert.Equal(t, 1, report.Failed())
+	assert.EqualError(t, report.Err(), "en-US: boom")
+}
+
+func TestRenderVariantsParallel(t *testing.T) {
+	setupTestEnv(t)
+	config.GetConfig().Fetcher.VariantConcurrency = 4
+	config.GetConfig().Fetcher.Formats = []string{"jpg"}
+
+	src, _, err := image.Decode(bytes.NewReader(testJPEG(t, 64, 36)))
+	require.NoError(t, err)
+	variants := []config.VariantConfig{
+		{Name: "32x18", Width: 32, Height: 18},
+		{Name: "16x9", Width: 16, Height: 9},
+		{Name: "18x32", Width: 18, Height: 32},
+		{Name: "8x8", Width: 8, Height: 8},
+		{Name: "4x4", Width: 4, Height: 4},
+	}
+
+	f := &Fetcher{}
+	require.NoError(t, f.renderVariants(context.Background(), "Parallel", src, variants, false))
+
+	var count int64
+	require.NoError(t, repo.DB.Model(&model.ImageVariant{}).Where("image_name = ?", "Parallel").Count(&count).Error)
+	assert.Equal(t, int64(len(variants)), count)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.ErrorIs(t, f.renderVariants(ctx, "Cancelled", src, variants, false), context.Canceled)
+	require.NoError(t, repo.DB.Model(&model.ImageVariant{}).Where("image_name = ?", "Cancelled").Count(&count).Error)
+	assert.Zero(t, count)
+}
+
+func TestKeyedMutex(t *testing.T) {
+	m := &keyedMutex{locks: make(map[string]*keyedLock)}
+
+	unlock := m.lock("a")
+	acquired := make(chan struct{})
+	go func() {
+		defer m.lock("a")()
+		close(acquired)
+	}()
+
+	// 不同的 key 互不阻塞
+	m.lock("b")()
+
+	select {
+	case <-acquired:
+		t.Fatal("same key acquired twice")
+	case <-time.After(20 * time.Millisecond):
+	}
+	unlock()
+	<-acquired
+
+	require.Eventually(t, func() bool {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		return len(m.locks) == 0
+	}, time.Second, 5*time.Millisecond)
+}
@@ -0,0 +1,155 @@
+package fetcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"BingPaper/internal/config"
+	"BingPaper/internal/util"
+
+	"go.uber.org/zap"
+)
+
+// retryableError 可以重试的错误，after 为服务端通过 Retry-After 要求的等待时间
+type retryableError struct {
+	err   error
+	after time.Duration
+}
+
+func (e *retryableError) Error() string { return e.err.Error() }
+func (e *retryableError) Unwrap() error { return e.err }
+
+// retry 执行 op，遇到可重试错误时按指数退避（带随机抖动）重试，并遵循 Retry-After
+func (f *Fetcher) retry(ctx context.Context, what string, op func() error) error {
+	policy := config.GetConfig().Fetcher.Retry
+	attempts := policy.GetMaxAttempts()
+	initial, maxBackoff := policy.GetBackoff()
+
+	for attempt := 1; ; attempt++ {
+		err := op()
+		var re *retryableError
+		if err == nil || !errors.As(err, &re) || attempt >= attempts {
+			return err
+		}
+
+		delay := max(backoff(attempt, initial, maxBackoff), re.after)
+		util.Logger.Warn("Request failed, retrying",
+			zap.String("request", what),
+			zap.Int("attempt", attempt),
+			zap.Duration("delay", delay),
+			zap.Error(err))
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+// backoff 返回第 attempt 次失败后的等待时间：initial * 2^(attempt-1)，不超过 maxBackoff，
+// 并在后一半区间内随机抖动，避免多个地区同时重试
+func backoff(attempt int, initial, maxBackoff time.Duration) time.Duration {
+	d := initial
+	for i := 1; i < attempt && d < maxBackoff; i++ {
+		d *= 2
+	}
+	d = min(d, maxBackoff)
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// parseRetryAfter 解析 Retry-After 头（秒数或 HTTP 日期）
+func parseRetryAfter(v string) time.Duration {
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil && secs > 0 {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return max(time.Until(t), 0)
+	}
+	return 0
+}
+
+// send 经过限速器发送请求。网络错误、429 和 5xx 返回 retryableError，其余响应原样返回
+func (f *Fetcher) send(req *http.Request) (*http.Response, error) {
+	if err := f.limiter.wait(req.Context(), req.URL.Host); err != nil {
+		return nil, err
+	}
+	resp, err := f.httpClient.Do(req)
+	if err != nil {
+		if req.Context().Err() != nil {
+			return nil, err
+		}
+		return nil, &retryableError{err: err}
+	}
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+		resp.Body.Close()
+		return nil, &retryableError{
+			err:   fmt.Errorf("unexpected status %d", resp.StatusCode),
+			after: parseRetryAfter(resp.Header.Get("Retry-After")),
+		}
+	}
+	return resp, nil
+}
+
+// hostLimiter 按主机划分的令牌桶限速器，速率在每次等待时从配置读取
+type hostLimiter struct {
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// sharedLimiter 所有 Fetcher 共享，定时抓取与按需抓取同时进行时也不会叠加请求速率
+var sharedLimiter = &hostLimiter{buckets: make(map[string]*tokenBucket)}
+
+// wait 取得一个令牌，令牌不足时预约并等待，nil 限速器不限速
+func (l *hostLimiter) wait(ctx context.Context, host string) error {
+	if l == nil {
+		return nil
+	}
+	cfg := config.GetConfig().Fetcher.RateLimit
+	if cfg.RequestsPerSecond <= 0 {
+		return nil
+	}
+	burst := float64(max(cfg.Burst, 1))
+
+	l.mu.Lock()
+	now := time.Now()
+	b, ok := l.buckets[host]
+	if !ok {
+		b = &tokenBucket{tokens: burst, last: now}
+		l.buckets[host] = b
+	}
+	b.tokens = min(burst, b.tokens+now.Sub(b.last).Seconds()*cfg.RequestsPerSecond)
+	b.last = now
+	b.tokens--
+	deficit := -b.tokens
+	l.mu.Unlock()
+
+	if deficit <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(time.Duration(deficit / cfg.RequestsPerSecond * float64(time.Second)))
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		// 归还预约的令牌
+		l.mu.Lock()
+		b.tokens++
+		l.mu.Unlock()
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
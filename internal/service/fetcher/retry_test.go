@@ -0,0 +1,121 @@
+package fetcher
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"BingPaper/internal/config"
+	"BingPaper/internal/util"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func setupRetryConfig(t *testing.T) {
+	t.Helper()
+	require.NoError(t, config.Init(""))
+	config.GetConfig().Fetcher.Retry = config.RetryConfig{MaxAttempts: 3, InitialBackoff: "1ms", MaxBackoff: "5ms"}
+	util.Logger = zap.NewNop()
+}
+
+func TestDownloadImageRetries(t *testing.T) {
+	setupRetryConfig(t)
+	jpg := testJPEG(t, 32, 18)
+
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch calls.Add(1) {
+		case 1:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case 2:
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+		default:
+			w.Header().Set("Content-Type", "image/jpeg")
+			w.Write(jpg)
+		}
+	}))
+	defer srv.Close()
+
+	f := &Fetcher{httpClient: srv.Client()}
+	data, err := f.downloadImage(context.Background(), srv.URL)
+	require.NoError(t, err)
+	assert.Equal(t, jpg, data)
+	assert.Equal(t, int32(3), calls.Load())
+}
+
+func TestRetryGivesUp(t *testing.T) {
+	setupRetryConfig(t)
+
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer srv.Close()
+
+	_, err := (&Fetcher{httpClient: srv.Client()}).downloadImage(context.Background(), srv.URL)
+	assert.ErrorContains(t, err, "502")
+	assert.Equal(t, int32(3), calls.Load())
+}
+
+func TestRetrySkipsPermanentErrors(t *testing.T) {
+	setupRetryConfig(t)
+
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		http.NotFound(w, r)
+	}))
+	defer srv.Close()
+
+	_, err := (&Fetcher{httpClient: srv.Client()}).downloadImage(context.Background(), srv.URL)
+	assert.ErrorIs(t, err, ErrInvalidDownload)
+	assert.Equal(t, int32(1), calls.Load())
+}
+
+func TestBackoff(t *testing.T) {
+	for attempt := 1; attempt <= 10; attempt++ {
+		d := backoff(attempt, time.Second, 8*time.Second)
+		expected := min(time.Second<<(attempt-1), 8*time.Second)
+		assert.GreaterOrEqual(t, d, expected/2)
+		assert.LessOrEqual(t, d, expected)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	assert.Equal(t, 5*time.Second, parseRetryAfter("5"))
+	assert.Zero(t, parseRetryAfter(""))
+	assert.Zero(t, parseRetryAfter("soon"))
+	d := parseRetryAfter(time.Now().Add(10 * time.Second).UTC().Format(http.TimeFormat))
+	assert.InDelta(t, 10*time.Second, d, float64(2*time.Second))
+}
+
+func TestHostLimiter(t *testing.T) {
+	setupRetryConfig(t)
+	config.GetConfig().Fetcher.RateLimit = config.RateLimitConfig{RequestsPerSecond: 50, Burst: 2}
+
+	l := &hostLimiter{buckets: make(map[string]*tokenBucket)}
+	ctx := context.Background()
+	start := time.Now()
+	for i := 0; i < 4; i++ {
+		require.NoError(t, l.wait(ctx, "www.bing.com"))
+	}
+	// 突发 2 个之后每 20ms 一个令牌
+	assert.GreaterOrEqual(t, time.Since(start), 35*time.Millisecond)
+
+	// 不同主机互不影响
+	start = time.Now()
+	require.NoError(t, l.wait(ctx, "other.example.com"))
+	assert.Less(t, time.Since(start), 10*time.Millisecond)
+
+	// 取消时归还令牌
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	assert.ErrorIs(t, l.wait(cancelled, "www.bing.com"), context.Canceled)
+}
@@ -0,0 +1,146 @@
+package fetcher
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"BingPaper/internal/config"
+	"BingPaper/internal/util"
+
+	"go.uber.org/zap"
+)
+
+// Source 图片源，负责列出某地区一段日期内的图片并给出原图下载地址。
+// 返回的元数据沿用 BingImage 的字段含义：Enddate 为图片日期 (YYYYMMDD)，
+// URLBase 用于生成图片名称（见 ExtractImageName），需在同一图片源内唯一。
+type Source interface {
+	// Name 图片源名称，写入 ImageRegion.Source
+	Name() string
+	// List 返回 mkt 地区从 idx 天前（0 为今天）开始最多 n 天的图片，不区分地区的图片源可忽略 mkt（见 RegionlessSource）
+	List(ctx context.Context, mkt string, idx, n int) ([]BingImage, error)
+	// Resolve 返回原图下载地址及原图变体名称（如 UHD、1920x1080）。
+	// 变体名称为空时按下载到的图片尺寸命名，且不校验尺寸。
+	Resolve(ctx context.Context, img BingImage) (url, variant string, err error)
+}
+
+// RegionlessSource 可选接口，不区分地区的图片源实现后 Regionless 返回 true，
+// 每次抓取只列出一次图片，再关联到所有配置的地区。
+type RegionlessSource interface {
+	Regionless() bool
+}
+
+func isRegionless(src Source) bool {
+	r, ok := src.(RegionlessSource)
+	return ok && r.Regionless()
+}
+
+// SourceInfo 图片源的展示信息，用于订阅等对外输出
+type SourceInfo struct {
+	Title   string // 展示名称，如 Bing
+	SiteURL string // 图片源站点，用于补全图片元数据中的相对链接（如 Quiz），为空时不补全
+}
+
+// DescribedSource 可选接口，图片源通过 Info 提供展示信息
+type DescribedSource interface {
+	Info() SourceInfo
+}
+
+// LookupSourceInfo 返回指定图片源的展示信息，未知或未实现 DescribedSource 的图片源以名称作为展示名称
+func LookupSourceInfo(name string) SourceInfo {
+	if factory, ok := sourceFactories[name]; ok {
+		if d, ok := factory(nil).(DescribedSource); ok {
+			return d.Info()
+		}
+	}
+	return SourceInfo{Title: name}
+}
+
+// sourceFactories 内置的图片源，通过 fetcher.sources 按名称启用
+var sourceFactories = map[string]func(f *Fetcher) Source{
+	config.SourceBing: func(f *Fetcher) Source { return &bingSource{f: f} },
+}
+
+// Sources 返回 fetcher.sources 中启用的图片源，未知的名称会被忽略
+func (f *Fetcher) Sources() []Source {
+	names := config.GetConfig().Fetcher.Sources
+	if len(names) == 0 {
+		names = []string{config.SourceBing}
+	}
+
+	sources := make([]Source, 0, len(names))
+	for _, name := range names {
+		factory, ok := sourceFactories[name]
+		if !ok {
+			util.Logger.Warn("Skipping unknown image source", zap.String("source", name))
+			continue
+		}
+		sources = append(sources, factory(f))
+	}
+	return sources
+}
+
+// imageNameForSource 返回图片在指定图片源下的名称，非 Bing 图片源加上源名称前缀以免与 Bing 图片重名
+func imageNameForSource(source string, img BingImage) string {
+	name := ExtractImageName(img.URLBase, img.HSH)
+	if source == config.SourceBing || source == "" {
+		return name
+	}
+	return source + "-" + name
+}
+
+// bingSource Bing 每日图片 (HPImageArchive) 图片源
+type bingSource struct {
+	f *Fetcher
+}
+
+func (s *bingSource) Name() string { return config.SourceBing }
+
+func (s *bingSource) Info() SourceInfo {
+	return SourceInfo{Title: "Bing", SiteURL: "https://www.bing.com"}
+}
+
+func (s *bingSource) List(ctx context.Context, mkt string, idx, n int) ([]BingImage, error) {
+	lang := strings.Split(mkt, "-")[0]
+	url := fmt.Sprintf("%s?format=js&idx=%d&n=%d&uhd=1&mkt=%s&setlang=%s", config.GetConfig().Fetcher.Bing.GetAPIBase(), idx, n, mkt, lang)
+	util.Logger.Info("Requesting Bing API", zap.String("url", url))
+
+	var bingResp BingResponse
+	err := s.f.retry(ctx, url, func() error {
+		req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+		if err != nil {
+			return err
+		}
+
+		// 添加请求头以增强地区/语言识别
+		req.Header.Set("Accept-Language", fmt.Sprintf("%s,%s;q=0.9", mkt, lang))
+		req.Header.Set("User-Agent", userAgent)
+
+		resp, err := s.f.send(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+
+		util.Logger.Info("Received response from Bing API", zap.String("mkt", mkt), zap.Int("status", resp.StatusCode))
+
+		bingResp = BingResponse{}
+		if err := json.NewDecoder(resp.Body).Decode(&bingResp); err != nil {
+			// 响应被截断或返回了错误页，可能是暂时性的
+			return &retryableError{err: fmt.Errorf("decode response: %w", err)}
+		}
+		return nil
+	})
+	if err != nil {
+		util.Logger.Error("Failed to request Bing API", zap.String("mkt", mkt), zap.Error(err))
+		return nil, err
+	}
+	return bingResp.Images, nil
+}
+
+func (s *bingSource) Resolve(ctx context.Context, img BingImage) (string, string, error) {
+	url, variant := s.f.probeUHD(ctx, img.URLBase)
+	return url, variant, nil
+}
@@ -0,0 +1,165 @@
+package fetcher
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"BingPaper/internal/config"
+	"BingPaper/internal/model"
+	"BingPaper/internal/repo"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stubSource 返回固定图片的图片源
+type stubSource struct {
+	name       string
+	regionless bool
+	images     []BingImage
+	url        string
+	lists      atomic.Int32
+}
+
+func (s *stubSource) Name() string {
+	if s.name != "" {
+		return s.name
+	}
+	return "stub"
+}
+
+func (s *stubSource) Regionless() bool { return s.regionless }
+
+func (s *stubSource) List(ctx context.Context, mkt string, idx, n int) ([]BingImage, error) {
+	if idx > 0 {
+		return nil, nil
+	}
+	s.lists.Add(1)
+	return s.images, nil
+}
+
+func (s *stubSource) Resolve(ctx context.Context, img BingImage) (string, string, error) {
+	return s.url, "", nil
+}
+
+func TestFetchFromCustomSource(t *testing.T) {
+	setupTestEnv(t)
+	jpg := testJPEG(t, 64, 36)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/jpeg")
+		w.Write(jpg)
+	}))
+	defer srv.Close()
+
+	today := time.Now().Format("20060102")
+	stub := &stubSource{
+		images: []BingImage{{Enddate: today, URLBase: "/th?id=OHR.Nebula_ROW123", Title: "Nebula"}},
+		url:    srv.URL,
+	}
+	sourceFactories["stub"] = func(f *Fetcher) Source { return stub }
+	t.Cleanup(func() { delete(sourceFactories, "stub") })
+
+	cfg := config.GetConfig()
+	cfg.Fetcher.Sources = []string{"stub", "unknown"}
+	cfg.Fetcher.Regions = []string{"zh-CN"}
+	cfg.Fetcher.Formats = []string{"jpg"}
+	cfg.Fetcher.Variants = []config.VariantConfig{{Name: "32x18", Width: 32, Height: 18}}
+	cfg.Storage.Local.Root = t.TempDir()
+
+	// 已有的 Bing 记录不影响其他图片源写入同一天
+	date := time.Now().Format("2006-01-02")
+	require.NoError(t, repo.DB.Create(&model.ImageRegion{Date: date, Mkt: "zh-CN", Source: config.SourceBing, ImageName: "Nebula"}).Error)
+
+	f := &Fetcher{httpClient: srv.Client()}
+	report, err := f.Fetch(context.Background(), 1, false)
+	require.NoError(t, err)
+	require.Len(t, report.Regions, 1)
+	assert.Equal(t, "stub", report.Regions[0].Source)
+	assert.Equal(t, 1, report.Regions[0].Fetched)
+
+	var region model.ImageRegion
+	require.NoError(t, repo.DB.Where("date = ? AND mkt = ? AND source = ?", date, "zh-CN", "stub").First(&region).Error)
+	assert.Equal(t, "stub-Nebula", region.ImageName)
+	assert.Equal(t, "Nebula", region.Title)
+
+	var variants []model.ImageVariant
+	require.NoError(t, repo.DB.Where("image_name = ?", "stub-Nebula").Find(&variants).Error)
+	names := make([]string, 0, len(variants))
+	for _, v := range variants {
+		names = append(names, v.Variant)
+	}
+	assert.ElementsMatch(t, []string{"64x36", "32x18"}, names)
+
+	report, err = f.Fetch(context.Background(), 1, false)
+	require.NoError(t, err)
+	assert.Equal(t, 1, report.Regions[0].Skipped)
+}
+
+func TestFetchRegionlessSource(t *testing.T) {
+	setupTestEnv(t)
+	bing := testJPEG(t, 64, 36)
+	other := testJPEG(t, 48, 27)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/jpeg")
+		if r.URL.Path == "/other" {
+			w.Write(other)
+			return
+		}
+		w.Write(bing)
+	}))
+	defer srv.Close()
+
+	today := time.Now().Format("20060102")
+	def := &stubSource{
+		images: []BingImage{{Enddate: today, URLBase: "/th?id=OHR.Default_ROW1", Title: "Default"}},
+		url:    srv.URL + "/default",
+	}
+	global := &stubSource{
+		name:       "global",
+		regionless: true,
+		images:     []BingImage{{Enddate: today, URLBase: "/th?id=OHR.Global_ROW1", Title: "Global"}},
+		url:        srv.URL + "/other",
+	}
+	sourceFactories["stub"] = func(f *Fetcher) Source { return def }
+	sourceFactories["global"] = func(f *Fetcher) Source { return global }
+	t.Cleanup(func() {
+		delete(sourceFactories, "stub")
+		delete(sourceFactories, "global")
+	})
+
+	root := t.TempDir()
+	cfg := config.GetConfig()
+	cfg.Fetcher.Sources = []string{"stub", "global"}
+	cfg.Fetcher.Regions = []string{"zh-CN", "en-US"}
+	cfg.Fetcher.Formats = []string{"jpg"}
+	cfg.Fetcher.Variants = []config.VariantConfig{{Name: "16x9", Width: 16, Height: 9}}
+	cfg.Storage.Local.Root = root
+	cfg.Feature.WriteDailyFiles = true
+
+	f := &Fetcher{httpClient: srv.Client()}
+	report, err := f.Fetch(context.Background(), 1, false)
+	require.NoError(t, err)
+
+	// 不区分地区的图片源只请求一次，图片关联到每个地区
+	require.Len(t, report.Regions, 3)
+	assert.Equal(t, "global", report.Regions[2].Source)
+	assert.Empty(t, report.Regions[2].Mkt)
+	assert.Equal(t, 2, report.Regions[2].Fetched)
+	assert.Equal(t, int32(1), global.lists.Load())
+	assert.Equal(t, int32(2), def.lists.Load())
+
+	var count int64
+	require.NoError(t, repo.DB.Model(&model.ImageRegion{}).Where("source = ? AND image_name = ?", "global", "global-Global").Count(&count).Error)
+	assert.Equal(t, int64(2), count)
+
+	// 每日文件只来自默认图片源
+	data, err := os.ReadFile(filepath.Join(root, "zh-CN", "original.jpeg"))
+	require.NoError(t, err)
+	assert.Equal(t, bing, data)
+}
@@ -0,0 +1,146 @@
+package fetcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"strings"
+
+	"BingPaper/internal/config"
+	"BingPaper/internal/model"
+	"BingPaper/internal/storage"
+
+	"github.com/disintegration/imaging"
+)
+
+// DefaultQuality 未配置质量时使用的编码质量
+const DefaultQuality = 100
+
+// ErrSourceNotFound 表示找不到可用于派生变体的原图
+var ErrSourceNotFound = errors.New("source image not found")
+
+var anchors = map[string]imaging.Anchor{
+	"center":      imaging.Center,
+	"top":         imaging.Top,
+	"bottom":      imaging.Bottom,
+	"left":        imaging.Left,
+	"right":       imaging.Right,
+	"topleft":     imaging.TopLeft,
+	"topright":    imaging.TopRight,
+	"bottomleft":  imaging.BottomLeft,
+	"bottomright": imaging.BottomRight,
+}
+
+// renderVariant 按变体配置对原图进行缩放/裁剪
+func renderVariant(src image.Image, v config.VariantConfig) image.Image {
+	if strings.EqualFold(v.Fit, "fit") {
+		return imaging.Fit(src, v.Width, v.Height, imaging.Lanczos)
+	}
+	anchor, ok := anchors[strings.ToLower(strings.ReplaceAll(v.Anchor, "-", ""))]
+	if !ok {
+		anchor = imaging.Center
+	}
+	return imaging.Fill(src, v.Width, v.Height, anchor, imaging.Lanczos)
+}
+
+// variantFormats 返回变体需要生成的格式，未单独配置时使用全局 fetcher.formats
+func variantFormats(v config.VariantConfig) []string {
+	if len(v.Formats) > 0 {
+		return availableFormats(normalizeFormats(v.Formats))
+	}
+	return EnabledFormats()
+}
+
+func variantQuality(v config.VariantConfig) int {
+	if v.Quality <= 0 || v.Quality > 100 {
+		return DefaultQuality
+	}
+	return v.Quality
+}
+
+// legacyOriginalVariant 没有 UHD 时旧版本下载的原图名称，旧记录没有参数指纹，需要按名称识别
+const legacyOriginalVariant = "1920x1080"
+
+// SourceVariant 选择用于派生其他变体的原图：优先 UHD 或标记为原图的 jpg 变体（导入的原图可能以实际尺寸命名），
+// 其次旧版本下载的 1920x1080 原图，最后体积最大的 jpg 变体
+func SourceVariant(variants []model.ImageVariant) *model.ImageVariant {
+	var legacy, best *model.ImageVariant
+	for i := range variants {
+		v := &variants[i]
+		if v.Format != FormatJPEG {
+			continue
+		}
+		if v.Variant == "UHD" || v.Spec == originalSpec {
+			return v
+		}
+		if v.Variant == legacyOriginalVariant && v.Spec == "" {
+			legacy = v
+		}
+		if best == nil || v.Size > best.Size {
+			best = v
+		}
+	}
+	if legacy != nil {
+		return legacy
+	}
+	return best
+}
+
+// LoadSourceImage 从存储中读取并解码原图
+func LoadSourceImage(ctx context.Context, variants []model.ImageVariant) (image.Image, *model.ImageVariant, error) {
+	src := SourceVariant(variants)
+	if src == nil {
+		return nil, nil, ErrSourceNotFound
+	}
+
+	reader, _, err := storage.GlobalStorage().Get(ctx, src.StorageKey)
+	if err != nil {
+		return nil, src, fmt.Errorf("failed to read source %s: %w", src.StorageKey, err)
+	}
+	defer reader.Close()
+
+	img, _, err := image.Decode(reader)
+	if err != nil {
+		return nil, src, fmt.Errorf("failed to decode source %s: %w", src.StorageKey, err)
+	}
+	return img, src, nil
+}
+
+// originalSpec 原图变体的生成参数指纹
+const originalSpec = "original"
+
+// DerivedSpec 返回按需缩放生成的变体的参数指纹，width/height 为 0 表示按原图比例推算。
+// 宽高都指定时与相同参数的配置变体一致，变体矩阵加入该尺寸后补齐任务可以直接复用。
+func DerivedSpec(width, height int, fit string) string {
+	if width == 0 || height == 0 {
+		return fmt.Sprintf("%dx%d/resize/q%d", width, height, DefaultQuality)
+	}
+	return variantSpec(config.VariantConfig{Width: width, Height: height, Fit: fit})
+}
+
+// effectiveSpec 返回变体记录的参数指纹。引入指纹之前写入的记录为空，
+// 它们都是从原图以 fill/center/q100 生成的 jpg，按名称中的尺寸推算；无法推算时返回空
+func effectiveSpec(v *model.ImageVariant) string {
+	if v.Spec != "" || v.Format != FormatJPEG {
+		return v.Spec
+	}
+	var w, h int
+	if _, err := fmt.Sscanf(v.Variant, "%dx%d", &w, &h); err != nil || fmt.Sprintf("%dx%d", w, h) != v.Variant {
+		return ""
+	}
+	return variantSpec(config.VariantConfig{Width: w, Height: h})
+}
+
+// variantSpec 返回变体生成参数的指纹，参数变化后已有变体即视为过期
+func variantSpec(v config.VariantConfig) string {
+	fit := strings.ToLower(v.Fit)
+	if fit != "fit" {
+		fit = "fill"
+	}
+	anchor := strings.ToLower(strings.ReplaceAll(v.Anchor, "-", ""))
+	if _, ok := anchors[anchor]; !ok {
+		anchor = "center"
+	}
+	return fmt.Sprintf("%dx%d/%s/%s/q%d", v.Width, v.Height, fit, anchor, variantQuality(v))
+}
@@ -0,0 +1,295 @@
+package fsck
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"BingPaper/internal/model"
+	"BingPaper/internal/repo"
+	"BingPaper/internal/service/fetcher"
+	"BingPaper/internal/service/job"
+	"BingPaper/internal/storage"
+	"BingPaper/internal/util"
+
+	"go.uber.org/zap"
+)
+
+// ErrCheckRunning 表示已有一致性检查任务在运行
+var ErrCheckRunning = errors.New("storage check is already running")
+
+const (
+	StateIdle      = "idle"
+	StateRunning   = "running"
+	StateCompleted = "completed"
+	StateFailed    = "failed"
+)
+
+// orphanGracePeriod 最近写入的对象可能属于尚未落库的变体（抓取时先写存储再写数据库），不视为孤儿
+const orphanGracePeriod = time.Hour
+
+// maxReportedIssues 每类问题在报告中保留的最大条目数，超出部分只计数。
+// 报告整体保存在任务结果中，条目过多会让任务记录和报告接口的响应过大
+const maxReportedIssues = 100
+
+// Options 检查参数
+type Options struct {
+	Repair         bool `json:"repair"`          // 从原图重新生成丢失或大小不一致的变体
+	DeleteOrphans  bool `json:"delete_orphans"`  // 删除没有被任何变体引用的对象
+	VerifyChecksum bool `json:"verify_checksum"` // 读取对象内容并与记录的 SHA-256 比对
+}
+
+// Issue 一条不一致记录
+type Issue struct {
+	Key          string `json:"key"`
+	ImageName    string `json:"image_name,omitempty"`
+	Variant      string `json:"variant,omitempty"`
+	Format       string `json:"format,omitempty"`
+	ExpectedSize int64  `json:"expected_size,omitempty"`
+	ActualSize   int64  `json:"actual_size,omitempty"`
+	Checksum     string `json:"checksum,omitempty"` // 对象实际内容的 SHA-256
+}
+
+// IssueList 问题列表，Count 为实际数量，Items 最多保留 maxReportedIssues 条
+type IssueList struct {
+	Count int     `json:"count"`
+	Items []Issue `json:"items"`
+}
+
+func (l *IssueList) add(i Issue) {
+	l.Count++
+	if len(l.Items) < maxReportedIssues {
+		l.Items = append(l.Items, i)
+	}
+}
+
+// Report 一致性检查报告
+type Report struct {
+	State              string     `json:"state"`
+	Options            Options    `json:"options"`
+	Variants           int        `json:"variants"` // 检查的变体记录数
+	Objects            int        `json:"objects"`  // 存储中的图片对象数
+	Missing            IssueList  `json:"missing"`  // 记录存在但对象丢失
+	SizeMismatches     IssueList  `json:"size_mismatches"`
+	ChecksumMismatches IssueList  `json:"checksum_mismatches"` // 仅在开启 VerifyChecksum 时检查
+	Orphans            IssueList  `json:"orphans"`             // 对象存在但没有被引用
+	Repaired           int        `json:"repaired"`
+	RepairFailed       int        `json:"repair_failed"`
+	OrphansDeleted     int        `json:"orphans_deleted"`
+	LastError          string     `json:"last_error,omitempty"`
+	StartedAt          *time.Time `json:"started_at,omitempty"`
+	FinishedAt         *time.Time `json:"finished_at,omitempty"`
+}
+
+// GetReport 返回当前（或最近一次）检查的报告，报告保存在检查任务的结果中，检查结束后才会写入
+func GetReport() (Report, error) {
+	var report Report
+	j, err := job.Latest(job.TypeFsck, &report)
+	if err != nil || j == nil {
+		return Report{State: StateIdle}, err
+	}
+	switch j.State {
+	case job.StateSucceeded:
+		report.State = StateCompleted
+	case job.StateFailed:
+		report.State = StateFailed
+		report.LastError = j.Error
+	default:
+		report.State = StateRunning
+	}
+	if j.Params != "" && j.Result == "" {
+		_ = json.Unmarshal([]byte(j.Params), &report.Options)
+	}
+	report.StartedAt = j.StartedAt
+	report.FinishedAt = j.FinishedAt
+	return report, nil
+}
+
+// Start 在后台启动一致性检查任务，已有任务运行时返回 ErrCheckRunning
+func Start(opts Options) (*model.Job, error) {
+	j, err := job.SubmitExclusive(job.TypeFsck, opts, func(ctx context.Context) error {
+		report, err := Check(ctx, storage.GlobalStorage(), opts)
+		job.FromContext(ctx).SetResult(report)
+		return err
+	})
+	if errors.Is(err, job.ErrAlreadyRunning) {
+		return nil, ErrCheckRunning
+	}
+	return j, err
+}
+
+// IsManagedKey 判断对象是否为变体对象（Key 形如 <name>/<name>_<variant>.<format>，
+// 或内容寻址布局的 sha256/<xx>/<hash>.<format>）。
+// 本地存储根目录下还有每日文件等其他内容，不符合该格式的对象不参与孤儿判断。
+func IsManagedKey(key string) bool {
+	if fetcher.IsContentKey(key) {
+		return strings.Count(key, "/") == 2
+	}
+	dir, file, ok := strings.Cut(key, "/")
+	return ok && dir != "" && !strings.Contains(file, "/") && strings.HasPrefix(file, dir+"_")
+}
+
+// Check 对比 ImageVariant 记录与存储中的对象，报告丢失、大小不一致和未被引用的对象，并按需修复
+func Check(ctx context.Context, s storage.Storage, opts Options) (Report, error) {
+	report := Report{Options: opts}
+	h := job.FromContext(ctx)
+
+	var variants []model.ImageVariant
+	if err := repo.DB.Select("id", "image_name", "variant", "format", "storage_key", "size", "checksum").Find(&variants).Error; err != nil {
+		return report, err
+	}
+	report.Variants = len(variants)
+
+	objects := make(map[string]storage.ObjectInfo)
+	err := storage.Walk(ctx, s, "", func(obj storage.ObjectInfo) error {
+		if IsManagedKey(obj.Key) {
+			objects[obj.Key] = obj
+		}
+		return nil
+	})
+	if err != nil {
+		return report, fmt.Errorf("failed to list storage: %w", err)
+	}
+	report.Objects = len(objects)
+	h.Logf("Checking %d variants against %d stored objects", len(variants), len(objects))
+
+	referenced := make(map[string]bool, len(variants))
+	broken := make(map[string]bool) // 需要修复的图片名称 -> 是否包含内容损坏（大小或校验和不一致）
+	corrupted := make(map[string]bool)
+	checksums := make(map[string]string) // 已计算的对象校验和，内容寻址布局下多个变体共用对象
+	var brokenOrder []string
+	markBroken := func(name string) {
+		if _, ok := broken[name]; !ok {
+			broken[name] = false
+			brokenOrder = append(brokenOrder, name)
+		}
+	}
+	for _, v := range variants {
+		referenced[v.StorageKey] = true
+		issue := Issue{Key: v.StorageKey, ImageName: v.ImageName, Variant: v.Variant, Format: v.Format, ExpectedSize: v.Size}
+		obj, ok := objects[v.StorageKey]
+		switch {
+		case !ok:
+			report.Missing.add(issue)
+			h.Logf("missing: %s", v.StorageKey)
+			markBroken(v.ImageName)
+		case v.Size > 0 && obj.Size != v.Size:
+			issue.ActualSize = obj.Size
+			report.SizeMismatches.add(issue)
+			h.Logf("size mismatch: %s (expected %d, got %d)", v.StorageKey, v.Size, obj.Size)
+			markBroken(v.ImageName)
+			broken[v.ImageName] = true
+			corrupted[v.StorageKey] = true
+		case opts.VerifyChecksum && v.Checksum != "":
+			sum, ok := checksums[v.StorageKey]
+			if !ok {
+				var err error
+				if sum, err = objectChecksum(ctx, s, v.StorageKey); err != nil {
+					if ctx.Err() != nil {
+						return report, ctx.Err()
+					}
+					h.Logf("[%s] checksum failed: %v", v.StorageKey, err)
+					continue
+				}
+				checksums[v.StorageKey] = sum
+			}
+			if sum != v.Checksum {
+				issue.Checksum = sum
+				report.ChecksumMismatches.add(issue)
+				h.Logf("checksum mismatch: %s", v.StorageKey)
+				markBroken(v.ImageName)
+				broken[v.ImageName] = true
+				corrupted[v.StorageKey] = true
+			}
+		}
+	}
+
+	var orphans []string
+	cutoff := time.Now().Add(-orphanGracePeriod)
+	for key, obj := range objects {
+		if !referenced[key] && (obj.LastModified.IsZero() || obj.LastModified.Before(cutoff)) {
+			orphans = append(orphans, key)
+		}
+	}
+	sort.Strings(orphans)
+	for _, key := range orphans {
+		report.Orphans.add(Issue{Key: key, ActualSize: objects[key].Size})
+		h.Logf("orphan: %s", key)
+	}
+
+	util.Logger.Info("Storage check finished",
+		zap.Int("variants", report.Variants),
+		zap.Int("objects", report.Objects),
+		zap.Int("missing", report.Missing.Count),
+		zap.Int("size_mismatches", report.SizeMismatches.Count),
+		zap.Int("checksum_mismatches", report.ChecksumMismatches.Count),
+		zap.Int("orphans", report.Orphans.Count))
+
+	if opts.Repair {
+		// 内容寻址的对象在重新生成时若已存在会被直接复用，需要先删除损坏的对象
+		for key := range corrupted {
+			if fetcher.IsContentKey(key) {
+				if err := s.Delete(ctx, key); err != nil {
+					util.Logger.Warn("Failed to delete corrupted object", zap.String("key", key), zap.Error(err))
+				}
+			}
+		}
+		f := fetcher.NewFetcher()
+		for _, name := range brokenOrder {
+			if err := ctx.Err(); err != nil {
+				return report, err
+			}
+			// 损坏的对象仍然存在，需要强制重新生成才能覆盖
+			_, _, err := f.RepairVariants(ctx, name, fetcher.BackfillOptions{VerifyStorage: true, Force: broken[name]})
+			if err != nil {
+				report.RepairFailed++
+				util.Logger.Error("Failed to repair variants", zap.String("image_name", name), zap.Error(err))
+				h.Logf("[%s] repair failed: %v", name, err)
+				continue
+			}
+			report.Repaired++
+		}
+	}
+
+	if opts.DeleteOrphans {
+		for _, key := range orphans {
+			if err := ctx.Err(); err != nil {
+				return report, err
+			}
+			// 检查之后可能有新的变体引用了该对象（内容寻址布局下相同内容会复用对象），删除前重新确认
+			deleted, err := fetcher.ReleaseObject(ctx, s, key)
+			if err != nil {
+				util.Logger.Warn("Failed to delete orphan object", zap.String("key", key), zap.Error(err))
+				h.Logf("[%s] delete failed: %v", key, err)
+				continue
+			}
+			if deleted {
+				report.OrphansDeleted++
+			}
+		}
+	}
+
+	return report, nil
+}
+
+// objectChecksum 读取对象并计算 SHA-256
+func objectChecksum(ctx context.Context, s storage.Storage, key string) (string, error) {
+	reader, _, err := s.Get(ctx, key)
+	if err != nil {
+		return "", err
+	}
+	defer reader.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, reader); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
@@ -0,0 +1,180 @@
+package fsck
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"BingPaper/internal/config"
+	"BingPaper/internal/model"
+	"BingPaper/internal/repo"
+	"BingPaper/internal/service/fetcher"
+	"BingPaper/internal/storage"
+	"BingPaper/internal/storage/local"
+	"BingPaper/internal/util"
+
+	"github.com/glebarez/sqlite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+func testJPEG(t *testing.T, w, h int) []byte {
+	t.Helper()
+
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for x := 0; x < w; x++ {
+		for y := 0; y < h; y++ {
+			img.Set(x, y, color.RGBA{R: uint8(x), G: uint8(y), B: 64, A: 255})
+		}
+	}
+	buf := new(bytes.Buffer)
+	require.NoError(t, jpeg.Encode(buf, img, &jpeg.Options{Quality: 90}))
+	return buf.Bytes()
+}
+
+func TestIsManagedKey(t *testing.T) {
+	assert.True(t, IsManagedKey("Milwaukee/Milwaukee_UHD.jpg"))
+	assert.True(t, IsManagedKey("Milwaukee/Milwaukee_1920x1080.webp"))
+	assert.False(t, IsManagedKey("daily.jpeg"))
+	assert.False(t, IsManagedKey("zh-CN/daily.jpeg"))
+	assert.False(t, IsManagedKey("A/B/A_UHD.jpg"))
+}
+
+func TestIssueListCapsItems(t *testing.T) {
+	var l IssueList
+	for i := 0; i < maxReportedIssues+5; i++ {
+		l.add(Issue{Key: fmt.Sprintf("k%d", i)})
+	}
+	assert.Equal(t, maxReportedIssues+5, l.Count)
+	assert.Len(t, l.Items, maxReportedIssues)
+	assert.Equal(t, "k0", l.Items[0].Key)
+}
+
+func TestCheckAndRepair(t *testing.T) {
+	require.NoError(t, config.Init(""))
+	config.GetConfig().Fetcher.Formats = []string{"jpg"}
+	config.GetConfig().Fetcher.Variants = []config.VariantConfig{{Name: "32x18", Width: 32, Height: 18}}
+	util.Logger = zap.NewNop()
+
+	db, err := gorm.Open(sqlite.Open(fmt.Sprintf("file:%s?mode=memory&cache=shared", t.Name())), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, repo.AutoMigrateModels(db))
+	repo.DB = db
+
+	root := t.TempDir()
+	s, err := local.NewLocalStorage(root)
+	require.NoError(t, err)
+	storage.SetGlobalStorage(s)
+
+	ctx := context.Background()
+	f := &fetcher.Fetcher{}
+	for _, name := range []string{"Missing", "Mismatch"} {
+		_, err := f.SaveVariant(ctx, name, "UHD", "jpg", testJPEG(t, 64, 36), "")
+		require.NoError(t, err)
+		_, err = f.SaveVariant(ctx, name, "32x18", "jpg", testJPEG(t, 32, 18), "")
+		require.NoError(t, err)
+	}
+	require.NoError(t, s.Delete(ctx, "Missing/Missing_32x18.jpg"))
+	require.NoError(t, db.Model(&model.ImageVariant{}).Where("storage_key = ?", "Mismatch/Mismatch_32x18.jpg").Update("size", 1).Error)
+
+	// 孤儿对象：过期的会被报告，最近写入的以及非变体文件会被忽略
+	_, err = s.Put(ctx, "Gone/Gone_UHD.jpg", strings.NewReader("orphan"), "image/jpeg")
+	require.NoError(t, err)
+	old := time.Now().Add(-2 * time.Hour)
+	require.NoError(t, os.Chtimes(filepath.Join(root, "Gone", "Gone_UHD.jpg"), old, old))
+	_, err = s.Put(ctx, "Fresh/Fresh_UHD.jpg", strings.NewReader("in flight"), "image/jpeg")
+	require.NoError(t, err)
+	_, err = s.Put(ctx, "zh-CN/daily.jpeg", strings.NewReader("daily"), "image/jpeg")
+	require.NoError(t, err)
+
+	report, err := Check(ctx, s, Options{})
+	require.NoError(t, err)
+	assert.Equal(t, 4, report.Variants)
+	assert.Equal(t, 5, report.Objects)
+	require.Equal(t, 1, report.Missing.Count)
+	assert.Equal(t, "Missing/Missing_32x18.jpg", report.Missing.Items[0].Key)
+	require.Equal(t, 1, report.SizeMismatches.Count)
+	assert.Equal(t, int64(1), report.SizeMismatches.Items[0].ExpectedSize)
+	require.Equal(t, 1, report.Orphans.Count)
+	assert.Equal(t, "Gone/Gone_UHD.jpg", report.Orphans.Items[0].Key)
+
+	report, err = Check(ctx, s, Options{Repair: true, DeleteOrphans: true})
+	require.NoError(t, err)
+	assert.Equal(t, 2, report.Repaired)
+	assert.Equal(t, 1, report.OrphansDeleted)
+
+	report, err = Check(ctx, s, Options{})
+	require.NoError(t, err)
+	assert.Zero(t, report.Missing.Count)
+	assert.Zero(t, report.SizeMismatches.Count)
+	assert.Zero(t, report.Orphans.Count)
+	exists, err := s.Exists(ctx, "zh-CN/daily.jpeg")
+	require.NoError(t, err)
+	assert.True(t, exists)
+
+	// 通过任务运行时，报告保存在任务结果中
+	_, err = Start(Options{VerifyChecksum: true})
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		report, err = GetReport()
+		return err == nil && report.State == StateCompleted
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, 4, report.Variants)
+	assert.True(t, report.Options.VerifyChecksum)
+	assert.NotNil(t, report.FinishedAt)
+}
+
+func TestVerifyChecksum(t *testing.T) {
+	require.NoError(t, config.Init(""))
+	config.GetConfig().Storage.Layout = config.StorageLayoutContent
+	config.GetConfig().Fetcher.Formats = []string{"jpg"}
+	config.GetConfig().Fetcher.Variants = []config.VariantConfig{{Name: "32x18", Width: 32, Height: 18}}
+	util.Logger = zap.NewNop()
+
+	db, err := gorm.Open(sqlite.Open(fmt.Sprintf("file:%s?mode=memory&cache=shared", t.Name())), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, repo.AutoMigrateModels(db))
+	repo.DB = db
+
+	root := t.TempDir()
+	s, err := local.NewLocalStorage(root)
+	require.NoError(t, err)
+	storage.SetGlobalStorage(s)
+
+	ctx := context.Background()
+	f := &fetcher.Fetcher{}
+	_, err = f.SaveVariant(ctx, "Img", "UHD", "jpg", testJPEG(t, 64, 36), "")
+	require.NoError(t, err)
+	small, err := f.SaveVariant(ctx, "Img", "32x18", "jpg", testJPEG(t, 32, 18), "")
+	require.NoError(t, err)
+	assert.True(t, IsManagedKey(small.StorageKey))
+
+	// 同样大小但内容被篡改
+	corrupt := []byte(strings.Repeat("x", int(small.Size)))
+	require.NoError(t, os.WriteFile(filepath.Join(root, filepath.FromSlash(small.StorageKey)), corrupt, 0644))
+
+	report, err := Check(ctx, s, Options{})
+	require.NoError(t, err)
+	assert.Zero(t, report.ChecksumMismatches.Count)
+
+	report, err = Check(ctx, s, Options{VerifyChecksum: true, Repair: true})
+	require.NoError(t, err)
+	require.Equal(t, 1, report.ChecksumMismatches.Count)
+	assert.Equal(t, small.StorageKey, report.ChecksumMismatches.Items[0].Key)
+	assert.Equal(t, 1, report.Repaired)
+
+	report, err = Check(ctx, s, Options{VerifyChecksum: true})
+	require.NoError(t, err)
+	assert.Zero(t, report.ChecksumMismatches.Count)
+	assert.Zero(t, report.Missing.Count)
+}
@@ -11,7 +11,8 @@ import (
 	"BingPaper/internal/model"
 	"BingPaper/internal/repo"
 	"BingPaper/internal/service/fetcher"
-	"BingPaper/internal/storage"
+	"BingPaper/internal/service/job"
+	"BingPaper/internal/service/webhook"
 	"BingPaper/internal/util"
 
 	"go.uber.org/zap"
@@ -20,7 +21,25 @@ import (
 
 var ErrFetchStarted = errors.New("on-demand fetch started")
 
+// pruneJobs 按 retention.job_days 删除过期的任务记录
+func pruneJobs(ctx context.Context) {
+	jobDays := config.GetConfig().Retention.JobDays
+	if jobDays <= 0 {
+		return
+	}
+	n, err := job.Prune(time.Now().AddDate(0, 0, -jobDays))
+	if err != nil {
+		util.Logger.Error("Failed to prune old jobs", zap.Error(err))
+		return
+	}
+	if n > 0 {
+		job.FromContext(ctx).Logf("deleted %d job record(s) older than %d day(s)", n, jobDays)
+	}
+}
+
 func CleanupOldImages(ctx context.Context) error {
+	pruneJobs(ctx)
+
 	days := config.GetConfig().Retention.Days
 	if days <= 0 {
 		return nil
@@ -35,7 +54,13 @@ func CleanupOldImages(ctx context.Context) error {
 		return err
 	}
 
+	h := job.FromContext(ctx)
+	h.SetTotal(len(regionRecords))
+	h.Logf("retention %d day(s), deleting %d record(s) older than %s", days, len(regionRecords), threshold)
+
+	deletedImages := 0
 	for _, m := range regionRecords {
+		h.Advance(1)
 		util.Logger.Info("Deleting old image region record", zap.String("date", m.Date), zap.String("mkt", m.Mkt))
 
 		// 检查该图片名是否还有其他地区或日期在使用
@@ -43,15 +68,18 @@ func CleanupOldImages(ctx context.Context) error {
 		repo.DB.Model(&model.ImageRegion{}).Where("image_name = ? AND id != ?", m.ImageName, m.ID).Count(&count)
 
 		if count == 0 {
+			h.Logf("[%s] %s deleted with %d variant(s)", m.Mkt, m.ImageName, len(m.Variants))
+			deletedImages++
 			util.Logger.Info("Image content no longer referenced, deleting files and variants", zap.String("image_name", m.ImageName))
-			for _, v := range m.Variants {
-				if err := storage.GlobalStorage.Delete(ctx, v.StorageKey); err != nil {
-					util.Logger.Warn("Failed to delete storage object", zap.String("key", v.StorageKey), zap.Error(err))
-				}
-			}
-			// 删除变体记录
+			// 先删除变体记录，再释放不再被引用的对象（内容寻址布局下对象可能被其他图片共用）
 			if err := repo.DB.Where("image_name = ?", m.ImageName).Delete(&model.ImageVariant{}).Error; err != nil {
 				util.Logger.Error("Failed to delete variants", zap.String("image_name", m.ImageName), zap.Error(err))
+			} else {
+				keys := make([]string, 0, len(m.Variants))
+				for _, v := range m.Variants {
+					keys = append(keys, v.StorageKey)
+				}
+				fetcher.ReleaseObjects(ctx, keys)
 			}
 		}
 
@@ -62,34 +90,42 @@ func CleanupOldImages(ctx context.Context) error {
 	}
 
 	util.Logger.Info("Cleanup task completed", zap.Int("deleted_count", len(regionRecords)))
+	webhook.Dispatch(webhook.EventCleanupCompleted, "", map[string]interface{}{
+		"retention_days":  days,
+		"threshold":       threshold,
+		"deleted_regions": len(regionRecords),
+		"deleted_images":  deletedImages,
+	})
 	return nil
 }
 
-func GetTodayImage(mkt string) (*model.ImageRegion, error) {
+// GetTodayImage 获取指定地区、图片源的今日图片，source 为空时使用默认图片源
+func GetTodayImage(mkt, source string) (*model.ImageRegion, error) {
 	if mkt == "" {
 		mkt = config.GetConfig().GetDefaultRegion()
 	}
+	if source == "" {
+		source = config.GetConfig().GetDefaultSource()
+	}
 	today := time.Now().Format("2006-01-02")
 	util.Logger.Debug("Getting today image", zap.String("mkt", mkt), zap.String("today", today))
 	var imgRegion model.ImageRegion
-	tx := repo.DB.Where("date = ? AND mkt = ?", today, mkt)
+	tx := repo.DB.Where("date = ? AND mkt = ? AND source = ?", today, mkt, source)
 	err := tx.Preload("Variants", func(db *gorm.DB) *gorm.DB {
 		return db.Order("size asc")
 	}).First(&imgRegion).Error
-	if err != nil && config.GetConfig().API.EnableOnDemandFetch && util.IsValidRegion(mkt) {
+	if err != nil && onDemandAllowed(mkt, source) {
 		// 如果没找到，尝试异步按需抓取该地区
-		util.Logger.Info("Image not found in DB, starting asynchronous on-demand fetch", zap.String("mkt", mkt))
-		f := fetcher.NewFetcher()
-		go func() {
-			_ = f.FetchRegion(context.Background(), mkt, false)
-		}()
-		return nil, ErrFetchStarted
+		util.Logger.Info("Image not found in DB, requesting asynchronous on-demand fetch", zap.String("mkt", mkt))
+		if started := requestOnDemandFetch(mkt, today); started != nil {
+			return nil, started
+		}
 	}
 
 	if err != nil {
 		util.Logger.Debug("Today image not found, trying latest image", zap.String("mkt", mkt))
 		// 如果今天还是没有，尝试获取最近的一张
-		err = repo.DB.Where("mkt = ?", mkt).Order("date desc").Preload("Variants", func(db *gorm.DB) *gorm.DB {
+		err = repo.DB.Where("mkt = ? AND source = ?", mkt, source).Order("date desc").Preload("Variants", func(db *gorm.DB) *gorm.DB {
 			return db.Order("size asc")
 		}).First(&imgRegion).Error
 	}
@@ -99,7 +135,7 @@ func GetTodayImage(mkt string) (*model.ImageRegion, error) {
 		defaultMkt := config.GetConfig().GetDefaultRegion()
 		util.Logger.Debug("Image not found, trying fallback to default region", zap.String("mkt", mkt), zap.String("defaultMkt", defaultMkt))
 		if mkt != defaultMkt {
-			return GetTodayImage(defaultMkt)
+			return GetTodayImage(defaultMkt, source)
 		}
 	}
 
@@ -109,6 +145,7 @@ func GetTodayImage(mkt string) (*model.ImageRegion, error) {
 	return &imgRegion, err
 }
 
+// GetAllRegionsTodayImages 获取默认图片源下所有已开启地区的今日图片
 func GetAllRegionsTodayImages() ([]model.ImageRegion, error) {
 	today := time.Now().Format("2006-01-02")
 	regions := config.GetConfig().Fetcher.Regions
@@ -117,7 +154,7 @@ func GetAllRegionsTodayImages() ([]model.ImageRegion, error) {
 	}
 
 	var images []model.ImageRegion
-	err := repo.DB.Where("date = ? AND mkt IN ?", today, regions).
+	err := repo.DB.Where("date = ? AND mkt IN ? AND source = ?", today, regions, config.GetConfig().GetDefaultSource()).
 		Preload("Variants", func(db *gorm.DB) *gorm.DB {
 			return db.Order("size asc")
 		}).Find(&images).Error
@@ -142,22 +179,24 @@ func GetAllRegionsTodayImages() ([]model.ImageRegion, error) {
 	return sortedImages, nil
 }
 
-func GetRandomImage(mkt string) (*model.ImageRegion, error) {
+// GetRandomImage 随机获取指定地区、图片源的一张图片，source 为空时使用默认图片源
+func GetRandomImage(mkt, source string) (*model.ImageRegion, error) {
 	if mkt == "" {
 		mkt = config.GetConfig().GetDefaultRegion()
 	}
+	if source == "" {
+		source = config.GetConfig().GetDefaultSource()
+	}
 	util.Logger.Debug("Getting random image", zap.String("mkt", mkt))
 	var imgRegion model.ImageRegion
 	var count int64
-	tx := repo.DB.Model(&model.ImageRegion{}).Where("mkt = ?", mkt)
+	tx := repo.DB.Model(&model.ImageRegion{}).Where("mkt = ? AND source = ?", mkt, source)
 	tx.Count(&count)
-	if count == 0 && config.GetConfig().API.EnableOnDemandFetch && util.IsValidRegion(mkt) {
-		util.Logger.Info("No images found in DB for region, starting asynchronous on-demand fetch", zap.String("mkt", mkt))
-		f := fetcher.NewFetcher()
-		go func() {
-			_ = f.FetchRegion(context.Background(), mkt, false)
-		}()
-		return nil, ErrFetchStarted
+	if count == 0 && onDemandAllowed(mkt, source) {
+		util.Logger.Info("No images found in DB for region, requesting asynchronous on-demand fetch", zap.String("mkt", mkt))
+		if started := requestOnDemandFetch(mkt, ""); started != nil {
+			return nil, started
+		}
 	}
 
 	if count == 0 {
@@ -174,7 +213,7 @@ func GetRandomImage(mkt string) (*model.ImageRegion, error) {
 		defaultMkt := config.GetConfig().GetDefaultRegion()
 		util.Logger.Debug("Random image not found, trying fallback", zap.String("mkt", mkt), zap.String("defaultMkt", defaultMkt))
 		if mkt != defaultMkt {
-			return GetRandomImage(defaultMkt)
+			return GetRandomImage(defaultMkt, source)
 		}
 	}
 
@@ -185,40 +224,46 @@ func GetRandomImage(mkt string) (*model.ImageRegion, error) {
 	return &imgRegion, err
 }
 
-func GetImageByDate(date string, mkt string) (*model.ImageRegion, error) {
+// GetImageByDate 获取指定日期、地区、图片源的图片，source 为空时使用默认图片源
+func GetImageByDate(date, mkt, source string) (*model.ImageRegion, error) {
 	if mkt == "" {
 		mkt = config.GetConfig().GetDefaultRegion()
 	}
+	if source == "" {
+		source = config.GetConfig().GetDefaultSource()
+	}
 	util.Logger.Debug("Getting image by date", zap.String("date", date), zap.String("mkt", mkt))
 	var imgRegion model.ImageRegion
-	err := repo.DB.Where("date = ? AND mkt = ?", date, mkt).Preload("Variants", func(db *gorm.DB) *gorm.DB {
+	err := repo.DB.Where("date = ? AND mkt = ? AND source = ?", date, mkt, source).Preload("Variants", func(db *gorm.DB) *gorm.DB {
 		return db.Order("size asc")
 	}).First(&imgRegion).Error
-	if err != nil && config.GetConfig().API.EnableOnDemandFetch && util.IsValidRegion(mkt) {
-		util.Logger.Info("Image not found in DB for date, starting asynchronous on-demand fetch", zap.String("mkt", mkt), zap.String("date", date))
-		f := fetcher.NewFetcher()
-		go func() {
-			_ = f.FetchRegion(context.Background(), mkt, false)
-		}()
-		return nil, ErrFetchStarted
+	if err != nil && onDemandAllowed(mkt, source) {
+		util.Logger.Info("Image not found in DB for date, requesting asynchronous on-demand fetch", zap.String("mkt", mkt), zap.String("date", date))
+		if started := requestOnDemandFetch(mkt, date); started != nil {
+			return nil, started
+		}
 	}
 
 	if err != nil && config.GetConfig().API.EnableMktFallback {
 		defaultMkt := config.GetConfig().GetDefaultRegion()
 		if mkt != defaultMkt {
-			return GetImageByDate(date, defaultMkt)
+			return GetImageByDate(date, defaultMkt, source)
 		}
 	}
 
 	return &imgRegion, err
 }
 
-func GetImageList(limit int, offset int, month string, mkt string) ([]model.ImageRegion, error) {
+// GetImageList 按日期倒序列出指定地区、图片源的图片，source 为空时使用默认图片源
+func GetImageList(limit int, offset int, month string, mkt string, source string) ([]model.ImageRegion, error) {
 	if mkt == "" {
 		mkt = config.GetConfig().GetDefaultRegion()
 	}
+	if source == "" {
+		source = config.GetConfig().GetDefaultSource()
+	}
 	var images []model.ImageRegion
-	tx := repo.DB.Model(&model.ImageRegion{}).Where("mkt = ?", mkt)
+	tx := repo.DB.Model(&model.ImageRegion{}).Where("mkt = ? AND source = ?", mkt, source)
 
 	if month != "" {
 		tx = tx.Where("date LIKE ?", month+"%")
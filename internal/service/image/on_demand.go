@@ -0,0 +1,109 @@
+package image
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"BingPaper/internal/config"
+	"BingPaper/internal/service/fetcher"
+	"BingPaper/internal/service/job"
+	"BingPaper/internal/util"
+
+	"go.uber.org/zap"
+)
+
+// FetchStartedError 表示请求的图片正在按需抓取中，携带负责抓取的任务 ID。
+// errors.Is(err, ErrFetchStarted) 对其成立。
+type FetchStartedError struct {
+	Mkt   string
+	JobID uint
+}
+
+func (e *FetchStartedError) Error() string {
+	return fmt.Sprintf("on-demand fetch started for region %s (job %d)", e.Mkt, e.JobID)
+}
+
+func (e *FetchStartedError) Is(target error) bool {
+	return target == ErrFetchStarted
+}
+
+// onDemandFetch 正在运行的按需抓取任务，keys 记录搭车等待该任务的 地区|日期
+type onDemandFetch struct {
+	jobID uint
+	keys  map[string]struct{}
+}
+
+var (
+	onDemandMu sync.Mutex
+	// onDemandRunning 按地区记录正在运行的抓取任务，一次地区抓取会覆盖 Bing 回溯窗口内的所有日期
+	onDemandRunning = map[string]*onDemandFetch{}
+	// onDemandMisses 记录 地区|日期 最近一次按需抓取结束的时间，用于冷却
+	onDemandMisses = map[string]time.Time{}
+	// fetchRegion 执行地区抓取，测试中可替换
+	fetchRegion = func(ctx context.Context, mkt string) error {
+		return fetcher.NewFetcher().FetchRegion(ctx, mkt, false)
+	}
+)
+
+// onDemandAllowed 判断是否可以为缺失的图片触发按需抓取，按需抓取只访问 Bing
+func onDemandAllowed(mkt, source string) bool {
+	return config.GetConfig().API.EnableOnDemandFetch && source == config.SourceBing && util.IsValidRegion(mkt)
+}
+
+// requestOnDemandFetch 为缺失的 地区/日期 请求按需抓取。
+// 同一地区已有抓取在运行时直接复用该任务；该 地区/日期 上次抓取结束后仍处于冷却期时返回 nil，
+// 调用方应按未开启按需抓取的逻辑继续处理。
+func requestOnDemandFetch(mkt, date string) *FetchStartedError {
+	key := mkt + "|" + date
+
+	onDemandMu.Lock()
+	defer onDemandMu.Unlock()
+
+	if running, ok := onDemandRunning[mkt]; ok {
+		running.keys[key] = struct{}{}
+		return &FetchStartedError{Mkt: mkt, JobID: running.jobID}
+	}
+
+	cooldown := config.GetOnDemandFetchCooldown()
+	now := time.Now()
+	for k, t := range onDemandMisses {
+		if now.Sub(t) >= cooldown {
+			delete(onDemandMisses, k)
+		}
+	}
+	if _, ok := onDemandMisses[key]; ok {
+		util.Logger.Debug("On-demand fetch is cooling down", zap.String("mkt", mkt), zap.String("date", date))
+		return nil
+	}
+
+	params := map[string]string{"mkt": mkt}
+	if date != "" {
+		params["date"] = date
+	}
+	running := &onDemandFetch{keys: map[string]struct{}{key: {}}}
+	j, err := job.Submit(job.TypeOnDemandFetch, params, func(ctx context.Context) error {
+		// 任务结束后释放地区占用，并为等待过的 地区/日期 开始冷却；
+		// 若抓取成功，后续请求会直接命中数据库，不会再查询冷却记录
+		defer func() {
+			onDemandMu.Lock()
+			defer onDemandMu.Unlock()
+			delete(onDemandRunning, mkt)
+			finished := time.Now()
+			for k := range running.keys {
+				onDemandMisses[k] = finished
+			}
+		}()
+		return fetchRegion(ctx, mkt)
+	})
+	if err != nil {
+		util.Logger.Error("Failed to submit on-demand fetch job", zap.String("mkt", mkt), zap.Error(err))
+		return nil
+	}
+	running.jobID = j.ID
+	onDemandRunning[mkt] = running
+
+	util.Logger.Info("On-demand fetch job submitted", zap.String("mkt", mkt), zap.String("date", date), zap.Uint("job_id", j.ID))
+	return &FetchStartedError{Mkt: mkt, JobID: j.ID}
+}
@@ -0,0 +1,148 @@
+package image
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"BingPaper/internal/config"
+	"BingPaper/internal/model"
+	"BingPaper/internal/repo"
+	"BingPaper/internal/util"
+
+	"github.com/glebarez/sqlite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+func setupOnDemandTest(t *testing.T, fetch func(ctx context.Context, mkt string) error) {
+	t.Helper()
+
+	require.NoError(t, config.Init(""))
+	util.Logger = zap.NewNop()
+
+	db, err := gorm.Open(sqlite.Open(fmt.Sprintf("file:%s?mode=memory&cache=shared", t.Name())), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, repo.AutoMigrateModels(db))
+	repo.DB = db
+
+	origFetch := fetchRegion
+	fetchRegion = fetch
+	onDemandRunning = map[string]*onDemandFetch{}
+	onDemandMisses = map[string]time.Time{}
+	t.Cleanup(func() { fetchRegion = origFetch })
+}
+
+func waitOnDemandIdle(t *testing.T, mkt string) {
+	t.Helper()
+	require.Eventually(t, func() bool {
+		onDemandMu.Lock()
+		defer onDemandMu.Unlock()
+		_, running := onDemandRunning[mkt]
+		return !running
+	}, 2*time.Second, 10*time.Millisecond)
+}
+
+func TestRequestOnDemandFetchDeduplicates(t *testing.T) {
+	var calls atomic.Int32
+	release := make(chan struct{})
+	setupOnDemandTest(t, func(ctx context.Context, mkt string) error {
+		calls.Add(1)
+		<-release
+		return nil
+	})
+
+	var wg sync.WaitGroup
+	ids := make([]uint, 50)
+	for i := range ids {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			date := ""
+			if i%2 == 0 {
+				date = "2024-01-01"
+			}
+			if started := requestOnDemandFetch("en-US", date); started != nil {
+				ids[i] = started.JobID
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	for _, id := range ids {
+		assert.NotZero(t, id)
+		assert.Equal(t, ids[0], id)
+	}
+
+	other := requestOnDemandFetch("ja-JP", "")
+	require.NotNil(t, other)
+	assert.NotEqual(t, ids[0], other.JobID)
+
+	close(release)
+	waitOnDemandIdle(t, "en-US")
+	waitOnDemandIdle(t, "ja-JP")
+	assert.Equal(t, int32(2), calls.Load())
+}
+
+func TestRequestOnDemandFetchCooldown(t *testing.T) {
+	var calls atomic.Int32
+	setupOnDemandTest(t, func(ctx context.Context, mkt string) error {
+		calls.Add(1)
+		return nil
+	})
+
+	first := requestOnDemandFetch("de-DE", "2024-01-01")
+	require.NotNil(t, first)
+	assert.True(t, errors.Is(first, ErrFetchStarted))
+	waitOnDemandIdle(t, "de-DE")
+
+	// 冷却期内同一地区/日期不再触发抓取，其他日期不受影响
+	assert.Nil(t, requestOnDemandFetch("de-DE", "2024-01-01"))
+	second := requestOnDemandFetch("de-DE", "2024-01-02")
+	require.NotNil(t, second)
+	waitOnDemandIdle(t, "de-DE")
+	assert.Equal(t, int32(2), calls.Load())
+
+	config.GetConfig().API.OnDemandFetchCooldown = "0s"
+	assert.NotNil(t, requestOnDemandFetch("de-DE", "2024-01-01"))
+	waitOnDemandIdle(t, "de-DE")
+	assert.Equal(t, int32(3), calls.Load())
+}
+
+func TestImageQueriesFilterBySource(t *testing.T) {
+	var calls atomic.Int32
+	setupOnDemandTest(t, func(ctx context.Context, mkt string) error {
+		calls.Add(1)
+		return nil
+	})
+	config.GetConfig().API.EnableOnDemandFetch = true
+	config.GetConfig().API.EnableMktFallback = false
+
+	// 同一天同一地区可以同时存在不同图片源的记录
+	require.NoError(t, repo.DB.Create(&model.ImageRegion{Date: "2026-01-02", Mkt: "zh-CN", Source: config.SourceBing, ImageName: "BingImage"}).Error)
+	require.NoError(t, repo.DB.Create(&model.ImageRegion{Date: "2026-01-02", Mkt: "zh-CN", Source: "apod", ImageName: "apod-Nebula"}).Error)
+
+	img, err := GetImageByDate("2026-01-02", "zh-CN", "")
+	require.NoError(t, err)
+	assert.Equal(t, "BingImage", img.ImageName)
+
+	img, err = GetImageByDate("2026-01-02", "zh-CN", "apod")
+	require.NoError(t, err)
+	assert.Equal(t, "apod-Nebula", img.ImageName)
+
+	list, err := GetImageList(10, 0, "", "zh-CN", "apod")
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	assert.Equal(t, "apod", list[0].Source)
+
+	// 按需抓取只针对 Bing
+	_, err = GetImageByDate("2026-01-03", "zh-CN", "apod")
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+	assert.Zero(t, calls.Load())
+}
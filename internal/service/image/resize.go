@@ -0,0 +1,141 @@
+package image
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	stdimage "image"
+	"strings"
+
+	"BingPaper/internal/config"
+	"BingPaper/internal/model"
+	"BingPaper/internal/service/fetcher"
+	"BingPaper/internal/util"
+
+	"github.com/disintegration/imaging"
+	"go.uber.org/zap"
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	FitFill = "fill" // 等比缩放后居中裁剪，填满目标尺寸
+	FitFit  = "fit"  // 等比缩放至目标尺寸以内，不裁剪
+)
+
+var (
+	ErrResizeDisabled   = errors.New("resize is disabled")
+	ErrResizeNotAllowed = errors.New("requested size is not allowed")
+	ErrSourceNotFound   = fetcher.ErrSourceNotFound
+)
+
+var resizeGroup singleflight.Group
+
+// ResizeRequest 描述一次按需缩放请求，Width/Height 为 0 表示按原图比例推算
+type ResizeRequest struct {
+	Width  int
+	Height int
+	Fit    string
+	Format string
+}
+
+// VariantName 返回该尺寸对应的变体名称。
+// fill 模式与抓取时生成的变体命名一致 (如 2560x1440)，从而可以直接复用已有变体。
+func (r ResizeRequest) VariantName() string {
+	switch {
+	case r.Height == 0:
+		return fmt.Sprintf("w%d", r.Width)
+	case r.Width == 0:
+		return fmt.Sprintf("h%d", r.Height)
+	case r.Fit == FitFit:
+		return fmt.Sprintf("%dx%d_fit", r.Width, r.Height)
+	default:
+		return fmt.Sprintf("%dx%d", r.Width, r.Height)
+	}
+}
+
+// ValidateResize 校验缩放参数是否符合配置的限制
+func ValidateResize(r ResizeRequest) error {
+	cfg := config.GetConfig().API.Resize
+	if !cfg.Enabled {
+		return ErrResizeDisabled
+	}
+	if r.Width < 0 || r.Height < 0 || (r.Width == 0 && r.Height == 0) {
+		return fmt.Errorf("%w: width or height must be positive", ErrResizeNotAllowed)
+	}
+	if r.Fit != FitFill && r.Fit != FitFit {
+		return fmt.Errorf("%w: unsupported fit mode %q", ErrResizeNotAllowed, r.Fit)
+	}
+	switch r.Format {
+	case fetcher.FormatJPEG, fetcher.FormatWebP, fetcher.FormatAVIF:
+	default:
+		return fmt.Errorf("%w: unsupported format %q", ErrResizeNotAllowed, r.Format)
+	}
+	if cfg.MaxDimension > 0 && (r.Width > cfg.MaxDimension || r.Height > cfg.MaxDimension) {
+		return fmt.Errorf("%w: max dimension is %d", ErrResizeNotAllowed, cfg.MaxDimension)
+	}
+	if len(cfg.AllowedSizes) > 0 {
+		size := fmt.Sprintf("%dx%d", r.Width, r.Height)
+		for _, allowed := range cfg.AllowedSizes {
+			if strings.EqualFold(strings.TrimSpace(allowed), size) {
+				return nil
+			}
+		}
+		return fmt.Errorf("%w: %s is not in allowed sizes", ErrResizeNotAllowed, size)
+	}
+	return nil
+}
+
+// GetResizedVariant 返回指定尺寸的变体，不存在时从原图派生并写回存储。
+// 同一图片同一尺寸的并发请求只会触发一次生成。
+func GetResizedVariant(ctx context.Context, m *model.ImageRegion, r ResizeRequest) (*model.ImageVariant, error) {
+	if err := ValidateResize(r); err != nil {
+		return nil, err
+	}
+
+	name := r.VariantName()
+	for i := range m.Variants {
+		if m.Variants[i].Variant == name && m.Variants[i].Format == r.Format {
+			return &m.Variants[i], nil
+		}
+	}
+
+	key := fmt.Sprintf("%s/%s.%s", m.ImageName, name, r.Format)
+	v, err, _ := resizeGroup.Do(key, func() (interface{}, error) {
+		// 生成结果会被其他请求共享，不随单个请求取消
+		return deriveVariant(context.WithoutCancel(ctx), m, r)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.(*model.ImageVariant), nil
+}
+
+func deriveVariant(ctx context.Context, m *model.ImageRegion, r ResizeRequest) (*model.ImageVariant, error) {
+	srcImg, src, err := fetcher.LoadSourceImage(ctx, m.Variants)
+	if err != nil {
+		return nil, err
+	}
+
+	util.Logger.Info("Deriving resized variant",
+		zap.String("image_name", m.ImageName),
+		zap.String("source", src.Variant),
+		zap.String("variant", r.VariantName()),
+		zap.String("format", r.Format))
+
+	var resized stdimage.Image
+	switch {
+	case r.Width == 0 || r.Height == 0:
+		resized = imaging.Resize(srcImg, r.Width, r.Height, imaging.Lanczos)
+	case r.Fit == FitFit:
+		resized = imaging.Fit(srcImg, r.Width, r.Height, imaging.Lanczos)
+	default:
+		resized = imaging.Fill(srcImg, r.Width, r.Height, imaging.Center, imaging.Lanczos)
+	}
+
+	data, err := fetcher.EncodeImage(ctx, resized, r.Format, fetcher.DefaultQuality)
+	if err != nil {
+		return nil, err
+	}
+
+	return fetcher.NewFetcher().SaveVariant(ctx, m.ImageName, r.VariantName(), r.Format, data, fetcher.DerivedSpec(r.Width, r.Height, r.Fit))
+}
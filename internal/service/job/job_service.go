@@ -0,0 +1,461 @@
+package job
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"BingPaper/internal/model"
+	"BingPaper/internal/repo"
+	"BingPaper/internal/util"
+
+	"go.uber.org/zap"
+)
+
+const (
+	TypeFetch            = "fetch"
+	TypeCleanup          = "cleanup"
+	TypeOnDemandFetch    = "on_demand_fetch"
+	TypeVariantBackfill  = "variant_backfill"
+	TypeImport           = "import"
+	TypeStorageMigration = "storage_migration"
+	TypeFsck             = "fsck"
+)
+
+const (
+	StatePending   = "pending"
+	StateRunning   = "running"
+	StateSucceeded = "succeeded"
+	StateFailed    = "failed"
+)
+
+// maxLogLines 单个任务保留的最大日志行数，超出后丢弃最早的日志
+const maxLogLines = 500
+
+// 任务列表分页大小：limit <= 0 时使用 defaultListLimit，且不超过 maxListLimit
+const (
+	defaultListLimit = 30
+	maxListLimit     = 200
+)
+
+// flushInterval 运行中任务的日志和进度写入数据库的间隔，任务结束时会立即写入
+var flushInterval = time.Second
+
+// Func 任务执行函数，通过 ctx 可以获取 Handle 以记录日志和进度
+type Func func(ctx context.Context) error
+
+// Handle 运行中任务的句柄。日志和进度先保存在内存中，由后台定期写入数据库，
+// Get/List/Latest 读取运行中的任务时会合并内存中的最新状态。
+// 所有方法对 nil 句柄安全，便于在非任务上下文中复用同一段代码。
+type Handle struct {
+	id     uint
+	cancel context.CancelCauseFunc
+
+	mu        sync.Mutex
+	logs      []string
+	total     int
+	processed int
+	result    string
+	dirty     bool // 内存状态是否有尚未写入数据库的修改
+}
+
+type ctxKey struct{}
+
+// FromContext 返回 ctx 中的任务句柄，不在任务中运行时返回 nil
+func FromContext(ctx context.Context) *Handle {
+	h, _ := ctx.Value(ctxKey{}).(*Handle)
+	return h
+}
+
+// ID 返回任务 ID
+func (h *Handle) ID() uint {
+	if h == nil {
+		return 0
+	}
+	return h.id
+}
+
+// Logf 追加一行任务日志
+func (h *Handle) Logf(format string, args ...interface{}) {
+	if h == nil {
+		return
+	}
+	line := fmt.Sprintf("%s %s", time.Now().Format("2006-01-02 15:04:05"), fmt.Sprintf(format, args...))
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.logs = append(h.logs, line)
+	if len(h.logs) > maxLogLines {
+		h.logs = h.logs[len(h.logs)-maxLogLines:]
+	}
+	h.dirty = true
+}
+
+// SetTotal 设置任务的总工作量
+func (h *Handle) SetTotal(total int) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.total = total
+	h.dirty = true
+}
+
+// Advance 增加已完成的工作量
+func (h *Handle) Advance(n int) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.processed += n
+	h.dirty = true
+}
+
+// SetResult 以 JSON 形式保存任务结果，可多次调用，以最后一次为准
+func (h *Handle) SetResult(v interface{}) {
+	if h == nil {
+		return
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		util.Logger.Warn("Failed to encode job result", zap.Uint("id", h.id), zap.Error(err))
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.result = string(data)
+	h.dirty = true
+}
+
+// pending 返回尚未写入数据库的日志和进度，没有修改时返回 nil
+func (h *Handle) pending() map[string]interface{} {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if !h.dirty {
+		return nil
+	}
+	h.dirty = false
+	fields := map[string]interface{}{
+		"logs":      strings.Join(h.logs, "\n"),
+		"total":     h.total,
+		"processed": h.processed,
+	}
+	if h.result != "" {
+		fields["result"] = h.result
+	}
+	return fields
+}
+
+// flushLoop 每隔 flushInterval 写入一次日志和进度，直到 stop 被关闭
+func (h *Handle) flushLoop(stop <-chan struct{}) {
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if fields := h.pending(); fields != nil {
+				h.update(fields)
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+// apply 用内存中的最新状态覆盖 j 中的日志和进度
+func (h *Handle) apply(j *model.Job) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	j.Logs = strings.Join(h.logs, "\n")
+	j.Total = h.total
+	j.Processed = h.processed
+	if h.result != "" {
+		j.Result = h.result
+	}
+}
+
+// update 将字段写入任务记录。同一任务的写入只来自 flushLoop 和结束时的最终写入，两者不会并发
+func (h *Handle) update(fields map[string]interface{}) {
+	if err := repo.DB.Model(&model.Job{}).Where("id = ?", h.id).Updates(fields).Error; err != nil {
+		util.Logger.Warn("Failed to update job", zap.Uint("id", h.id), zap.Error(err))
+	}
+}
+
+// Submit 创建任务并在后台执行，立即返回任务记录
+func Submit(jobType string, params interface{}, fn Func) (*model.Job, error) {
+	j, err := create(jobType, params)
+	if err != nil {
+		return nil, err
+	}
+	go execute(j, fn)
+	return j, nil
+}
+
+// ErrAlreadyRunning 表示同类型的任务尚未结束
+var ErrAlreadyRunning = errors.New("job of this type is already running")
+
+// submitMu 保证 SubmitExclusive 的检查与创建不会交错
+var submitMu sync.Mutex
+
+// SubmitExclusive 与 Submit 相同，但同类型已有未结束的任务时返回 ErrAlreadyRunning
+func SubmitExclusive(jobType string, params interface{}, fn Func) (*model.Job, error) {
+	submitMu.Lock()
+	defer submitMu.Unlock()
+
+	var running int64
+	if err := repo.DB.Model(&model.Job{}).
+		Where("type = ? AND state IN ?", jobType, []string{StatePending, StateRunning}).
+		Count(&running).Error; err != nil {
+		return nil, err
+	}
+	if running > 0 {
+		return nil, ErrAlreadyRunning
+	}
+	return Submit(jobType, params, fn)
+}
+
+// Run 创建任务并在当前 goroutine 中同步执行，返回执行结果
+func Run(jobType string, params interface{}, fn Func) error {
+	j, err := create(jobType, params)
+	if err != nil {
+		// 无法记录任务时仍然执行，避免因数据库问题影响定时任务
+		util.Logger.Warn("Failed to create job record, running untracked", zap.String("type", jobType), zap.Error(err))
+		return fn(context.Background())
+	}
+	return execute(j, fn)
+}
+
+func create(jobType string, params interface{}) (*model.Job, error) {
+	j := &model.Job{Type: jobType, State: StatePending}
+	if params != nil {
+		data, err := json.Marshal(params)
+		if err != nil {
+			return nil, err
+		}
+		j.Params = string(data)
+	}
+	if err := repo.DB.Create(j).Error; err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+func execute(j *model.Job, fn Func) (err error) {
+	ctx, cancel := context.WithCancelCause(context.Background())
+	h := &Handle{id: j.ID, cancel: cancel}
+	started := time.Now()
+	h.update(map[string]interface{}{"state": StateRunning, "started_at": started})
+	util.Logger.Info("Job started", zap.Uint("id", j.ID), zap.String("type", j.Type))
+
+	runningMu.Lock()
+	running[j.ID] = h
+	runningMu.Unlock()
+
+	stop := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		h.flushLoop(stop)
+	}()
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+		// 任务被取消时通常只返回 context.Canceled，记录取消的原因
+		if cause := context.Cause(ctx); err != nil && (errors.Is(cause, ErrCanceled) || errors.Is(cause, ErrInterrupted)) {
+			err = cause
+		}
+		cancel(nil)
+
+		close(stop)
+		<-stopped
+
+		finished := time.Now()
+		fields := h.pending()
+		if fields == nil {
+			fields = make(map[string]interface{})
+		}
+		fields["state"] = StateSucceeded
+		fields["finished_at"] = finished
+		if err != nil {
+			fields["state"] = StateFailed
+			fields["error"] = err.Error()
+			util.Logger.Error("Job failed", zap.Uint("id", j.ID), zap.String("type", j.Type), zap.Error(err))
+		} else {
+			util.Logger.Info("Job finished", zap.Uint("id", j.ID), zap.String("type", j.Type), zap.Duration("elapsed", finished.Sub(started)))
+		}
+		h.update(fields)
+
+		// 最终状态写入后再移除，保证读取方总能看到最新的日志和进度
+		runningMu.Lock()
+		delete(running, j.ID)
+		runningMu.Unlock()
+	}()
+
+	return fn(context.WithValue(ctx, ctxKey{}, h))
+}
+
+var (
+	// ErrCanceled 任务被管理员取消
+	ErrCanceled = errors.New("canceled by admin")
+	// ErrNotRunning 表示任务不存在或已经结束
+	ErrNotRunning = errors.New("job is not running")
+)
+
+var (
+	runningMu sync.Mutex
+	running   = make(map[uint]*Handle) // 本进程中正在执行的任务
+)
+
+// withLiveState 将运行中任务在内存中的日志和进度合并到 jobs
+func withLiveState(jobs ...*model.Job) {
+	runningMu.Lock()
+	defer runningMu.Unlock()
+	for _, j := range jobs {
+		if h, ok := running[j.ID]; ok {
+			h.apply(j)
+		}
+	}
+}
+
+// Cancel 取消正在执行的任务。任务在下一次检查 ctx 时退出，并以 ErrCanceled 标记为失败。
+func Cancel(id uint) error {
+	runningMu.Lock()
+	h, ok := running[id]
+	runningMu.Unlock()
+	if !ok {
+		return ErrNotRunning
+	}
+	util.Logger.Info("Canceling job", zap.Uint("id", id))
+	h.cancel(ErrCanceled)
+	return nil
+}
+
+// Get 获取指定任务
+func Get(id uint) (*model.Job, error) {
+	var j model.Job
+	if err := repo.DB.First(&j, id).Error; err != nil {
+		return nil, err
+	}
+	withLiveState(&j)
+	return &j, nil
+}
+
+// Latest 返回指定类型最近创建的任务，result 不为 nil 时将任务结果解码到其中；没有任务时返回 nil
+func Latest(jobType string, result interface{}) (*model.Job, error) {
+	var jobs []model.Job
+	if err := repo.DB.Where("type = ?", jobType).Order("id desc").Limit(1).Find(&jobs).Error; err != nil {
+		return nil, err
+	}
+	if len(jobs) == 0 {
+		return nil, nil
+	}
+	j := &jobs[0]
+	withLiveState(j)
+	if result != nil && j.Result != "" {
+		if err := json.Unmarshal([]byte(j.Result), result); err != nil {
+			return nil, fmt.Errorf("decode job result: %w", err)
+		}
+	}
+	return j, nil
+}
+
+// List 按创建时间倒序列出任务，jobType/state 为空表示不过滤。
+// limit <= 0 时返回最近 defaultListLimit 条，单次最多返回 maxListLimit 条。
+func List(limit, offset int, jobType, state string) ([]model.Job, error) {
+	if limit <= 0 {
+		limit = defaultListLimit
+	}
+	if limit > maxListLimit {
+		limit = maxListLimit
+	}
+	var jobs []model.Job
+	tx := repo.DB.Model(&model.Job{}).Order("id desc")
+	if jobType != "" {
+		tx = tx.Where("type = ?", jobType)
+	}
+	if state != "" {
+		tx = tx.Where("state = ?", state)
+	}
+	tx = tx.Limit(limit)
+	if offset > 0 {
+		tx = tx.Offset(offset)
+	}
+	if err := tx.Find(&jobs).Error; err != nil {
+		return nil, err
+	}
+	for i := range jobs {
+		withLiveState(&jobs[i])
+	}
+	return jobs, nil
+}
+
+// ErrInterrupted 服务重启导致任务中断
+var ErrInterrupted = errors.New("interrupted by service restart")
+
+// Shutdown 以 ErrInterrupted 取消所有正在执行的任务并等待其写入最终状态，应在服务退出前调用。
+// ctx 结束时仍未退出的任务直接在数据库中标记为中断，返回 ctx.Err()。
+func Shutdown(ctx context.Context) error {
+	runningMu.Lock()
+	for _, h := range running {
+		h.cancel(ErrInterrupted)
+	}
+	runningMu.Unlock()
+
+	// 任务写入最终状态后才从 running 中移除，因此 running 为空即表示全部结束
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		runningMu.Lock()
+		ids := make([]uint, 0, len(running))
+		for id := range running {
+			ids = append(ids, id)
+		}
+		runningMu.Unlock()
+		if len(ids) == 0 {
+			return nil
+		}
+
+		select {
+		case <-ticker.C:
+			continue
+		case <-ctx.Done():
+		}
+
+		if err := repo.DB.Model(&model.Job{}).Where("id IN ?", ids).Updates(map[string]interface{}{
+			"state":       StateFailed,
+			"error":       ErrInterrupted.Error(),
+			"finished_at": time.Now(),
+		}).Error; err != nil {
+			util.Logger.Error("Failed to mark interrupted jobs", zap.Error(err))
+		}
+		return ctx.Err()
+	}
+}
+
+// RecoverInterrupted 将上次运行时未结束的任务标记为失败，应在服务启动时调用
+func RecoverInterrupted() error {
+	now := time.Now()
+	return repo.DB.Model(&model.Job{}).
+		Where("state IN ?", []string{StatePending, StateRunning}).
+		Updates(map[string]interface{}{
+			"state":       StateFailed,
+			"error":       ErrInterrupted.Error(),
+			"finished_at": now,
+		}).Error
+}
+
+// Prune 删除 before 之前结束的任务记录，返回删除的条数；未结束的任务不受影响
+func Prune(before time.Time) (int64, error) {
+	res := repo.DB.
+		Where("state IN ? AND finished_at < ?", []string{StateSucceeded, StateFailed}, before).
+		Delete(&model.Job{})
+	return res.RowsAffected, res.Error
+}
@@ -0,0 +1,328 @@
+package job
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"BingPaper/internal/model"
+	"BingPaper/internal/repo"
+	"BingPaper/internal/util"
+
+	"github.com/glebarez/sqlite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+func setupTestDB(t *testing.T) {
+	t.Helper()
+
+	util.Logger = zap.NewNop()
+	db, err := gorm.Open(sqlite.Open(fmt.Sprintf("file:%s?mode=memory&cache=shared", t.Name())), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, repo.AutoMigrateModels(db))
+	repo.DB = db
+}
+
+func TestRunRecordsOutcome(t *testing.T) {
+	setupTestDB(t)
+
+	err := Run(TypeFetch, map[string]int{"n": 2}, func(ctx context.Context) error {
+		h := FromContext(ctx)
+		h.SetTotal(2)
+		h.Logf("region %s ok", "zh-CN")
+		h.Advance(1)
+		h.Logf("region %s failed", "en-US")
+		h.Advance(1)
+		h.SetResult(map[string]int{"failed": 1})
+		return errors.New("en-US: boom")
+	})
+	require.Error(t, err)
+
+	jobs, err := List(10, 0, TypeFetch, "")
+	require.NoError(t, err)
+	require.Len(t, jobs, 1)
+
+	j := jobs[0]
+	assert.Equal(t, StateFailed, j.State)
+	assert.Equal(t, `{"n":2}`, j.Params)
+	assert.Equal(t, 2, j.Total)
+	assert.Equal(t, 2, j.Processed)
+	assert.Contains(t, j.Logs, "region zh-CN ok")
+	assert.Contains(t, j.Logs, "region en-US failed")
+	assert.Equal(t, `{"failed":1}`, j.Result)
+	assert.Equal(t, "en-US: boom", j.Error)
+	assert.NotNil(t, j.StartedAt)
+	assert.NotNil(t, j.FinishedAt)
+}
+
+func TestSubmitRunsInBackground(t *testing.T) {
+	setupTestDB(t)
+
+	release := make(chan struct{})
+	j, err := Submit(TypeCleanup, nil, func(ctx context.Context) error {
+		<-release
+		return nil
+	})
+	require.NoError(t, err)
+	assert.NotZero(t, j.ID)
+
+	close(release)
+	require.Eventually(t, func() bool {
+		got, err := Get(j.ID)
+		return err == nil && got.State == StateSucceeded && got.FinishedAt != nil
+	}, 2*time.Second, 10*time.Millisecond)
+}
+
+func TestSubmitExclusive(t *testing.T) {
+	setupTestDB(t)
+
+	latest, err := Latest(TypeFsck, nil)
+	require.NoError(t, err)
+	assert.Nil(t, latest)
+
+	release := make(chan struct{})
+	j, err := SubmitExclusive(TypeFsck, nil, func(ctx context.Context) error {
+		<-release
+		FromContext(ctx).SetResult(map[string]int{"orphans": 3})
+		return nil
+	})
+	require.NoError(t, err)
+
+	_, err = SubmitExclusive(TypeFsck, nil, func(ctx context.Context) error { return nil })
+	assert.ErrorIs(t, err, ErrAlreadyRunning)
+	// 不同类型的任务互不影响
+	_, err = SubmitExclusive(TypeCleanup, nil, func(ctx context.Context) error { return nil })
+	assert.NoError(t, err)
+
+	close(release)
+	var result map[string]int
+	require.Eventually(t, func() bool {
+		latest, err := Latest(TypeFsck, &result)
+		return err == nil && latest.ID == j.ID && latest.State == StateSucceeded
+	}, 2*time.Second, 10*time.Millisecond)
+	assert.Equal(t, 3, result["orphans"])
+
+	_, err = SubmitExclusive(TypeFsck, nil, func(ctx context.Context) error { return nil })
+	assert.NoError(t, err)
+	require.Eventually(t, func() bool {
+		running, err := List(0, 0, "", StateRunning)
+		pending, _ := List(0, 0, "", StatePending)
+		return err == nil && len(running)+len(pending) == 0
+	}, 2*time.Second, 10*time.Millisecond)
+}
+
+func TestCancel(t *testing.T) {
+	setupTestDB(t)
+
+	assert.ErrorIs(t, Cancel(12345), ErrNotRunning)
+
+	j, err := Submit(TypeFetch, nil, func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool { return Cancel(j.ID) == nil }, 2*time.Second, 10*time.Millisecond)
+	require.Eventually(t, func() bool {
+		got, err := Get(j.ID)
+		return err == nil && got.State == StateFailed && got.Error == ErrCanceled.Error()
+	}, 2*time.Second, 10*time.Millisecond)
+	assert.ErrorIs(t, Cancel(j.ID), ErrNotRunning)
+}
+
+func TestShutdown(t *testing.T) {
+	setupTestDB(t)
+
+	j, err := Submit(TypeFetch, nil, func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		got, err := Get(j.ID)
+		return err == nil && got.State == StateRunning
+	}, 2*time.Second, 10*time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	require.NoError(t, Shutdown(ctx))
+
+	got, err := Get(j.ID)
+	require.NoError(t, err)
+	assert.Equal(t, StateFailed, got.State)
+	assert.Equal(t, ErrInterrupted.Error(), got.Error)
+}
+
+func TestShutdownMarksStuckJobs(t *testing.T) {
+	setupTestDB(t)
+
+	release := make(chan struct{})
+	j, err := Submit(TypeFetch, nil, func(ctx context.Context) error {
+		<-release // 不响应取消
+		return nil
+	})
+	require.NoError(t, err)
+	defer func() {
+		close(release)
+		require.Eventually(t, func() bool { return Cancel(j.ID) == ErrNotRunning }, 2*time.Second, 10*time.Millisecond)
+	}()
+	require.Eventually(t, func() bool {
+		got, err := Get(j.ID)
+		return err == nil && got.State == StateRunning
+	}, 2*time.Second, 10*time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, Shutdown(ctx), context.DeadlineExceeded)
+
+	var stored model.Job
+	require.NoError(t, repo.DB.First(&stored, j.ID).Error)
+	assert.Equal(t, StateFailed, stored.State)
+	assert.Equal(t, ErrInterrupted.Error(), stored.Error)
+}
+
+func TestConcurrentProgressKeepsLatestValue(t *testing.T) {
+	setupTestDB(t)
+
+	err := Run(TypeFetch, nil, func(ctx context.Context) error {
+		h := FromContext(ctx)
+		var wg sync.WaitGroup
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				h.Advance(1)
+				h.Logf("step %d", i)
+			}(i)
+		}
+		wg.Wait()
+		return nil
+	})
+	require.NoError(t, err)
+
+	jobs, err := List(1, 0, TypeFetch, "")
+	require.NoError(t, err)
+	require.Len(t, jobs, 1)
+	assert.Equal(t, 20, jobs[0].Processed)
+	assert.Len(t, strings.Split(jobs[0].Logs, "\n"), 20)
+}
+
+func TestProgressBufferedUntilFlush(t *testing.T) {
+	setupTestDB(t)
+	interval := flushInterval
+	flushInterval = time.Hour
+	defer func() { flushInterval = interval }()
+
+	progressed := make(chan struct{})
+	release := make(chan struct{})
+	j, err := Submit(TypeFetch, nil, func(ctx context.Context) error {
+		h := FromContext(ctx)
+		h.SetTotal(3)
+		h.Advance(2)
+		h.Logf("halfway")
+		close(progressed)
+		<-release
+		return nil
+	})
+	require.NoError(t, err)
+	<-progressed
+
+	// 数据库中尚未写入进度，Get 返回内存中的最新状态
+	var stored model.Job
+	require.NoError(t, repo.DB.First(&stored, j.ID).Error)
+	assert.Zero(t, stored.Processed)
+	got, err := Get(j.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 3, got.Total)
+	assert.Equal(t, 2, got.Processed)
+	assert.Contains(t, got.Logs, "halfway")
+
+	close(release)
+	require.Eventually(t, func() bool {
+		var stored model.Job
+		return repo.DB.First(&stored, j.ID).Error == nil && stored.State == StateSucceeded
+	}, 2*time.Second, 10*time.Millisecond)
+	require.NoError(t, repo.DB.First(&stored, j.ID).Error)
+	assert.Equal(t, 2, stored.Processed)
+	assert.Contains(t, stored.Logs, "halfway")
+}
+
+func TestRunRecoversPanic(t *testing.T) {
+	setupTestDB(t)
+
+	err := Run(TypeCleanup, nil, func(ctx context.Context) error {
+		panic("unexpected")
+	})
+	assert.EqualError(t, err, "panic: unexpected")
+
+	jobs, err := List(0, 0, "", StateFailed)
+	require.NoError(t, err)
+	require.Len(t, jobs, 1)
+}
+
+func TestRecoverInterrupted(t *testing.T) {
+	setupTestDB(t)
+
+	require.NoError(t, repo.DB.Create(&model.Job{Type: TypeFetch, State: StateRunning}).Error)
+	require.NoError(t, repo.DB.Create(&model.Job{Type: TypeFetch, State: StateSucceeded}).Error)
+	require.NoError(t, RecoverInterrupted())
+
+	jobs, err := List(0, 0, "", StateFailed)
+	require.NoError(t, err)
+	require.Len(t, jobs, 1)
+	assert.Equal(t, ErrInterrupted.Error(), jobs[0].Error)
+}
+
+func TestNilHandle(t *testing.T) {
+	h := FromContext(context.Background())
+	assert.Nil(t, h)
+	assert.NotPanics(t, func() {
+		h.Logf("ignored")
+		h.SetTotal(1)
+		h.Advance(1)
+		h.SetResult("ignored")
+	})
+	assert.Zero(t, h.ID())
+}
+
+func TestListClampsLimit(t *testing.T) {
+	setupTestDB(t)
+
+	for i := 0; i < maxListLimit+1; i++ {
+		require.NoError(t, repo.DB.Create(&model.Job{Type: TypeFetch, State: StateSucceeded}).Error)
+	}
+
+	jobs, err := List(0, 0, "", "")
+	require.NoError(t, err)
+	assert.Len(t, jobs, defaultListLimit)
+
+	jobs, err = List(maxListLimit+1, 0, "", "")
+	require.NoError(t, err)
+	assert.Len(t, jobs, maxListLimit)
+}
+
+func TestPrune(t *testing.T) {
+	setupTestDB(t)
+
+	old := time.Now().AddDate(0, 0, -40)
+	recent := time.Now().AddDate(0, 0, -1)
+	require.NoError(t, repo.DB.Create(&model.Job{Type: TypeFetch, State: StateSucceeded, FinishedAt: &old}).Error)
+	require.NoError(t, repo.DB.Create(&model.Job{Type: TypeFetch, State: StateFailed, FinishedAt: &old}).Error)
+	require.NoError(t, repo.DB.Create(&model.Job{Type: TypeFetch, State: StateSucceeded, FinishedAt: &recent}).Error)
+	require.NoError(t, repo.DB.Create(&model.Job{Type: TypeFetch, State: StateRunning}).Error)
+
+	n, err := Prune(time.Now().AddDate(0, 0, -30))
+	require.NoError(t, err)
+	assert.EqualValues(t, 2, n)
+
+	var left int64
+	require.NoError(t, repo.DB.Model(&model.Job{}).Count(&left).Error)
+	assert.EqualValues(t, 2, left)
+}
@@ -0,0 +1,363 @@
+package migration
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"BingPaper/internal/config"
+	"BingPaper/internal/model"
+	"BingPaper/internal/repo"
+	"BingPaper/internal/service/job"
+	"BingPaper/internal/storage"
+	"BingPaper/internal/storage/backend"
+	"BingPaper/internal/util"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	// ErrMigrationRunning 表示已有存储迁移任务在运行
+	ErrMigrationRunning = errors.New("storage migration is already running")
+	// ErrSameStorage 表示目标存储与当前使用的存储相同
+	ErrSameStorage = errors.New("target storage must differ from the active storage")
+	// ErrInvalidTarget 表示目标存储无法初始化
+	ErrInvalidTarget = errors.New("invalid target storage")
+)
+
+const (
+	MigrationIdle      = "idle"
+	MigrationRunning   = "running"
+	MigrationCompleted = "completed"
+	MigrationFailed    = "failed"
+)
+
+// migrationBatchSize 每批读取的变体记录数
+const migrationBatchSize = 200
+
+// StorageMigrationOptions 存储迁移参数
+type StorageMigrationOptions struct {
+	Target       config.StorageConfig `json:"target"`
+	UpdateConfig bool                 `json:"update_config"` // 全部复制成功后改写 PublicURL、保存配置并切换到目标存储
+	Restart      bool                 `json:"restart"`       // 忽略断点记录，重新复制全部对象
+}
+
+// StorageMigrationProgress 存储迁移进度
+type StorageMigrationProgress struct {
+	State      string     `json:"state"`
+	Target     string     `json:"target"`  // 目标存储位置标识
+	Total      int        `json:"total"`   // 需要迁移的对象数
+	Copied     int        `json:"copied"`  // 本次复制并校验通过的对象数
+	Resumed    int        `json:"resumed"` // 此前已迁移而跳过的对象数
+	Failed     int        `json:"failed"`
+	Bytes      int64      `json:"bytes"` // 本次复制的字节数
+	Switched   bool       `json:"switched"`
+	LastError  string     `json:"last_error,omitempty"`
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+// GetStorageMigrationProgress 返回当前（或最近一次）存储迁移的进度，进度保存在迁移任务的结果中
+func GetStorageMigrationProgress() (StorageMigrationProgress, error) {
+	var p StorageMigrationProgress
+	j, err := job.Latest(job.TypeStorageMigration, &p)
+	if err != nil || j == nil {
+		return StorageMigrationProgress{State: MigrationIdle}, err
+	}
+	switch j.State {
+	case job.StateSucceeded:
+		p.State = MigrationCompleted
+	case job.StateFailed:
+		p.State = MigrationFailed
+		p.LastError = j.Error
+	default:
+		p.State = MigrationRunning
+	}
+	p.StartedAt = j.StartedAt
+	p.FinishedAt = j.FinishedAt
+	return p, nil
+}
+
+// OpenTarget 校验目标存储配置并创建后端
+func OpenTarget(target config.StorageConfig) (storage.Storage, error) {
+	if backend.Location(target) == backend.Location(config.GetConfig().Storage) {
+		return nil, ErrSameStorage
+	}
+	s, err := backend.New(target)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidTarget, err)
+	}
+	return s, nil
+}
+
+// StartStorageMigration 在后台启动存储迁移任务，已有任务运行时返回 ErrMigrationRunning
+func StartStorageMigration(opts StorageMigrationOptions) (*model.Job, error) {
+	dst, err := OpenTarget(opts.Target)
+	if err != nil {
+		return nil, err
+	}
+
+	// 任务参数中不记录凭据
+	params := map[string]interface{}{
+		"target":        backend.Location(opts.Target),
+		"update_config": opts.UpdateConfig,
+		"restart":       opts.Restart,
+	}
+	j, err := job.SubmitExclusive(job.TypeStorageMigration, params, func(ctx context.Context) error {
+		_, err := MigrateStorage(ctx, storage.GlobalStorage(), dst, opts)
+		return err
+	})
+	if errors.Is(err, job.ErrAlreadyRunning) {
+		return nil, ErrMigrationRunning
+	}
+	return j, err
+}
+
+// MigrateStorage 将所有变体对象从 src 复制到 dst，并逐个回读校验大小与 SHA-256。
+// 校验通过的对象会记录断点，中断后重新执行时跳过与源对象一致的对象；迁移期间新增或被覆盖的变体也会被复制。
+// 开启 UpdateConfig 且没有失败时，暂停写入并补齐最后的增量，再改写变体的 PublicURL、保存存储配置并切换当前服务使用的存储。
+// 在任务中运行时，进度会同步写入任务结果。
+func MigrateStorage(ctx context.Context, src, dst storage.Storage, opts StorageMigrationOptions) (StorageMigrationProgress, error) {
+	target := backend.Location(opts.Target)
+	h := job.FromContext(ctx)
+	p := StorageMigrationProgress{State: MigrationRunning, Target: target}
+
+	if opts.Restart {
+		if err := repo.DB.Where("target = ?", target).Delete(&model.StorageMigrationItem{}).Error; err != nil {
+			return p, err
+		}
+	}
+
+	var done []model.StorageMigrationItem
+	if err := repo.DB.Where("target = ?", target).Find(&done).Error; err != nil {
+		return p, err
+	}
+	migrated := make(map[string]model.StorageMigrationItem, len(done))
+	for _, item := range done {
+		migrated[item.StorageKey] = item
+	}
+
+	var total int64
+	if err := repo.DB.Model(&model.ImageVariant{}).Count(&total).Error; err != nil {
+		return p, err
+	}
+	p.Total = int(total)
+	h.SetTotal(int(total))
+	h.SetResult(p)
+
+	util.Logger.Info("Starting storage migration",
+		zap.String("target", target),
+		zap.Int64("variants", total),
+		zap.Int("already_migrated", len(migrated)))
+	h.Logf("Migrating %d variants to %s (%d already migrated)", total, target, len(migrated))
+
+	if err := copyVariants(ctx, src, dst, target, migrated, &p, false); err != nil {
+		return p, err
+	}
+
+	util.Logger.Info("Storage migration copy finished",
+		zap.String("target", target),
+		zap.Int("copied", p.Copied),
+		zap.Int("resumed", p.Resumed),
+		zap.Int("failed", p.Failed))
+
+	if p.Failed > 0 {
+		return p, fmt.Errorf("%d objects failed to migrate, run the migration again to resume", p.Failed)
+	}
+	if !opts.UpdateConfig {
+		return p, nil
+	}
+
+	// 复制期间仍可能有新的写入。切换前暂停写入，补齐最后的增量后再切换，
+	// 保证切换时源存储中被引用的对象都已复制到目标存储
+	resume := storage.PauseWrites()
+	defer resume()
+	h.Logf("Writes paused, copying objects written during migration")
+	copied := p.Copied
+	if err := copyVariants(ctx, src, dst, target, migrated, &p, true); err != nil {
+		return p, err
+	}
+	if p.Failed > 0 {
+		return p, fmt.Errorf("%d objects failed to migrate, run the migration again to resume", p.Failed)
+	}
+	if n := p.Copied - copied; n > 0 {
+		util.Logger.Info("Copied objects written during migration", zap.Int("count", n))
+	}
+
+	if err := switchStorage(dst, opts.Target); err != nil {
+		return p, err
+	}
+	p.Switched = true
+	h.SetResult(p)
+	return p, nil
+}
+
+// copyVariants 遍历全部变体，复制尚未迁移或与断点记录不一致的对象，并更新 migrated。
+// delta 为 true 时表示切换前的增量补齐，只统计本轮新复制的对象。
+func copyVariants(ctx context.Context, src, dst storage.Storage, target string, migrated map[string]model.StorageMigrationItem, p *StorageMigrationProgress, delta bool) error {
+	h := job.FromContext(ctx)
+	var lastID uint
+	for {
+		var batch []model.ImageVariant
+		if err := repo.DB.Where("id > ?", lastID).Order("id asc").Limit(migrationBatchSize).Find(&batch).Error; err != nil {
+			return err
+		}
+		if len(batch) == 0 {
+			return nil
+		}
+		lastID = batch[len(batch)-1].ID
+
+		for _, v := range batch {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if item, ok := migrated[v.StorageKey]; ok && upToDate(ctx, src, v, item) {
+				if !delta {
+					p.Resumed++
+					h.Advance(1)
+					h.SetResult(*p)
+				}
+				continue
+			}
+			if delta {
+				p.Total++
+				h.SetTotal(p.Total)
+			}
+
+			item, err := copyObject(ctx, src, dst, target, v.StorageKey)
+			if err != nil {
+				p.Failed++
+				p.LastError = v.StorageKey + ": " + err.Error()
+			} else {
+				p.Copied++
+				p.Bytes += item.Size
+			}
+			h.Advance(1)
+			h.SetResult(*p)
+			if err != nil {
+				util.Logger.Error("Failed to migrate object", zap.String("key", v.StorageKey), zap.Error(err))
+				h.Logf("[%s] failed: %v", v.StorageKey, err)
+				continue
+			}
+			migrated[v.StorageKey] = item
+		}
+	}
+}
+
+// upToDate 判断断点记录是否仍与源对象一致：变体记录有 SHA-256 时比较校验和，
+// 否则比较源对象的大小。名称布局下强制刷新会覆盖同名对象，此时需要重新复制。
+func upToDate(ctx context.Context, src storage.Storage, v model.ImageVariant, item model.StorageMigrationItem) bool {
+	if v.Checksum != "" {
+		return v.Checksum == item.Checksum
+	}
+	stat, err := src.Stat(ctx, v.StorageKey)
+	if err != nil {
+		return false
+	}
+	return stat.Size == item.Size
+}
+
+// copyObject 复制单个对象并回读校验，成功后记录断点并返回
+func copyObject(ctx context.Context, src, dst storage.Storage, target, key string) (model.StorageMigrationItem, error) {
+	var item model.StorageMigrationItem
+	reader, contentType, err := src.Get(ctx, key)
+	if err != nil {
+		return item, fmt.Errorf("read source: %w", err)
+	}
+	data, err := io.ReadAll(reader)
+	reader.Close()
+	if err != nil {
+		return item, fmt.Errorf("read source: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	checksum := hex.EncodeToString(sum[:])
+
+	stored, err := dst.Put(ctx, key, bytes.NewReader(data), contentType)
+	if err != nil {
+		return item, fmt.Errorf("write target: %w", err)
+	}
+	if stored.Size != 0 && stored.Size != int64(len(data)) {
+		return item, fmt.Errorf("size mismatch: wrote %d bytes, target reports %d", len(data), stored.Size)
+	}
+
+	if err := verifyObject(ctx, dst, key, int64(len(data)), checksum); err != nil {
+		return item, err
+	}
+
+	item = model.StorageMigrationItem{Target: target, StorageKey: key, Size: int64(len(data)), Checksum: checksum}
+	if err := repo.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "target"}, {Name: "storage_key"}},
+		DoUpdates: clause.AssignmentColumns([]string{"size", "checksum"}),
+	}).Create(&item).Error; err != nil {
+		return item, err
+	}
+	return item, nil
+}
+
+// verifyObject 从目标存储回读对象并校验大小与 SHA-256
+func verifyObject(ctx context.Context, dst storage.Storage, key string, size int64, checksum string) error {
+	reader, _, err := dst.Get(ctx, key)
+	if err != nil {
+		return fmt.Errorf("verify: %w", err)
+	}
+	defer reader.Close()
+
+	hash := sha256.New()
+	n, err := io.Copy(hash, reader)
+	if err != nil {
+		return fmt.Errorf("verify: %w", err)
+	}
+	if n != size {
+		return fmt.Errorf("verify: size mismatch: expected %d bytes, got %d", size, n)
+	}
+	if got := hex.EncodeToString(hash.Sum(nil)); got != checksum {
+		return fmt.Errorf("verify: checksum mismatch: expected %s, got %s", checksum, got)
+	}
+	return nil
+}
+
+// switchStorage 改写变体的 PublicURL，保存存储配置并切换当前服务使用的存储。
+// PublicURL 在切换时统一改写，避免迁移过程中对外链接指向尚未完成的新存储。
+func switchStorage(dst storage.Storage, target config.StorageConfig) error {
+	var variants []model.ImageVariant
+	err := repo.DB.Select("id", "storage_key").FindInBatches(&variants, migrationBatchSize, func(tx *gorm.DB, batch int) error {
+		for _, v := range variants {
+			url, _ := dst.PublicURL(v.StorageKey)
+			if err := repo.DB.Model(&model.ImageVariant{}).Where("id = ?", v.ID).Update("public_url", url).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	}).Error
+	if err != nil {
+		return fmt.Errorf("failed to rewrite public urls: %w", err)
+	}
+
+	newCfg := *config.GetConfig()
+	// 缓存配置属于本机设置，不随目标存储改变；目标未指定布局时沿用当前布局
+	current := newCfg.Storage
+	newCfg.Storage = target
+	newCfg.Storage.Cache = current.Cache
+	if newCfg.Storage.Layout == "" {
+		newCfg.Storage.Layout = current.Layout
+	}
+	if err := config.SaveConfig(&newCfg); err != nil {
+		return fmt.Errorf("failed to save storage config: %w", err)
+	}
+
+	active, err := backend.WithCache(dst, newCfg.Storage)
+	if err != nil {
+		util.Logger.Warn("Failed to enable storage cache for new storage", zap.Error(err))
+		active = dst
+	}
+	storage.SetGlobalStorage(active)
+	util.Logger.Info("Switched active storage", zap.String("target", backend.Location(target)))
+	return nil
+}
@@ -0,0 +1,207 @@
+package migration
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"BingPaper/internal/config"
+	"BingPaper/internal/model"
+	"BingPaper/internal/repo"
+	"BingPaper/internal/storage"
+	"BingPaper/internal/storage/backend"
+	"BingPaper/internal/storage/local"
+	"BingPaper/internal/util"
+
+	"github.com/glebarez/sqlite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+func setupTestEnv(t *testing.T) (storage.Storage, config.StorageConfig) {
+	t.Helper()
+
+	require.NoError(t, config.Init(filepath.Join(t.TempDir(), "config.yaml")))
+	util.Logger = zap.NewNop()
+
+	db, err := gorm.Open(sqlite.Open(fmt.Sprintf("file:%s?mode=memory&cache=shared", t.Name())), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, repo.AutoMigrateModels(db))
+	repo.DB = db
+
+	srcRoot := t.TempDir()
+	config.GetConfig().Storage = config.StorageConfig{Type: "local", Local: config.LocalConfig{Root: srcRoot}}
+	src, err := local.NewLocalStorage(srcRoot)
+	require.NoError(t, err)
+	orig := storage.GlobalStorage()
+	storage.SetGlobalStorage(src)
+	t.Cleanup(func() { storage.SetGlobalStorage(orig) })
+
+	ctx := context.Background()
+	for _, name := range []string{"A", "B", "C"} {
+		key := fmt.Sprintf("%s/%s_UHD.jpg", name, name)
+		_, err := src.Put(ctx, key, strings.NewReader("bytes of "+name), "image/jpeg")
+		require.NoError(t, err)
+		require.NoError(t, db.Create(&model.ImageVariant{ImageName: name, Variant: "UHD", Format: "jpg", StorageKey: key, PublicURL: "http://old/" + key}).Error)
+	}
+
+	return src, config.StorageConfig{Type: "local", Local: config.LocalConfig{Root: t.TempDir()}}
+}
+
+func readAll(t *testing.T, s storage.Storage, key string) string {
+	t.Helper()
+	r, _, err := s.Get(context.Background(), key)
+	require.NoError(t, err)
+	defer r.Close()
+	data, err := io.ReadAll(r)
+	require.NoError(t, err)
+	return string(data)
+}
+
+func TestMigrateStorageResumes(t *testing.T) {
+	src, target := setupTestEnv(t)
+	ctx := context.Background()
+	dst, err := OpenTarget(target)
+	require.NoError(t, err)
+
+	// 源对象丢失时迁移失败，已复制的对象记录断点
+	require.NoError(t, src.Delete(ctx, "B/B_UHD.jpg"))
+	p, err := MigrateStorage(ctx, src, dst, StorageMigrationOptions{Target: target, UpdateConfig: true})
+	require.ErrorContains(t, err, "1 objects failed")
+	assert.Equal(t, "bytes of A", readAll(t, dst, "A/A_UHD.jpg"))
+	assert.Equal(t, 1, p.Failed)
+	assert.False(t, p.Switched)
+
+	var items []model.StorageMigrationItem
+	require.NoError(t, repo.DB.Find(&items).Error)
+	require.Len(t, items, 2)
+	assert.Equal(t, int64(len("bytes of A")), items[0].Size)
+	assert.Len(t, items[0].Checksum, 64)
+
+	// 恢复源对象后续传，仅复制剩余对象并切换存储
+	_, err = src.Put(ctx, "B/B_UHD.jpg", strings.NewReader("bytes of B"), "image/jpeg")
+	require.NoError(t, err)
+	config.GetConfig().Storage.Layout = config.StorageLayoutContent
+	p, err = MigrateStorage(ctx, src, dst, StorageMigrationOptions{Target: target, UpdateConfig: true})
+	require.NoError(t, err)
+	assert.Equal(t, 1, p.Copied)
+	assert.Equal(t, 2, p.Resumed)
+	assert.True(t, p.Switched)
+	assert.Equal(t, "bytes of B", readAll(t, dst, "B/B_UHD.jpg"))
+	assert.Same(t, dst, storage.GlobalStorage())
+	// 目标未指定布局时沿用当前布局
+	expected := target
+	expected.Layout = config.StorageLayoutContent
+	assert.Equal(t, expected, config.GetConfig().Storage)
+
+	// 本地存储没有公共 URL，PublicURL 被改写为空
+	var v model.ImageVariant
+	require.NoError(t, repo.DB.Where("storage_key = ?", "A/A_UHD.jpg").First(&v).Error)
+	assert.Empty(t, v.PublicURL)
+}
+
+func TestMigrateStorageRecopiesChangedObjects(t *testing.T) {
+	src, target := setupTestEnv(t)
+	ctx := context.Background()
+	dst, err := OpenTarget(target)
+	require.NoError(t, err)
+
+	_, err = MigrateStorage(ctx, src, dst, StorageMigrationOptions{Target: target})
+	require.NoError(t, err)
+
+	// 断点记录之后源对象被覆盖，续传时重新复制
+	_, err = src.Put(ctx, "A/A_UHD.jpg", strings.NewReader("refreshed bytes of A"), "image/jpeg")
+	require.NoError(t, err)
+	p, err := MigrateStorage(ctx, src, dst, StorageMigrationOptions{Target: target})
+	require.NoError(t, err)
+	assert.Equal(t, 1, p.Copied)
+	assert.Equal(t, 2, p.Resumed)
+	assert.Equal(t, "refreshed bytes of A", readAll(t, dst, "A/A_UHD.jpg"))
+}
+
+func TestMigrateStorageWaitsForWritesBeforeSwitch(t *testing.T) {
+	src, target := setupTestEnv(t)
+	ctx := context.Background()
+	dst, err := OpenTarget(target)
+	require.NoError(t, err)
+
+	// 模拟一个进行中的写入：切换前迁移必须等待它结束，并复制它写入的对象
+	endWrite := storage.BeginWrite()
+	done := make(chan error, 1)
+	go func() {
+		_, err := MigrateStorage(ctx, src, dst, StorageMigrationOptions{Target: target, UpdateConfig: true})
+		done <- err
+	}()
+
+	require.Eventually(t, func() bool {
+		var n int64
+		repo.DB.Model(&model.StorageMigrationItem{}).Count(&n)
+		return n == 3
+	}, 5*time.Second, 10*time.Millisecond)
+	_, err = src.Put(ctx, "D/D_UHD.jpg", strings.NewReader("bytes of D"), "image/jpeg")
+	require.NoError(t, err)
+	require.NoError(t, repo.DB.Create(&model.ImageVariant{ImageName: "D", Variant: "UHD", Format: "jpg", StorageKey: "D/D_UHD.jpg"}).Error)
+	assert.NotSame(t, dst, storage.GlobalStorage())
+	endWrite()
+
+	select {
+	case err := <-done:
+		require.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("migration did not finish")
+	}
+	assert.Same(t, dst, storage.GlobalStorage())
+	assert.Equal(t, "bytes of D", readAll(t, dst, "D/D_UHD.jpg"))
+}
+
+func TestStorageMigrationProgressFromJob(t *testing.T) {
+	_, target := setupTestEnv(t)
+
+	p, err := GetStorageMigrationProgress()
+	require.NoError(t, err)
+	assert.Equal(t, MigrationIdle, p.State)
+
+	j, err := StartStorageMigration(StorageMigrationOptions{Target: target})
+	require.NoError(t, err)
+	assert.NotZero(t, j.ID)
+
+	require.Eventually(t, func() bool {
+		p, err = GetStorageMigrationProgress()
+		return err == nil && p.State == MigrationCompleted
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, 3, p.Total)
+	assert.Equal(t, 3, p.Copied)
+	assert.Equal(t, backend.Location(target), p.Target)
+	assert.NotNil(t, p.FinishedAt)
+}
+
+func TestVerifyObjectDetectsCorruption(t *testing.T) {
+	_, target := setupTestEnv(t)
+	ctx := context.Background()
+	dst, err := OpenTarget(target)
+	require.NoError(t, err)
+
+	_, err = dst.Put(ctx, "X/X_UHD.jpg", strings.NewReader("tampered"), "image/jpeg")
+	require.NoError(t, err)
+	assert.ErrorContains(t, verifyObject(ctx, dst, "X/X_UHD.jpg", int64(len("tampered")), "deadbeef"), "checksum mismatch")
+	assert.ErrorContains(t, verifyObject(ctx, dst, "X/X_UHD.jpg", 3, "deadbeef"), "size mismatch")
+}
+
+func TestOpenTargetRejectsActiveStorage(t *testing.T) {
+	setupTestEnv(t)
+	_, err := OpenTarget(config.GetConfig().Storage)
+	assert.ErrorIs(t, err, ErrSameStorage)
+
+	// 目录无法创建时返回 ErrInvalidTarget
+	file := filepath.Join(t.TempDir(), "file")
+	require.NoError(t, os.WriteFile(file, nil, 0644))
+	_, err = OpenTarget(config.StorageConfig{Type: "local", Local: config.LocalConfig{Root: filepath.Join(file, "sub")}})
+	assert.ErrorIs(t, err, ErrInvalidTarget)
+}
@@ -0,0 +1,285 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"sync"
+	"time"
+
+	"BingPaper/internal/model"
+	"BingPaper/internal/repo"
+	"BingPaper/internal/service/event"
+	"BingPaper/internal/util"
+
+	"go.uber.org/zap"
+)
+
+const (
+	EventImageCreated     = event.TypeImageCreated
+	EventImageReplaced    = event.TypeImageReplaced
+	EventFetchFailed      = "fetch.failed"
+	EventCleanupCompleted = "cleanup.completed"
+	EventPing             = "ping" // 管理接口手动测试，不受事件过滤影响
+)
+
+// EventTypes 可订阅的事件类型
+var EventTypes = []string{EventImageCreated, EventImageReplaced, EventFetchFailed, EventCleanupCompleted}
+
+const (
+	SignatureHeader = "X-BingPaper-Signature" // sha256=<hex(HMAC-SHA256(secret, body))>
+	EventHeader     = "X-BingPaper-Event"
+	DeliveryHeader  = "X-BingPaper-Delivery"
+)
+
+// maxAttempts 每次投递的最大尝试次数
+const maxAttempts = 4
+
+var (
+	// retryBackoff 首次重试前的等待时间，之后每次翻倍
+	retryBackoff = 2 * time.Second
+	httpClient   = &http.Client{Timeout: 10 * time.Second}
+	inflight     sync.WaitGroup // 尚未结束的异步投递
+)
+
+var ErrInvalidWebhook = errors.New("invalid webhook")
+
+// Payload 投递给 Webhook 的 JSON 内容
+type Payload struct {
+	Event     string      `json:"event"`
+	Mkt       string      `json:"mkt,omitempty"`
+	Timestamp time.Time   `json:"timestamp"`
+	Data      interface{} `json:"data"`
+}
+
+// Sign 计算请求体签名，接收方可用同一密钥校验 X-BingPaper-Signature
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func generateSecret() string {
+	b := make([]byte, 24)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Validate 校验 Webhook 配置
+func Validate(w *model.Webhook) error {
+	u, err := url.Parse(w.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%w: url must be an absolute http(s) URL", ErrInvalidWebhook)
+	}
+	for _, e := range w.Events {
+		if !slices.Contains(EventTypes, e) {
+			return fmt.Errorf("%w: unknown event type %q", ErrInvalidWebhook, e)
+		}
+	}
+	for _, mkt := range w.Mkts {
+		if !util.IsValidRegion(mkt) {
+			return fmt.Errorf("%w: [%s] is not a standard region code", ErrInvalidWebhook, mkt)
+		}
+	}
+	return nil
+}
+
+// matches 判断 Webhook 是否订阅了该事件，mkt 为空的事件（如清理）不受地区过滤影响
+func matches(w *model.Webhook, eventType, mkt string) bool {
+	if len(w.Events) > 0 && !slices.Contains(w.Events, eventType) {
+		return false
+	}
+	if mkt != "" && len(w.Mkts) > 0 && !slices.Contains(w.Mkts, mkt) {
+		return false
+	}
+	return true
+}
+
+func List() ([]model.Webhook, error) {
+	var hooks []model.Webhook
+	err := repo.DB.Order("id asc").Find(&hooks).Error
+	return hooks, err
+}
+
+func Get(id uint) (*model.Webhook, error) {
+	var w model.Webhook
+	if err := repo.DB.First(&w, id).Error; err != nil {
+		return nil, err
+	}
+	return &w, nil
+}
+
+// Create 创建 Webhook，未指定密钥时自动生成
+func Create(w *model.Webhook) error {
+	if err := Validate(w); err != nil {
+		return err
+	}
+	if w.Secret == "" {
+		w.Secret = generateSecret()
+	}
+	return repo.DB.Create(w).Error
+}
+
+func Update(w *model.Webhook) error {
+	if err := Validate(w); err != nil {
+		return err
+	}
+	return repo.DB.Save(w).Error
+}
+
+// Delete 删除 Webhook 及其投递记录
+func Delete(id uint) error {
+	if err := repo.DB.Where("webhook_id = ?", id).Delete(&model.WebhookDelivery{}).Error; err != nil {
+		return err
+	}
+	return repo.DB.Delete(&model.Webhook{}, id).Error
+}
+
+// ListDeliveries 按时间倒序返回 Webhook 的投递记录
+func ListDeliveries(webhookID uint, limit int) ([]model.WebhookDelivery, error) {
+	var deliveries []model.WebhookDelivery
+	tx := repo.DB.Where("webhook_id = ?", webhookID).Order("id desc")
+	if limit > 0 {
+		tx = tx.Limit(limit)
+	}
+	err := tx.Find(&deliveries).Error
+	return deliveries, err
+}
+
+// Dispatch 向所有订阅了该事件的已启用 Webhook 异步投递，不会阻塞调用方
+func Dispatch(eventType, mkt string, data interface{}) {
+	var hooks []model.Webhook
+	if err := repo.DB.Where("enabled = ?", true).Find(&hooks).Error; err != nil {
+		util.Logger.Error("Failed to load webhooks", zap.Error(err))
+		return
+	}
+
+	var body []byte
+	for i := range hooks {
+		w := hooks[i]
+		if !matches(&w, eventType, mkt) {
+			continue
+		}
+		if body == nil {
+			var err error
+			body, err = json.Marshal(Payload{Event: eventType, Mkt: mkt, Timestamp: time.Now(), Data: data})
+			if err != nil {
+				util.Logger.Error("Failed to encode webhook payload", zap.String("event", eventType), zap.Error(err))
+				return
+			}
+		}
+
+		inflight.Add(1)
+		go func() {
+			defer inflight.Done()
+			deliver(&w, eventType, body, maxAttempts)
+		}()
+	}
+}
+
+// Wait 等待 Dispatch 发起的投递（包括重试）全部结束，ctx 结束时放弃等待并返回其错误。服务退出前调用
+func Wait(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		inflight.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Ping 向指定 Webhook 同步发送一次测试事件（不重试），返回投递记录
+func Ping(w *model.Webhook) (*model.WebhookDelivery, error) {
+	body, err := json.Marshal(Payload{Event: EventPing, Timestamp: time.Now(), Data: map[string]interface{}{"webhook_id": w.ID}})
+	if err != nil {
+		return nil, err
+	}
+	return deliver(w, EventPing, body, 1), nil
+}
+
+// deliver 投递请求体，失败时按指数退避重试，每次尝试的结果都会写入投递记录
+func deliver(w *model.Webhook, eventType string, body []byte, attempts int) *model.WebhookDelivery {
+	d := &model.WebhookDelivery{WebhookID: w.ID, Event: eventType, Payload: string(body)}
+	if err := repo.DB.Create(d).Error; err != nil {
+		util.Logger.Warn("Failed to record webhook delivery", zap.Uint("webhook_id", w.ID), zap.Error(err))
+	}
+
+	backoff := retryBackoff
+	for attempt := 1; attempt <= attempts; attempt++ {
+		status, err := send(w, d.ID, eventType, body)
+		now := time.Now()
+		d.Attempts = attempt
+		d.StatusCode = status
+		d.DeliveredAt = &now
+		d.Success = err == nil
+		d.Error = ""
+		if err != nil {
+			d.Error = err.Error()
+		}
+		if d.ID != 0 {
+			repo.DB.Save(d)
+		}
+
+		if err == nil {
+			util.Logger.Info("Webhook delivered", zap.Uint("webhook_id", w.ID), zap.String("event", eventType), zap.Int("attempts", attempt))
+			return d
+		}
+		util.Logger.Warn("Webhook delivery failed",
+			zap.Uint("webhook_id", w.ID),
+			zap.String("event", eventType),
+			zap.Int("attempt", attempt),
+			zap.Int("status", status),
+			zap.Error(err))
+		if !retryable(status) || attempt == attempts {
+			break
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+	return d
+}
+
+func send(w *model.Webhook, deliveryID uint, eventType string, body []byte) (int, error) {
+	req, err := http.NewRequest(http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "BingPaper-Webhook")
+	req.Header.Set(EventHeader, eventType)
+	req.Header.Set(DeliveryHeader, fmt.Sprint(deliveryID))
+	if w.Secret != "" {
+		req.Header.Set(SignatureHeader, Sign(w.Secret, body))
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// retryable 网络错误、超时、限流和服务端错误会重试，其他 4xx 视为接收方拒绝
+func retryable(status int) bool {
+	return status == 0 || status == http.StatusRequestTimeout || status == http.StatusTooManyRequests || status >= 500
+}
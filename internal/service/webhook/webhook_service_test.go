@@ -0,0 +1,133 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"BingPaper/internal/model"
+	"BingPaper/internal/repo"
+	"BingPaper/internal/util"
+
+	"github.com/glebarez/sqlite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+func setupTestDB(t *testing.T) {
+	t.Helper()
+
+	util.Logger = zap.NewNop()
+	db, err := gorm.Open(sqlite.Open(fmt.Sprintf("file:%s?mode=memory&cache=shared", t.Name())), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, repo.AutoMigrateModels(db))
+	repo.DB = db
+
+	orig := retryBackoff
+	retryBackoff = time.Millisecond
+	t.Cleanup(func() { retryBackoff = orig })
+}
+
+func TestValidate(t *testing.T) {
+	assert.NoError(t, Validate(&model.Webhook{URL: "https://example.com/hook", Events: []string{EventImageCreated}, Mkts: []string{"zh-CN"}}))
+	assert.ErrorIs(t, Validate(&model.Webhook{URL: "ftp://example.com"}), ErrInvalidWebhook)
+	assert.ErrorIs(t, Validate(&model.Webhook{URL: "/relative"}), ErrInvalidWebhook)
+	assert.ErrorIs(t, Validate(&model.Webhook{URL: "https://example.com", Events: []string{"image.deleted"}}), ErrInvalidWebhook)
+	assert.ErrorIs(t, Validate(&model.Webhook{URL: "https://example.com", Mkts: []string{"not_a_region!"}}), ErrInvalidWebhook)
+}
+
+func TestMatches(t *testing.T) {
+	w := &model.Webhook{Events: []string{EventImageCreated, EventCleanupCompleted}, Mkts: []string{"zh-CN"}}
+	assert.True(t, matches(w, EventImageCreated, "zh-CN"))
+	assert.False(t, matches(w, EventImageCreated, "en-US"))
+	assert.False(t, matches(w, EventFetchFailed, "zh-CN"))
+	assert.True(t, matches(w, EventCleanupCompleted, ""))
+	assert.True(t, matches(&model.Webhook{}, EventFetchFailed, "en-US"))
+}
+
+func TestDispatchSignsAndRetries(t *testing.T) {
+	setupTestDB(t)
+
+	var calls atomic.Int32
+	received := make(chan *http.Request, 1)
+	var body []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		body, _ = io.ReadAll(r.Body)
+		received <- r
+	}))
+	defer srv.Close()
+
+	hook := &model.Webhook{URL: srv.URL, Secret: "s3cret", Mkts: []string{"zh-CN"}, Enabled: true}
+	require.NoError(t, Create(hook))
+	disabled := &model.Webhook{URL: srv.URL, Enabled: false}
+	require.NoError(t, Create(disabled))
+
+	Dispatch(EventImageCreated, "en-US", map[string]string{"title": "filtered"})
+	Dispatch(EventImageCreated, "zh-CN", map[string]string{"title": "Today"})
+	require.NoError(t, Wait(context.Background()))
+
+	r := <-received
+	assert.Equal(t, int32(3), calls.Load())
+	assert.Equal(t, EventImageCreated, r.Header.Get(EventHeader))
+	assert.Equal(t, Sign("s3cret", body), r.Header.Get(SignatureHeader))
+
+	var p Payload
+	require.NoError(t, json.Unmarshal(body, &p))
+	assert.Equal(t, EventImageCreated, p.Event)
+	assert.Equal(t, "zh-CN", p.Mkt)
+	assert.Equal(t, "Today", p.Data.(map[string]interface{})["title"])
+
+	deliveries, err := ListDeliveries(hook.ID, 0)
+	require.NoError(t, err)
+	require.Len(t, deliveries, 1)
+	assert.True(t, deliveries[0].Success)
+	assert.Equal(t, 3, deliveries[0].Attempts)
+	assert.Equal(t, http.StatusOK, deliveries[0].StatusCode)
+	assert.Equal(t, r.Header.Get(DeliveryHeader), fmt.Sprint(deliveries[0].ID))
+
+	others, err := ListDeliveries(disabled.ID, 0)
+	require.NoError(t, err)
+	assert.Empty(t, others)
+}
+
+func TestDeliverStopsOnClientError(t *testing.T) {
+	setupTestDB(t)
+
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusGone)
+	}))
+	defer srv.Close()
+
+	hook := &model.Webhook{URL: srv.URL, Enabled: true}
+	require.NoError(t, Create(hook))
+	assert.NotEmpty(t, hook.Secret)
+	// 密钥不随记录序列化输出
+	data, err := json.Marshal(hook)
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), hook.Secret)
+
+	Dispatch(EventFetchFailed, "en-US", map[string]string{"error": "boom"})
+	require.NoError(t, Wait(context.Background()))
+
+	assert.Equal(t, int32(1), calls.Load())
+	deliveries, err := ListDeliveries(hook.ID, 0)
+	require.NoError(t, err)
+	require.Len(t, deliveries, 1)
+	assert.False(t, deliveries[0].Success)
+	assert.Equal(t, http.StatusGone, deliveries[0].StatusCode)
+	assert.Contains(t, deliveries[0].Error, "410")
+}
@@ -0,0 +1,97 @@
+package backend
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"BingPaper/internal/config"
+	"BingPaper/internal/storage"
+	"BingPaper/internal/storage/cache"
+	"BingPaper/internal/storage/local"
+	"BingPaper/internal/storage/replicated"
+	"BingPaper/internal/storage/s3"
+	"BingPaper/internal/storage/webdav"
+)
+
+// New 根据配置创建存储后端，type 为空或未知时使用本地存储
+func New(cfg config.StorageConfig) (storage.Storage, error) {
+	switch cfg.Type {
+	case "replicated":
+		backends := cfg.Replicated.Backends
+		if len(backends) == 0 {
+			return nil, fmt.Errorf("replicated storage requires at least one backend")
+		}
+		members := make([]replicated.Backend, 0, len(backends))
+		for i, b := range backends {
+			if b.Type == "replicated" {
+				return nil, fmt.Errorf("replicated storage backend %d cannot be replicated", i)
+			}
+			s, err := New(b)
+			if err != nil {
+				return nil, fmt.Errorf("replicated storage backend %d: %w", i, err)
+			}
+			members = append(members, replicated.Backend{Name: Location(b), Storage: s})
+		}
+		return replicated.NewReplicatedStorage(members[0], members[1:]...), nil
+	case "s3":
+		return s3.NewS3Storage(
+			cfg.S3.Endpoint,
+			cfg.S3.Region,
+			cfg.S3.Bucket,
+			cfg.S3.AccessKey,
+			cfg.S3.SecretKey,
+			cfg.S3.PublicURLPrefix,
+			cfg.S3.ForcePathStyle,
+			presignTTL(cfg.S3),
+		)
+	case "webdav":
+		return webdav.NewWebDAVStorage(
+			cfg.WebDAV.URL,
+			cfg.WebDAV.Username,
+			cfg.WebDAV.Password,
+			cfg.WebDAV.PublicURLPrefix,
+		)
+	default:
+		return local.NewLocalStorage(cfg.Local.Root)
+	}
+}
+
+// WithCache 按配置为远程存储加上本地磁盘缓存，未开启或为本地存储时原样返回
+func WithCache(s storage.Storage, cfg config.StorageConfig) (storage.Storage, error) {
+	if !cfg.Cache.Enabled || cfg.Type == "" || cfg.Type == "local" {
+		return s, nil
+	}
+	return cache.NewCachedStorage(s, cfg.Cache.Dir, cfg.Cache.MaxSizeMB<<20)
+}
+
+// Location 返回存储位置的标识（不含凭据），用于判断两个配置是否指向同一存储
+func Location(cfg config.StorageConfig) string {
+	switch cfg.Type {
+	case "replicated":
+		locations := make([]string, 0, len(cfg.Replicated.Backends))
+		for _, b := range cfg.Replicated.Backends {
+			locations = append(locations, Location(b))
+		}
+		return "replicated:" + strings.Join(locations, ",")
+	case "s3":
+		return fmt.Sprintf("s3:%s/%s", strings.TrimSuffix(cfg.S3.Endpoint, "/"), cfg.S3.Bucket)
+	case "webdav":
+		return "webdav:" + strings.TrimSuffix(cfg.WebDAV.URL, "/")
+	default:
+		root, err := filepath.Abs(cfg.Local.Root)
+		if err != nil {
+			root = cfg.Local.Root
+		}
+		return "local:" + root
+	}
+}
+
+// presignTTL 未开启预签名时返回 0
+func presignTTL(cfg config.S3Config) time.Duration {
+	if !cfg.Presign {
+		return 0
+	}
+	return cfg.GetPresignTTL()
+}
@@ -0,0 +1,44 @@
+package backend
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"BingPaper/internal/config"
+	"BingPaper/internal/storage/replicated"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewReplicated(t *testing.T) {
+	dir := t.TempDir()
+	primary, replica := filepath.Join(dir, "primary"), filepath.Join(dir, "replica")
+	configPath := filepath.Join(dir, "config.yaml")
+	require.NoError(t, os.WriteFile(configPath, []byte(`
+storage:
+  type: replicated
+  replicated:
+    backends:
+      - type: local
+        local:
+          root: `+primary+`
+      - type: local
+        local:
+          root: `+replica+`
+`), 0644))
+	require.NoError(t, config.Init(configPath))
+
+	cfg := config.GetConfig().Storage
+	require.Len(t, cfg.Replicated.Backends, 2)
+	s, err := New(cfg)
+	require.NoError(t, err)
+	assert.IsType(t, &replicated.ReplicatedStorage{}, s)
+	assert.Equal(t, "replicated:local:"+primary+",local:"+replica, Location(cfg))
+
+	_, err = New(config.StorageConfig{Type: "replicated"})
+	assert.Error(t, err)
+	_, err = New(config.StorageConfig{Type: "replicated", Replicated: config.ReplicatedConfig{Backends: []config.StorageConfig{cfg}}})
+	assert.Error(t, err)
+}
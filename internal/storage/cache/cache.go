@@ -0,0 +1,345 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"BingPaper/internal/storage"
+	"BingPaper/internal/util"
+
+	"go.uber.org/zap"
+)
+
+// tmpDir 缓存目录下存放下载中文件的子目录，不参与索引
+const tmpDir = ".tmp"
+
+// entry 一个缓存对象
+type entry struct {
+	key          string
+	size         int64
+	contentType  string
+	etag         string
+	lastModified time.Time
+}
+
+// CachedStorage 在远程存储前加一层本地磁盘缓存，按字节预算进行 LRU 淘汰。
+// 只缓存 Get 读取的对象，Put/Delete 会使对应缓存失效；其余操作直接委托给底层存储。
+type CachedStorage struct {
+	storage.Storage
+	dir      string
+	maxBytes int64
+
+	mu      sync.Mutex
+	lru     *list.List // 前端为最近使用
+	entries map[string]*list.Element
+	size    int64
+	fills   map[string]*fillCall // 正在从底层存储下载的对象
+}
+
+// fillCall 一次进行中的缓存填充，同一对象的并发未命中请求等待它完成后读取缓存
+type fillCall struct {
+	done chan struct{}
+	// stale 下载期间对象被 Put/Delete 置为 true，此时下载到的可能是旧内容，不能写入缓存
+	stale bool
+}
+
+// NewCachedStorage 创建缓存存储，并索引缓存目录中已有的文件
+func NewCachedStorage(inner storage.Storage, dir string, maxBytes int64) (*CachedStorage, error) {
+	if maxBytes <= 0 {
+		return nil, fmt.Errorf("cache size must be positive")
+	}
+	if err := os.RemoveAll(filepath.Join(dir, tmpDir)); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Join(dir, tmpDir), 0755); err != nil {
+		return nil, err
+	}
+
+	c := &CachedStorage{
+		Storage:  inner,
+		dir:      dir,
+		maxBytes: maxBytes,
+		lru:      list.New(),
+		entries:  make(map[string]*list.Element),
+		fills:    make(map[string]*fillCall),
+	}
+	if err := c.load(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *CachedStorage) load() error {
+	var files []entry
+	err := filepath.WalkDir(c.dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if d.Name() == tmpDir {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		rel, err := filepath.Rel(c.dir, p)
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		files = append(files, entry{key: key, size: info.Size(), contentType: mime.TypeByExtension(path.Ext(key)), lastModified: info.ModTime()})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// 缓存文件的修改时间为对象的最后修改时间，重启后以此近似恢复使用顺序（较新的图片通常更热）
+	sort.Slice(files, func(i, j int) bool { return files[i].lastModified.Before(files[j].lastModified) })
+	for i := range files {
+		e := files[i]
+		c.entries[e.key] = c.lru.PushFront(&e)
+		c.size += e.size
+	}
+	c.evictLocked()
+	util.Logger.Info("Storage cache loaded", zap.String("dir", c.dir), zap.Int("objects", len(c.entries)), zap.Int64("bytes", c.size))
+	return nil
+}
+
+// path 返回 key 对应的缓存文件路径，拒绝指向缓存目录之外的 key
+func (c *CachedStorage) path(key string) (string, bool) {
+	p := filepath.Join(c.dir, filepath.FromSlash(key))
+	if !strings.HasPrefix(p, filepath.Clean(c.dir)+string(os.PathSeparator)) || strings.HasPrefix(key, tmpDir+"/") {
+		return "", false
+	}
+	return p, true
+}
+
+func (c *CachedStorage) lookup(key string) (entry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.entries[key]
+	if !ok {
+		return entry{}, false
+	}
+	c.lru.MoveToFront(el)
+	return *el.Value.(*entry), true
+}
+
+func (c *CachedStorage) Get(ctx context.Context, key string) (io.ReadCloser, string, error) {
+	p, ok := c.path(key)
+	if !ok {
+		return c.Storage.Get(ctx, key)
+	}
+	if e, ok := c.lookup(key); ok {
+		if f, err := os.Open(p); err == nil {
+			return f, e.contentType, nil
+		}
+		// 缓存文件被外部删除
+		c.invalidate(key)
+	}
+
+	c.mu.Lock()
+	if call, ok := c.fills[key]; ok {
+		c.mu.Unlock()
+		// 已有请求在下载同一对象，等待其写入缓存后直接读取
+		select {
+		case <-call.done:
+		case <-ctx.Done():
+			return nil, "", ctx.Err()
+		}
+		if e, ok := c.lookup(key); ok {
+			if f, err := os.Open(p); err == nil {
+				return f, e.contentType, nil
+			}
+		}
+		// 对象过大、下载失败或期间被修改而没有写入缓存时，直接读取底层存储
+		return c.Storage.Get(ctx, key)
+	}
+	call := &fillCall{done: make(chan struct{})}
+	c.fills[key] = call
+	c.mu.Unlock()
+
+	defer func() {
+		c.mu.Lock()
+		delete(c.fills, key)
+		c.mu.Unlock()
+		close(call.done)
+	}()
+	return c.fill(ctx, key, p, call)
+}
+
+// fill 从底层存储下载对象并写入缓存
+func (c *CachedStorage) fill(ctx context.Context, key, p string, call *fillCall) (io.ReadCloser, string, error) {
+	reader, contentType, err := c.Storage.Get(ctx, key)
+	if err != nil {
+		return nil, "", err
+	}
+	defer reader.Close()
+
+	tmp, err := os.CreateTemp(filepath.Join(c.dir, tmpDir), "object-*")
+	if err != nil {
+		return nil, "", err
+	}
+	size, err := io.Copy(tmp, reader)
+	if err == nil {
+		_, err = tmp.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return nil, "", err
+	}
+
+	e := entry{key: key, size: size, contentType: contentType}
+	if stat, err := c.Storage.Stat(ctx, key); err == nil {
+		e.etag, e.lastModified = stat.ETag, stat.LastModified
+		if e.contentType == "" {
+			e.contentType = stat.ContentType
+		}
+	}
+	if e.contentType == "" {
+		e.contentType = mime.TypeByExtension(path.Ext(key))
+	}
+
+	// 超出预算的对象不缓存，读取完后删除临时文件
+	if size > c.maxBytes {
+		return &tempFile{File: tmp}, e.contentType, nil
+	}
+	committed, err := c.commit(tmp.Name(), p, &e, call)
+	if err != nil {
+		util.Logger.Warn("Failed to write storage cache", zap.String("key", key), zap.Error(err))
+	}
+	if !committed {
+		return &tempFile{File: tmp}, e.contentType, nil
+	}
+	// 已打开的文件句柄在重命名后仍然有效
+	return tmp, e.contentType, nil
+}
+
+// commit 将下载好的临时文件移入缓存，下载期间对象被修改时放弃写入并返回 false
+func (c *CachedStorage) commit(tmp, p string, e *entry, call *fillCall) (bool, error) {
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return false, err
+	}
+	if !e.lastModified.IsZero() {
+		os.Chtimes(tmp, time.Now(), e.lastModified)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if call.stale {
+		return false, nil
+	}
+	if err := os.Rename(tmp, p); err != nil {
+		return false, err
+	}
+	if el, ok := c.entries[e.key]; ok {
+		c.size -= el.Value.(*entry).size
+		c.lru.Remove(el)
+	}
+	c.entries[e.key] = c.lru.PushFront(e)
+	c.size += e.size
+	c.evictLocked()
+	return true, nil
+}
+
+// evictLocked 淘汰最久未使用的对象直到不超过预算，调用方需持有锁
+func (c *CachedStorage) evictLocked() {
+	for c.size > c.maxBytes {
+		el := c.lru.Back()
+		if el == nil {
+			return
+		}
+		e := el.Value.(*entry)
+		c.removeLocked(el)
+		util.Logger.Debug("Evicted object from storage cache", zap.String("key", e.key))
+	}
+}
+
+func (c *CachedStorage) removeLocked(el *list.Element) {
+	e := el.Value.(*entry)
+	c.lru.Remove(el)
+	delete(c.entries, e.key)
+	c.size -= e.size
+	if p, ok := c.path(e.key); ok {
+		os.Remove(p)
+	}
+}
+
+func (c *CachedStorage) invalidate(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.entries[key]; ok {
+		c.removeLocked(el)
+	}
+	if call, ok := c.fills[key]; ok {
+		call.stale = true
+	}
+}
+
+func (c *CachedStorage) Put(ctx context.Context, key string, r io.Reader, contentType string) (storage.StoredObject, error) {
+	c.invalidate(key)
+	stored, err := c.Storage.Put(ctx, key, r, contentType)
+	// 上传期间的并发读取可能缓存了旧内容
+	c.invalidate(key)
+	return stored, err
+}
+
+func (c *CachedStorage) Delete(ctx context.Context, key string) error {
+	c.invalidate(key)
+	return c.Storage.Delete(ctx, key)
+}
+
+// Walk 委托给底层存储，保留其 Walker 实现
+func (c *CachedStorage) Walk(ctx context.Context, prefix string, fn func(storage.ObjectInfo) error) error {
+	return storage.Walk(ctx, c.Storage, prefix, fn)
+}
+
+// Stat 命中缓存时直接返回缓存的元数据，避免每次请求都访问远程存储
+func (c *CachedStorage) Stat(ctx context.Context, key string) (storage.ObjectStat, error) {
+	if e, ok := c.lookup(key); ok {
+		return storage.ObjectStat{Key: key, Size: e.size, ContentType: e.contentType, ETag: e.etag, LastModified: e.lastModified}, nil
+	}
+	return c.Storage.Stat(ctx, key)
+}
+
+// PresignedURL 底层存储支持预签名时委托给底层存储
+func (c *CachedStorage) PresignedURL(ctx context.Context, key string) (string, time.Time, error) {
+	if p, ok := c.Storage.(storage.Presigner); ok {
+		return p.PresignedURL(ctx, key)
+	}
+	return "", time.Time{}, storage.ErrPresignDisabled
+}
+
+// Usage 返回缓存的对象数与占用字节数
+func (c *CachedStorage) Usage() (int, int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.entries), c.size
+}
+
+// tempFile 关闭时删除的临时文件
+type tempFile struct{ *os.File }
+
+func (f *tempFile) Close() error {
+	err := f.File.Close()
+	os.Remove(f.Name())
+	return err
+}
@@ -0,0 +1,191 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"BingPaper/internal/storage"
+	"BingPaper/internal/storage/local"
+	"BingPaper/internal/util"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// countingStorage 统计底层存储的读取次数
+type countingStorage struct {
+	*local.LocalStorage
+	gets int
+}
+
+func (s *countingStorage) Get(ctx context.Context, key string) (io.ReadCloser, string, error) {
+	s.gets++
+	return s.LocalStorage.Get(ctx, key)
+}
+
+func read(t *testing.T, s storage.Storage, key string) string {
+	t.Helper()
+	reader, _, err := s.Get(context.Background(), key)
+	require.NoError(t, err)
+	defer reader.Close()
+	data, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	return string(data)
+}
+
+func TestCachedStorage(t *testing.T) {
+	util.Logger = zap.NewNop()
+	ctx := context.Background()
+
+	remote, err := local.NewLocalStorage(t.TempDir())
+	require.NoError(t, err)
+	inner := &countingStorage{LocalStorage: remote}
+	for _, key := range []string{"a/a_UHD.jpg", "b/b_UHD.jpg", "c/c_UHD.jpg"} {
+		_, err := remote.Put(ctx, key, strings.NewReader(strings.Repeat(key[:1], 10)), "image/jpeg")
+		require.NoError(t, err)
+	}
+
+	dir := t.TempDir()
+	c, err := NewCachedStorage(inner, dir, 25)
+	require.NoError(t, err)
+
+	// 第二次读取命中缓存
+	assert.Equal(t, strings.Repeat("a", 10), read(t, c, "a/a_UHD.jpg"))
+	assert.Equal(t, strings.Repeat("a", 10), read(t, c, "a/a_UHD.jpg"))
+	assert.Equal(t, 1, inner.gets)
+	stat, err := c.Stat(ctx, "a/a_UHD.jpg")
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), stat.Size)
+	assert.Equal(t, "image/jpeg", stat.ContentType)
+	assert.False(t, stat.LastModified.IsZero())
+
+	// 超出预算时淘汰最久未使用的 b
+	read(t, c, "b/b_UHD.jpg")
+	read(t, c, "a/a_UHD.jpg")
+	read(t, c, "c/c_UHD.jpg")
+	objects, size := c.Usage()
+	assert.Equal(t, 2, objects)
+	assert.Equal(t, int64(20), size)
+	inner.gets = 0
+	read(t, c, "a/a_UHD.jpg")
+	assert.Equal(t, 0, inner.gets)
+	read(t, c, "b/b_UHD.jpg")
+	assert.Equal(t, 1, inner.gets)
+
+	// Put 使缓存失效
+	_, err = c.Put(ctx, "b/b_UHD.jpg", strings.NewReader("updated"), "image/jpeg")
+	require.NoError(t, err)
+	assert.Equal(t, "updated", read(t, c, "b/b_UHD.jpg"))
+
+	// Delete 同时删除缓存
+	require.NoError(t, c.Delete(ctx, "b/b_UHD.jpg"))
+	_, _, err = c.Get(ctx, "b/b_UHD.jpg")
+	assert.Error(t, err)
+
+	// 重启后恢复已有缓存
+	reopened, err := NewCachedStorage(inner, dir, 25)
+	require.NoError(t, err)
+	objects, _ = reopened.Usage()
+	assert.Equal(t, objects, func() int { n, _ := c.Usage(); return n }())
+	inner.gets = 0
+	read(t, reopened, "a/a_UHD.jpg")
+	assert.Equal(t, 0, inner.gets)
+}
+
+func TestCachedStorageSkipsLargeObjects(t *testing.T) {
+	util.Logger = zap.NewNop()
+	remote, err := local.NewLocalStorage(t.TempDir())
+	require.NoError(t, err)
+	_, err = remote.Put(context.Background(), "big/big_UHD.jpg", strings.NewReader(strings.Repeat("x", 100)), "image/jpeg")
+	require.NoError(t, err)
+
+	c, err := NewCachedStorage(remote, t.TempDir(), 10)
+	require.NoError(t, err)
+	assert.Equal(t, 100, len(read(t, c, "big/big_UHD.jpg")))
+	objects, size := c.Usage()
+	assert.Zero(t, objects)
+	assert.Zero(t, size)
+}
+
+// slowStorage 读取对象内容后阻塞，直到 release 被关闭才返回，用于模拟下载耗时
+type slowStorage struct {
+	*local.LocalStorage
+	gets    atomic.Int32
+	started chan struct{}
+	release chan struct{}
+}
+
+func (s *slowStorage) Get(ctx context.Context, key string) (io.ReadCloser, string, error) {
+	reader, contentType, err := s.LocalStorage.Get(ctx, key)
+	if err != nil {
+		return nil, "", err
+	}
+	data, err := io.ReadAll(reader)
+	reader.Close()
+	if err != nil {
+		return nil, "", err
+	}
+	if s.gets.Add(1) == 1 {
+		close(s.started)
+	}
+	<-s.release
+	return io.NopCloser(bytes.NewReader(data)), contentType, nil
+}
+
+func newSlowStorage(t *testing.T, key, content string) *slowStorage {
+	remote, err := local.NewLocalStorage(t.TempDir())
+	require.NoError(t, err)
+	_, err = remote.Put(context.Background(), key, strings.NewReader(content), "image/jpeg")
+	require.NoError(t, err)
+	return &slowStorage{LocalStorage: remote, started: make(chan struct{}), release: make(chan struct{})}
+}
+
+func TestCachedStorageDropsStaleFill(t *testing.T) {
+	util.Logger = zap.NewNop()
+	inner := newSlowStorage(t, "a/a_UHD.jpg", "old")
+	c, err := NewCachedStorage(inner, t.TempDir(), 100)
+	require.NoError(t, err)
+
+	result := make(chan string)
+	go func() { result <- read(t, c, "a/a_UHD.jpg") }()
+	<-inner.started
+
+	// 下载期间写入新内容，进行中的下载拿到的是旧内容，不能写入缓存
+	_, err = c.Put(context.Background(), "a/a_UHD.jpg", strings.NewReader("new"), "image/jpeg")
+	require.NoError(t, err)
+	close(inner.release)
+	assert.Equal(t, "old", <-result)
+
+	objects, _ := c.Usage()
+	assert.Zero(t, objects)
+	assert.Equal(t, "new", read(t, c, "a/a_UHD.jpg"))
+}
+
+func TestCachedStorageCoalescesMisses(t *testing.T) {
+	util.Logger = zap.NewNop()
+	inner := newSlowStorage(t, "a/a_UHD.jpg", "content")
+	c, err := NewCachedStorage(inner, t.TempDir(), 100)
+	require.NoError(t, err)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.Equal(t, "content", read(t, c, "a/a_UHD.jpg"))
+		}()
+	}
+	<-inner.started
+	time.Sleep(20 * time.Millisecond)
+	close(inner.release)
+	wg.Wait()
+
+	assert.Equal(t, int32(1), inner.gets.Load())
+}
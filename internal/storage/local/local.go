@@ -2,9 +2,14 @@ package local
 
 import (
 	"context"
+	"fmt"
 	"io"
+	"io/fs"
+	"mime"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 
 	"BingPaper/internal/storage"
 )
@@ -48,6 +53,9 @@ func (l *LocalStorage) Get(ctx context.Context, key string) (io.ReadCloser, stri
 	path := filepath.Join(l.root, key)
 	f, err := os.Open(path)
 	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, "", fmt.Errorf("%w: %s", storage.ErrNotFound, key)
+		}
 		return nil, "", err
 	}
 	// 这里很难从文件扩展名以外的地方获得 contentType，除非存储时记录
@@ -57,7 +65,13 @@ func (l *LocalStorage) Get(ctx context.Context, key string) (io.ReadCloser, stri
 
 func (l *LocalStorage) Delete(ctx context.Context, key string) error {
 	path := filepath.Join(l.root, key)
-	return os.Remove(path)
+	if err := os.Remove(path); err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("%w: %s", storage.ErrNotFound, key)
+		}
+		return err
+	}
+	return nil
 }
 
 func (l *LocalStorage) PublicURL(key string) (string, bool) {
@@ -75,3 +89,73 @@ func (l *LocalStorage) Exists(ctx context.Context, key string) (bool, error) {
 	}
 	return false, err
 }
+
+func (l *LocalStorage) Stat(ctx context.Context, key string) (storage.ObjectStat, error) {
+	info, err := os.Stat(filepath.Join(l.root, key))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return storage.ObjectStat{}, fmt.Errorf("%w: %s", storage.ErrNotFound, key)
+		}
+		return storage.ObjectStat{}, err
+	}
+	if info.IsDir() {
+		return storage.ObjectStat{}, fmt.Errorf("%w: %s", storage.ErrNotFound, key)
+	}
+	// 本地文件不记录 contentType 与 ETag，分别由扩展名和修改时间、大小推导
+	return storage.ObjectStat{
+		Key:          key,
+		Size:         info.Size(),
+		ContentType:  mime.TypeByExtension(filepath.Ext(key)),
+		ETag:         fmt.Sprintf("%x-%x", info.ModTime().UnixNano(), info.Size()),
+		LastModified: info.ModTime(),
+	}, nil
+}
+
+func (l *LocalStorage) List(ctx context.Context, prefix string, opts storage.ListOptions) (storage.ListPage, error) {
+	// 本地文件系统无法按 Key 定位翻页，遍历全部对象后排序分页
+	var objects []storage.ObjectInfo
+	err := l.Walk(ctx, prefix, func(obj storage.ObjectInfo) error {
+		objects = append(objects, obj)
+		return nil
+	})
+	if err != nil {
+		return storage.ListPage{}, err
+	}
+
+	sort.Slice(objects, func(i, j int) bool { return objects[i].Key < objects[j].Key })
+	return storage.PageObjects(objects, opts), nil
+}
+
+// Walk 一次遍历以 prefix 开头的全部对象，实现 storage.Walker
+func (l *LocalStorage) Walk(ctx context.Context, prefix string, fn func(storage.ObjectInfo) error) error {
+	// 从 prefix 所在的目录开始遍历，避免扫描整个根目录
+	dir := l.root
+	if idx := strings.LastIndex(prefix, "/"); idx != -1 {
+		dir = filepath.Join(l.root, filepath.FromSlash(prefix[:idx]))
+	}
+
+	return filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && p == dir {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if d.IsDir() {
+			return ctx.Err()
+		}
+		rel, err := filepath.Rel(l.root, p)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		return fn(storage.ObjectInfo{Key: key, Size: info.Size(), LastModified: info.ModTime()})
+	})
+}
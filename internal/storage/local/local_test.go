@@ -0,0 +1,85 @@
+package local
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"BingPaper/internal/storage"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestList(t *testing.T) {
+	s, err := NewLocalStorage(t.TempDir())
+	require.NoError(t, err)
+	ctx := context.Background()
+	for _, key := range []string{"b/b_UHD.jpg", "a/a_UHD.jpg", "a/a_1920x1080.jpg", "a-c/a-c_UHD.jpg", "daily.jpeg"} {
+		_, err := s.Put(ctx, key, strings.NewReader(key), "image/jpeg")
+		require.NoError(t, err)
+	}
+
+	page, err := s.List(ctx, "", storage.ListOptions{Limit: 2})
+	require.NoError(t, err)
+	require.Len(t, page.Objects, 2)
+	assert.Equal(t, "a-c/a-c_UHD.jpg", page.Objects[0].Key)
+	assert.Equal(t, "a/a_1920x1080.jpg", page.Objects[1].Key)
+	assert.Equal(t, int64(len("a/a_1920x1080.jpg")), page.Objects[1].Size)
+	assert.Equal(t, "a/a_1920x1080.jpg", page.Next)
+
+	var keys []string
+	require.NoError(t, storage.Walk(ctx, s, "", func(obj storage.ObjectInfo) error {
+		keys = append(keys, obj.Key)
+		return nil
+	}))
+	assert.ElementsMatch(t, []string{"a-c/a-c_UHD.jpg", "a/a_1920x1080.jpg", "a/a_UHD.jpg", "b/b_UHD.jpg", "daily.jpeg"}, keys)
+
+	// Walk 一次遍历全部对象，不按页调用 List
+	keys = nil
+	require.NoError(t, storage.Walk(ctx, noListStorage{s}, "a/", func(obj storage.ObjectInfo) error {
+		keys = append(keys, obj.Key)
+		return nil
+	}))
+	assert.ElementsMatch(t, []string{"a/a_1920x1080.jpg", "a/a_UHD.jpg"}, keys)
+
+	page, err = s.List(ctx, "a/", storage.ListOptions{})
+	require.NoError(t, err)
+	assert.Len(t, page.Objects, 2)
+	assert.Empty(t, page.Next)
+
+	page, err = s.List(ctx, "missing/", storage.ListOptions{})
+	require.NoError(t, err)
+	assert.Empty(t, page.Objects)
+}
+
+type noListStorage struct{ *LocalStorage }
+
+func (noListStorage) List(ctx context.Context, prefix string, opts storage.ListOptions) (storage.ListPage, error) {
+	return storage.ListPage{}, errors.New("unexpected List call")
+}
+
+func TestStat(t *testing.T) {
+	s, err := NewLocalStorage(t.TempDir())
+	require.NoError(t, err)
+	ctx := context.Background()
+	_, err = s.Put(ctx, "a/a_UHD.jpg", strings.NewReader("12345"), "image/jpeg")
+	require.NoError(t, err)
+
+	stat, err := s.Stat(ctx, "a/a_UHD.jpg")
+	require.NoError(t, err)
+	assert.Equal(t, "a/a_UHD.jpg", stat.Key)
+	assert.Equal(t, int64(5), stat.Size)
+	assert.Equal(t, "image/jpeg", stat.ContentType)
+	assert.NotEmpty(t, stat.ETag)
+	assert.False(t, stat.LastModified.IsZero())
+
+	_, err = s.Stat(ctx, "a/missing.jpg")
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+	_, err = s.Stat(ctx, "a")
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+	_, _, err = s.Get(ctx, "a/missing.jpg")
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+	assert.ErrorIs(t, s.Delete(ctx, "a/missing.jpg"), storage.ErrNotFound)
+}
@@ -0,0 +1,199 @@
+package replicated
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"BingPaper/internal/storage"
+	"BingPaper/internal/util"
+
+	"go.uber.org/zap"
+)
+
+// unhealthyCooldown 后端出错后被跳过的时长，之后重新尝试
+const unhealthyCooldown = 30 * time.Second
+
+// Backend 参与复制的一个后端
+type Backend struct {
+	Name    string // 用于日志，通常为存储位置标识
+	Storage storage.Storage
+}
+
+// ReplicatedStorage 将对象写入主存储及全部副本，读取时按顺序使用第一个健康的后端。
+// 主存储写入失败时整个写入失败；副本写入失败只记录日志，可通过存储检查或迁移补齐。
+type ReplicatedStorage struct {
+	backends []Backend
+
+	mu        sync.Mutex
+	downUntil map[int]time.Time
+}
+
+func NewReplicatedStorage(primary Backend, replicas ...Backend) *ReplicatedStorage {
+	return &ReplicatedStorage{
+		backends:  append([]Backend{primary}, replicas...),
+		downUntil: make(map[int]time.Time),
+	}
+}
+
+// order 返回读取时尝试后端的顺序：健康的后端在前，全部不健康时仍会逐个尝试
+func (r *ReplicatedStorage) order() []int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	healthy := make([]int, 0, len(r.backends))
+	var down []int
+	for i := range r.backends {
+		if until, ok := r.downUntil[i]; ok && now.Before(until) {
+			down = append(down, i)
+			continue
+		}
+		healthy = append(healthy, i)
+	}
+	return append(healthy, down...)
+}
+
+// observe 根据调用结果更新后端的健康状态，对象不存在不视为故障
+func (r *ReplicatedStorage) observe(i int, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err == nil || storage.IsNotFound(err) {
+		delete(r.downUntil, i)
+		return
+	}
+	if _, ok := r.downUntil[i]; !ok {
+		util.Logger.Warn("Storage backend marked unhealthy", zap.String("backend", r.backends[i].Name), zap.Error(err))
+	}
+	r.downUntil[i] = time.Now().Add(unhealthyCooldown)
+}
+
+func (r *ReplicatedStorage) Put(ctx context.Context, key string, rd io.Reader, contentType string) (storage.StoredObject, error) {
+	// 需要写入多个后端，先读入内存
+	data, err := io.ReadAll(rd)
+	if err != nil {
+		return storage.StoredObject{}, err
+	}
+
+	stored, err := r.backends[0].Storage.Put(ctx, key, bytes.NewReader(data), contentType)
+	r.observe(0, err)
+	if err != nil {
+		return storage.StoredObject{}, err
+	}
+	for i, b := range r.backends[1:] {
+		_, err := b.Storage.Put(ctx, key, bytes.NewReader(data), contentType)
+		r.observe(i+1, err)
+		if err != nil {
+			util.Logger.Warn("Failed to write replica", zap.String("backend", b.Name), zap.String("key", key), zap.Error(err))
+		}
+	}
+	return stored, nil
+}
+
+func (r *ReplicatedStorage) Get(ctx context.Context, key string) (io.ReadCloser, string, error) {
+	var errs []error
+	for _, i := range r.order() {
+		reader, contentType, err := r.backends[i].Storage.Get(ctx, key)
+		r.observe(i, err)
+		if err == nil {
+			return reader, contentType, nil
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", r.backends[i].Name, err))
+	}
+	return nil, "", errors.Join(errs...)
+}
+
+// Delete 从全部后端删除对象，只返回主存储的错误
+func (r *ReplicatedStorage) Delete(ctx context.Context, key string) error {
+	var primaryErr error
+	for i, b := range r.backends {
+		err := b.Storage.Delete(ctx, key)
+		r.observe(i, err)
+		if i == 0 {
+			primaryErr = err
+		} else if err != nil && !storage.IsNotFound(err) {
+			util.Logger.Warn("Failed to delete replica object", zap.String("backend", b.Name), zap.String("key", key), zap.Error(err))
+		}
+	}
+	return primaryErr
+}
+
+func (r *ReplicatedStorage) PublicURL(key string) (string, bool) {
+	return r.backends[0].Storage.PublicURL(key)
+}
+
+// PresignedURL 主存储支持预签名时委托给主存储
+func (r *ReplicatedStorage) PresignedURL(ctx context.Context, key string) (string, time.Time, error) {
+	if p, ok := r.backends[0].Storage.(storage.Presigner); ok {
+		return p.PresignedURL(ctx, key)
+	}
+	return "", time.Time{}, storage.ErrPresignDisabled
+}
+
+func (r *ReplicatedStorage) Exists(ctx context.Context, key string) (bool, error) {
+	var lastErr error
+	for _, i := range r.order() {
+		exists, err := r.backends[i].Storage.Exists(ctx, key)
+		r.observe(i, err)
+		if err == nil {
+			return exists, nil
+		}
+		lastErr = err
+	}
+	return false, lastErr
+}
+
+// List 遍历第一个健康后端中的对象，正常情况下即主存储
+func (r *ReplicatedStorage) List(ctx context.Context, prefix string, opts storage.ListOptions) (storage.ListPage, error) {
+	var lastErr error
+	for _, i := range r.order() {
+		page, err := r.backends[i].Storage.List(ctx, prefix, opts)
+		r.observe(i, err)
+		if err == nil {
+			return page, nil
+		}
+		lastErr = err
+	}
+	return storage.ListPage{}, lastErr
+}
+
+// Walk 遍历第一个健康后端中的对象。已经向 fn 返回过对象后出错时不再切换后端，避免重复遍历
+func (r *ReplicatedStorage) Walk(ctx context.Context, prefix string, fn func(storage.ObjectInfo) error) error {
+	var lastErr error
+	for _, i := range r.order() {
+		visited := false
+		var fnErr error
+		err := storage.Walk(ctx, r.backends[i].Storage, prefix, func(obj storage.ObjectInfo) error {
+			visited = true
+			fnErr = fn(obj)
+			return fnErr
+		})
+		if fnErr != nil {
+			return fnErr
+		}
+		r.observe(i, err)
+		if err == nil || visited {
+			return err
+		}
+		lastErr = err
+	}
+	return lastErr
+}
+
+func (r *ReplicatedStorage) Stat(ctx context.Context, key string) (storage.ObjectStat, error) {
+	var errs []error
+	for _, i := range r.order() {
+		stat, err := r.backends[i].Storage.Stat(ctx, key)
+		r.observe(i, err)
+		if err == nil {
+			return stat, nil
+		}
+		errs = append(errs, err)
+	}
+	return storage.ObjectStat{}, errors.Join(errs...)
+}
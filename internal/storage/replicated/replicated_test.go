@@ -0,0 +1,124 @@
+package replicated
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"BingPaper/internal/storage"
+	"BingPaper/internal/storage/local"
+	"BingPaper/internal/util"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+var errOffline = errors.New("dial tcp: connection refused")
+
+// flakyStorage 模拟可能离线的后端
+type flakyStorage struct {
+	*local.LocalStorage
+	offline bool
+	gets    int
+}
+
+func (f *flakyStorage) Get(ctx context.Context, key string) (io.ReadCloser, string, error) {
+	f.gets++
+	if f.offline {
+		return nil, "", errOffline
+	}
+	return f.LocalStorage.Get(ctx, key)
+}
+
+func (f *flakyStorage) Stat(ctx context.Context, key string) (storage.ObjectStat, error) {
+	if f.offline {
+		return storage.ObjectStat{}, errOffline
+	}
+	return f.LocalStorage.Stat(ctx, key)
+}
+
+func (f *flakyStorage) Walk(ctx context.Context, prefix string, fn func(storage.ObjectInfo) error) error {
+	if f.offline {
+		return errOffline
+	}
+	return f.LocalStorage.Walk(ctx, prefix, fn)
+}
+
+func newFlaky(t *testing.T) *flakyStorage {
+	s, err := local.NewLocalStorage(t.TempDir())
+	require.NoError(t, err)
+	return &flakyStorage{LocalStorage: s}
+}
+
+func readString(t *testing.T, s storage.Storage, key string) string {
+	t.Helper()
+	reader, _, err := s.Get(context.Background(), key)
+	require.NoError(t, err)
+	defer reader.Close()
+	data, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	return string(data)
+}
+
+func TestReplicatedStorage(t *testing.T) {
+	util.Logger = zap.NewNop()
+	ctx := context.Background()
+	primary, replica := newFlaky(t), newFlaky(t)
+	r := NewReplicatedStorage(Backend{Name: "primary", Storage: primary}, Backend{Name: "replica", Storage: replica})
+
+	_, err := r.Put(ctx, "Img/Img_UHD.jpg", strings.NewReader("image"), "image/jpeg")
+	require.NoError(t, err)
+	assert.Equal(t, "image", readString(t, primary, "Img/Img_UHD.jpg"))
+	assert.Equal(t, "image", readString(t, replica, "Img/Img_UHD.jpg"))
+
+	// 主存储离线时从副本读取，并在冷却期内跳过主存储
+	primary.offline = true
+	primary.gets = 0
+	assert.Equal(t, "image", readString(t, r, "Img/Img_UHD.jpg"))
+	assert.Equal(t, "image", readString(t, r, "Img/Img_UHD.jpg"))
+	assert.Equal(t, 1, primary.gets)
+	stat, err := r.Stat(ctx, "Img/Img_UHD.jpg")
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), stat.Size)
+	var keys []string
+	require.NoError(t, storage.Walk(ctx, r, "", func(obj storage.ObjectInfo) error {
+		keys = append(keys, obj.Key)
+		return nil
+	}))
+	assert.Equal(t, []string{"Img/Img_UHD.jpg"}, keys)
+
+	// 对象不存在不会把后端标记为故障
+	primary.offline = false
+	r.observe(0, nil)
+	_, _, err = r.Get(ctx, "missing.jpg")
+	assert.Error(t, err)
+	assert.Equal(t, []int{0, 1}, r.order())
+
+	require.NoError(t, r.Delete(ctx, "Img/Img_UHD.jpg"))
+	for _, s := range []storage.Storage{primary, replica} {
+		exists, err := s.Exists(ctx, "Img/Img_UHD.jpg")
+		require.NoError(t, err)
+		assert.False(t, exists)
+	}
+}
+
+func TestReplicatedStoragePrimaryWriteFailure(t *testing.T) {
+	util.Logger = zap.NewNop()
+	replica := newFlaky(t)
+	r := NewReplicatedStorage(Backend{Name: "primary", Storage: &readOnlyStorage{newFlaky(t)}}, Backend{Name: "replica", Storage: replica})
+
+	_, err := r.Put(context.Background(), "a/a_UHD.jpg", strings.NewReader("x"), "image/jpeg")
+	assert.Error(t, err)
+	exists, err := replica.Exists(context.Background(), "a/a_UHD.jpg")
+	require.NoError(t, err)
+	assert.False(t, exists)
+}
+
+type readOnlyStorage struct{ *flakyStorage }
+
+func (s *readOnlyStorage) Put(ctx context.Context, key string, r io.Reader, contentType string) (storage.StoredObject, error) {
+	return storage.StoredObject{}, errOffline
+}
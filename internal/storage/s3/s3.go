@@ -2,9 +2,13 @@ package s3
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"net/http"
 	"strings"
+	"sync"
+	"time"
 
 	"BingPaper/internal/storage"
 
@@ -13,15 +17,33 @@ import (
 	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 )
 
+// maxPresignTTL SigV4 预签名 URL 的最长有效期
+const maxPresignTTL = 7 * 24 * time.Hour
+
+// presignCacheSize 预签名 URL 缓存条目上限，超出时清理过期条目
+const presignCacheSize = 10000
+
 type S3Storage struct {
 	client          *s3.Client
 	bucket          string
 	publicURLPrefix string
+
+	presignClient *s3.PresignClient
+	presignTTL    time.Duration // 为 0 表示不生成预签名 URL
+	presignMu     sync.Mutex
+	presignCache  map[string]presignedURL
 }
 
-func NewS3Storage(endpoint, region, bucket, accessKey, secretKey, publicURLPrefix string, forcePathStyle bool) (*S3Storage, error) {
+type presignedURL struct {
+	url     string
+	expires time.Time
+}
+
+// NewS3Storage 创建 S3 存储，presignTTL 大于 0 时按该有效期生成预签名 URL
+func NewS3Storage(endpoint, region, bucket, accessKey, secretKey, publicURLPrefix string, forcePathStyle bool, presignTTL time.Duration) (*S3Storage, error) {
 	cfg, err := config.LoadDefaultConfig(context.TODO(),
 		config.WithRegion(region),
 		config.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(accessKey, secretKey, "")),
@@ -41,6 +63,9 @@ func NewS3Storage(endpoint, region, bucket, accessKey, secretKey, publicURLPrefi
 		client:          client,
 		bucket:          bucket,
 		publicURLPrefix: publicURLPrefix,
+		presignClient:   s3.NewPresignClient(client),
+		presignTTL:      min(presignTTL, maxPresignTTL),
+		presignCache:    make(map[string]presignedURL),
 	}, nil
 }
 
@@ -59,9 +84,11 @@ func (s *S3Storage) Put(ctx context.Context, key string, r io.Reader, contentTyp
 	publicURL := ""
 	if s.publicURLPrefix != "" {
 		publicURL = fmt.Sprintf("%s/%s", strings.TrimSuffix(s.publicURLPrefix, "/"), key)
-	} else {
+	} else if s.presignTTL == 0 {
+		// 私有桶的 Location 无法直接访问，开启预签名时在请求时生成 URL
 		publicURL = output.Location
 	}
+	s.forgetPresigned(key)
 
 	return storage.StoredObject{
 		Key:         key,
@@ -76,6 +103,9 @@ func (s *S3Storage) Get(ctx context.Context, key string) (io.ReadCloser, string,
 		Key:    aws.String(key),
 	})
 	if err != nil {
+		if isNotFound(err) {
+			return nil, "", fmt.Errorf("%w: %s", storage.ErrNotFound, key)
+		}
 		return nil, "", err
 	}
 	contentType := ""
@@ -86,6 +116,7 @@ func (s *S3Storage) Get(ctx context.Context, key string) (io.ReadCloser, string,
 }
 
 func (s *S3Storage) Delete(ctx context.Context, key string) error {
+	s.forgetPresigned(key)
 	_, err := s.client.DeleteObject(ctx, &s3.DeleteObjectInput{
 		Bucket: aws.String(s.bucket),
 		Key:    aws.String(key),
@@ -101,17 +132,129 @@ func (s *S3Storage) PublicURL(key string) (string, bool) {
 	return "", false
 }
 
+// PresignedURL 生成对象的预签名 GET URL。
+// 同一对象的 URL 会被缓存复用，直到剩余有效期不足一半，保证返回的 URL 至少还有 presignTTL/2 可用。
+func (s *S3Storage) PresignedURL(ctx context.Context, key string) (string, time.Time, error) {
+	if s.presignTTL == 0 {
+		return "", time.Time{}, storage.ErrPresignDisabled
+	}
+
+	now := time.Now()
+	s.presignMu.Lock()
+	cached, ok := s.presignCache[key]
+	s.presignMu.Unlock()
+	if ok && cached.expires.Sub(now) > s.presignTTL/2 {
+		return cached.url, cached.expires, nil
+	}
+
+	req, err := s.presignClient.PresignGetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	}, s3.WithPresignExpires(s.presignTTL))
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	entry := presignedURL{url: req.URL, expires: now.Add(s.presignTTL)}
+
+	s.presignMu.Lock()
+	if len(s.presignCache) >= presignCacheSize {
+		for k, v := range s.presignCache {
+			if v.expires.Sub(now) <= s.presignTTL/2 {
+				delete(s.presignCache, k)
+			}
+		}
+		if len(s.presignCache) >= presignCacheSize {
+			s.presignCache = make(map[string]presignedURL)
+		}
+	}
+	s.presignCache[key] = entry
+	s.presignMu.Unlock()
+	return entry.url, entry.expires, nil
+}
+
+func (s *S3Storage) forgetPresigned(key string) {
+	s.presignMu.Lock()
+	delete(s.presignCache, key)
+	s.presignMu.Unlock()
+}
+
 func (s *S3Storage) Exists(ctx context.Context, key string) (bool, error) {
 	_, err := s.client.HeadObject(ctx, &s3.HeadObjectInput{
 		Bucket: aws.String(s.bucket),
 		Key:    aws.String(key),
 	})
 	if err != nil {
-		// 判断是否为 404
-		if strings.Contains(err.Error(), "NotFound") || strings.Contains(err.Error(), "404") {
+		if isNotFound(err) {
 			return false, nil
 		}
 		return false, err
 	}
 	return true, nil
 }
+
+func (s *S3Storage) Stat(ctx context.Context, key string) (storage.ObjectStat, error) {
+	output, err := s.client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		if isNotFound(err) {
+			return storage.ObjectStat{}, fmt.Errorf("%w: %s", storage.ErrNotFound, key)
+		}
+		return storage.ObjectStat{}, err
+	}
+	stat := storage.ObjectStat{
+		Key:         key,
+		Size:        aws.ToInt64(output.ContentLength),
+		ContentType: aws.ToString(output.ContentType),
+		ETag:        storage.TrimETag(aws.ToString(output.ETag)),
+	}
+	if output.LastModified != nil {
+		stat.LastModified = *output.LastModified
+	}
+	return stat, nil
+}
+
+func (s *S3Storage) List(ctx context.Context, prefix string, opts storage.ListOptions) (storage.ListPage, error) {
+	limit := opts.Limit
+	if limit <= 0 {
+		limit = storage.DefaultListLimit
+	}
+	input := &s3.ListObjectsV2Input{
+		Bucket:  aws.String(s.bucket),
+		Prefix:  aws.String(prefix),
+		MaxKeys: aws.Int32(int32(limit)),
+	}
+	if opts.After != "" {
+		input.StartAfter = aws.String(opts.After)
+	}
+
+	output, err := s.client.ListObjectsV2(ctx, input)
+	if err != nil {
+		return storage.ListPage{}, err
+	}
+
+	page := storage.ListPage{Objects: make([]storage.ObjectInfo, 0, len(output.Contents))}
+	for _, obj := range output.Contents {
+		info := storage.ObjectInfo{Key: aws.ToString(obj.Key), Size: aws.ToInt64(obj.Size)}
+		if obj.LastModified != nil {
+			info.LastModified = *obj.LastModified
+		}
+		page.Objects = append(page.Objects, info)
+	}
+	if aws.ToBool(output.IsTruncated) && len(page.Objects) > 0 {
+		page.Next = page.Objects[len(page.Objects)-1].Key
+	}
+	return page, nil
+}
+
+// isNotFound 判断是否为 404：GetObject 返回 NoSuchKey，HeadObject 没有响应体，只能得到 NotFound 或状态码
+func isNotFound(err error) bool {
+	var noSuchKey *types.NoSuchKey
+	var notFound *types.NotFound
+	if errors.As(err, &noSuchKey) || errors.As(err, &notFound) {
+		return true
+	}
+	var respErr interface{ HTTPStatusCode() int }
+	return errors.As(err, &respErr) && respErr.HTTPStatusCode() == http.StatusNotFound
+}
@@ -0,0 +1,77 @@
+package s3
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"BingPaper/internal/storage"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPresignedURL(t *testing.T) {
+	ctx := context.Background()
+
+	s, err := NewS3Storage("http://127.0.0.1:9000", "us-east-1", "wallpapers", "ak", "sk", "", true, 10*time.Minute)
+	require.NoError(t, err)
+
+	url, expires, err := s.PresignedURL(ctx, "Img/Img_UHD.jpg")
+	require.NoError(t, err)
+	assert.Contains(t, url, "http://127.0.0.1:9000/wallpapers/Img/Img_UHD.jpg?")
+	assert.Contains(t, url, "X-Amz-Expires=600")
+	assert.Contains(t, url, "X-Amz-Signature=")
+	assert.WithinDuration(t, time.Now().Add(10*time.Minute), expires, 5*time.Second)
+
+	// 命中缓存时返回同一个 URL
+	cached, cachedExpires, err := s.PresignedURL(ctx, "Img/Img_UHD.jpg")
+	require.NoError(t, err)
+	assert.Equal(t, url, cached)
+	assert.Equal(t, expires, cachedExpires)
+
+	// 未开启预签名
+	s, err = NewS3Storage("http://127.0.0.1:9000", "us-east-1", "wallpapers", "ak", "sk", "", true, 0)
+	require.NoError(t, err)
+	_, _, err = s.PresignedURL(ctx, "Img/Img_UHD.jpg")
+	assert.ErrorIs(t, err, storage.ErrPresignDisabled)
+	var _ storage.Presigner = s
+}
+
+func TestNotFoundErrors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/xml")
+		if strings.HasSuffix(r.URL.Path, "/broken.jpg") {
+			// 错误信息中包含 404 字样，但并不是对象不存在
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte(`<Error><Code>AccessDenied</Code><Message>policy 404 denies access</Message></Error>`))
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+		if r.Method != http.MethodHead {
+			_, _ = w.Write([]byte(`<Error><Code>NoSuchKey</Code><Message>The specified key does not exist.</Message></Error>`))
+		}
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+	s, err := NewS3Storage(srv.URL, "us-east-1", "wallpapers", "ak", "sk", "", true, 0)
+	require.NoError(t, err)
+
+	_, _, err = s.Get(ctx, "missing.jpg")
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+	_, err = s.Stat(ctx, "missing.jpg")
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+	exists, err := s.Exists(ctx, "missing.jpg")
+	require.NoError(t, err)
+	assert.False(t, exists)
+
+	_, _, err = s.Get(ctx, "broken.jpg")
+	require.Error(t, err)
+	assert.NotErrorIs(t, err, storage.ErrNotFound)
+	_, err = s.Exists(ctx, "broken.jpg")
+	assert.Error(t, err)
+}
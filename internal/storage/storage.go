@@ -2,7 +2,14 @@ package storage
 
 import (
 	"context"
+	"errors"
 	"io"
+	"io/fs"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 type StoredObject struct {
@@ -12,17 +19,154 @@ type StoredObject struct {
 	PublicURL   string
 }
 
+// ObjectInfo 遍历存储时返回的对象信息
+type ObjectInfo struct {
+	Key          string    `json:"key"`
+	Size         int64     `json:"size"`
+	LastModified time.Time `json:"last_modified"`
+}
+
+// ObjectStat 单个对象的元数据，后端无法提供的字段为零值
+type ObjectStat struct {
+	Key          string
+	Size         int64
+	ContentType  string
+	ETag         string // 不含引号
+	LastModified time.Time
+}
+
+// ErrNotFound 表示对象不存在，各后端在 Get、Stat、Delete 中遇到不存在的对象时返回包装了它的错误
+var ErrNotFound = errors.New("object not found")
+
+// IsNotFound 判断错误是否表示对象不存在
+func IsNotFound(err error) bool {
+	return errors.Is(err, ErrNotFound) || errors.Is(err, fs.ErrNotExist)
+}
+
+// ErrPresignDisabled 表示后端支持但未开启预签名 URL
+var ErrPresignDisabled = errors.New("presigned urls are not enabled")
+
+// ListOptions 分页遍历参数
+type ListOptions struct {
+	After string // 仅返回字典序大于该 Key 的对象，用于翻页
+	Limit int    // 单页数量，<= 0 时使用 DefaultListLimit
+}
+
+// ListPage 一页遍历结果，Objects 按 Key 字典序排列
+type ListPage struct {
+	Objects []ObjectInfo
+	Next    string // 下一页的 After 参数，为空表示没有更多数据
+}
+
+// DefaultListLimit 未指定单页数量时的默认值
+const DefaultListLimit = 1000
+
 type Storage interface {
 	Put(ctx context.Context, key string, r io.Reader, contentType string) (StoredObject, error)
+	// Get 读取对象，对象不存在时返回包装了 ErrNotFound 的错误
 	Get(ctx context.Context, key string) (io.ReadCloser, string, error)
+	// Delete 删除对象。对象不存在时返回包装了 ErrNotFound 的错误，无法区分的后端（如 S3）返回 nil
 	Delete(ctx context.Context, key string) error
 	PublicURL(key string) (string, bool)
 	Exists(ctx context.Context, key string) (bool, error)
+	// List 按 Key 字典序分页遍历以 prefix 开头的对象，遍历全部对象应使用 Walk
+	List(ctx context.Context, prefix string, opts ListOptions) (ListPage, error)
+	// Stat 返回对象的元数据，对象不存在时返回包装了 ErrNotFound 的错误
+	Stat(ctx context.Context, key string) (ObjectStat, error)
 }
 
-var GlobalStorage Storage
+// Presigner 可由后端选择实现，用于生成限时访问的对象 URL（如私有 S3 桶）
+type Presigner interface {
+	// PresignedURL 返回对象的预签名 GET URL 及其过期时间
+	PresignedURL(ctx context.Context, key string) (string, time.Time, error)
+}
+
+// globalStorage 当前使用的存储，存储迁移完成后会在服务运行中被替换
+var globalStorage atomic.Pointer[Storage]
+
+// GlobalStorage 返回当前使用的存储，未初始化时返回 nil。
+// 一次操作涉及多次存储调用时应只获取一次，避免中途切换存储导致前后使用不同的后端。
+func GlobalStorage() Storage {
+	if s := globalStorage.Load(); s != nil {
+		return *s
+	}
+	return nil
+}
+
+// SetGlobalStorage 替换当前使用的存储，可与 GlobalStorage 并发调用
+func SetGlobalStorage(s Storage) {
+	globalStorage.Store(&s)
+}
+
+// writeBarrier 写入屏障，存储迁移切换存储前通过 PauseWrites 等待进行中的写入结束并阻止新的写入
+var writeBarrier sync.RWMutex
+
+// BeginWrite 进入写入区间，返回的函数用于结束该区间。写入对象及其数据库记录应在同一区间内完成，
+// 且应在 BeginWrite 之后再调用 GlobalStorage，以便写入暂停结束后使用切换后的存储。区间不可嵌套。
+func BeginWrite() func() {
+	writeBarrier.RLock()
+	return writeBarrier.RUnlock
+}
+
+// PauseWrites 阻止新的写入区间并等待进行中的写入结束，返回的函数用于恢复写入
+func PauseWrites() func() {
+	writeBarrier.Lock()
+	return writeBarrier.Unlock
+}
 
 func InitStorage() error {
 	// 实际初始化在 main.go 中根据配置调用对应的初始化函数
 	return nil
 }
+
+// Walker 可由后端选择实现，一次遍历全部对象。无法在服务端分页的后端（本地、WebDAV）
+// 每次 List 都要读取全部对象，实现 Walker 可避免 Walk 按页重复遍历。
+type Walker interface {
+	// Walk 遍历以 prefix 开头的全部对象，fn 返回错误时停止遍历并返回该错误
+	Walk(ctx context.Context, prefix string, fn func(ObjectInfo) error) error
+}
+
+// Walk 遍历以 prefix 开头的全部对象，fn 返回错误时停止遍历。
+// 后端实现了 Walker 时直接使用，此时不保证按 Key 字典序返回；否则按 List 逐页遍历。
+func Walk(ctx context.Context, s Storage, prefix string, fn func(ObjectInfo) error) error {
+	if w, ok := s.(Walker); ok {
+		return w.Walk(ctx, prefix, fn)
+	}
+	opts := ListOptions{}
+	for {
+		page, err := s.List(ctx, prefix, opts)
+		if err != nil {
+			return err
+		}
+		for _, obj := range page.Objects {
+			if err := fn(obj); err != nil {
+				return err
+			}
+		}
+		if page.Next == "" {
+			return nil
+		}
+		opts.After = page.Next
+	}
+}
+
+// PageObjects 对已排序的完整对象列表分页，供无法在服务端分页的后端使用
+func PageObjects(objects []ObjectInfo, opts ListOptions) ListPage {
+	limit := opts.Limit
+	if limit <= 0 {
+		limit = DefaultListLimit
+	}
+	start := sort.Search(len(objects), func(i int) bool { return objects[i].Key > opts.After })
+	end := min(start+limit, len(objects))
+	page := ListPage{Objects: objects[start:end]}
+	if end < len(objects) {
+		page.Next = objects[end-1].Key
+	}
+	return page
+}
+
+// TrimETag 去掉 ETag 两侧的引号及弱校验前缀
+func TrimETag(etag string) string {
+	etag = strings.TrimPrefix(etag, "W/")
+	return strings.Trim(etag, "\"")
+}
@@ -2,9 +2,13 @@ package webdav
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"net/http"
+	"os"
 	"path"
+	"sort"
 	"strings"
 
 	"BingPaper/internal/storage"
@@ -57,6 +61,9 @@ func (w *WebDAVStorage) Put(ctx context.Context, key string, r io.Reader, conten
 func (w *WebDAVStorage) Get(ctx context.Context, key string) (io.ReadCloser, string, error) {
 	reader, err := w.client.ReadStream(key)
 	if err != nil {
+		if isNotFound(err) {
+			return nil, "", fmt.Errorf("%w: %s", storage.ErrNotFound, key)
+		}
 		return nil, "", err
 	}
 	return reader, "", nil
@@ -78,10 +85,95 @@ func (w *WebDAVStorage) Exists(ctx context.Context, key string) (bool, error) {
 	if err == nil {
 		return true, nil
 	}
-	// gowebdav 的错误处理比较原始，通常 404 会返回错误
-	// 这里假设报错就是不存在，或者可以根据错误消息判断
-	if strings.Contains(err.Error(), "404") || strings.Contains(err.Error(), "not found") {
+	if isNotFound(err) {
 		return false, nil
 	}
 	return false, err
 }
+
+func (w *WebDAVStorage) Stat(ctx context.Context, key string) (storage.ObjectStat, error) {
+	info, err := w.client.Stat(key)
+	if err != nil {
+		if isNotFound(err) {
+			return storage.ObjectStat{}, fmt.Errorf("%w: %s", storage.ErrNotFound, key)
+		}
+		return storage.ObjectStat{}, err
+	}
+	if info.IsDir() {
+		return storage.ObjectStat{}, fmt.Errorf("%w: %s", storage.ErrNotFound, key)
+	}
+	stat := storage.ObjectStat{Key: key, Size: info.Size(), LastModified: info.ModTime()}
+	if f, ok := info.(*gowebdav.File); ok {
+		stat.ContentType = f.ContentType()
+		stat.ETag = storage.TrimETag(f.ETag())
+	}
+	return stat, nil
+}
+
+func (w *WebDAVStorage) List(ctx context.Context, prefix string, opts storage.ListOptions) (storage.ListPage, error) {
+	// WebDAV 不支持服务端分页，递归读取后在本地排序分页
+	var objects []storage.ObjectInfo
+	err := w.Walk(ctx, prefix, func(obj storage.ObjectInfo) error {
+		objects = append(objects, obj)
+		return nil
+	})
+	if err != nil {
+		return storage.ListPage{}, err
+	}
+
+	sort.Slice(objects, func(i, j int) bool { return objects[i].Key < objects[j].Key })
+	return storage.PageObjects(objects, opts), nil
+}
+
+// Walk 从 prefix 所在的目录递归读取一次全部对象，实现 storage.Walker
+func (w *WebDAVStorage) Walk(ctx context.Context, prefix string, fn func(storage.ObjectInfo) error) error {
+	dir := "/"
+	if idx := strings.LastIndex(prefix, "/"); idx != -1 {
+		dir = prefix[:idx]
+	}
+
+	var walk func(dir string) error
+	walk = func(dir string) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		entries, err := w.client.ReadDir(dir)
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			p := path.Join(dir, e.Name())
+			if e.IsDir() {
+				if err := walk(p); err != nil {
+					return err
+				}
+				continue
+			}
+			key := strings.TrimPrefix(p, "/")
+			if strings.HasPrefix(key, prefix) {
+				if err := fn(storage.ObjectInfo{Key: key, Size: e.Size(), LastModified: e.ModTime()}); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	if err := walk(dir); err != nil {
+		if dir != "/" && isNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+// isNotFound 判断是否为 404，gowebdav 以 *os.PathError 包装 StatusError 返回状态码。
+// Delete 时服务端返回 404 会被 gowebdav 视为成功，因此无法区分不存在的对象。
+func isNotFound(err error) bool {
+	var pathErr *os.PathError
+	if !errors.As(err, &pathErr) {
+		return false
+	}
+	status, ok := pathErr.Err.(gowebdav.StatusError)
+	return ok && status.Status == http.StatusNotFound
+}
@@ -1,6 +1,7 @@
 package util
 
 import (
+	"io"
 	"os"
 	"path/filepath"
 
@@ -12,6 +13,10 @@ import (
 var Logger *zap.Logger
 var DBLogger *zap.Logger
 
+// ConsoleOutput 控制台日志的输出目标，需在 InitLogger 之前设置。
+// 子命令把数据写到标准输出时（如 export -o -）改为 os.Stderr，避免日志混入数据。
+var ConsoleOutput io.Writer = os.Stdout
+
 // LogConfig 定义日志配置接口，避免循环依赖
 type LogConfig interface {
 	GetLevel() string
@@ -97,7 +102,7 @@ func createZapLogger(level, filename string, maxSize, maxBackups, maxAge int, co
 	if logConsole {
 		cores = append(cores, zapcore.NewCore(
 			zapcore.NewConsoleEncoder(encoderConfig),
-			zapcore.AddSync(os.Stdout),
+			zapcore.AddSync(ConsoleOutput),
 			zapLevel,
 		))
 	}
@@ -1,13 +1,23 @@
 package main
 
 import (
+	"context"
 	"embed"
+	"errors"
 	"flag"
 	"fmt"
 	"mime"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"BingPaper/internal/bootstrap"
 	"BingPaper/internal/config"
+	"BingPaper/internal/service/event"
+	"BingPaper/internal/service/job"
+	"BingPaper/internal/service/webhook"
 	"BingPaper/internal/util"
 
 	"go.uber.org/zap"
@@ -31,8 +41,22 @@ func main() {
 	var configPath string
 	flag.StringVar(&configPath, "config", "", "配置文件路径")
 	flag.StringVar(&configPath, "c", "", "配置文件路径 (简写)")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [-c config] [export|import [flags]]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
 	flag.Parse()
 
+	// 子命令
+	switch flag.Arg(0) {
+	case "export":
+		runExport(configPath, flag.Args()[1:])
+		return
+	case "import":
+		runImport(configPath, flag.Args()[1:])
+		return
+	}
+
 	// 注册常用 MIME 类型，确保嵌入式资源能被正确识别
 	mime.AddExtensionType(".js", "application/javascript")
 	mime.AddExtensionType(".css", "text/css")
@@ -46,8 +70,36 @@ func main() {
 
 	// 3. 启动服务
 	cfg := config.GetConfig()
+	srv := &http.Server{Addr: fmt.Sprintf(":%d", cfg.Server.Port), Handler: r}
+	// Shutdown 不会中断 SSE 长连接，需主动通知订阅者退出，否则会一直等到超时
+	srv.RegisterOnShutdown(event.Close)
 	util.Logger.Info("Server starting", zap.Int("port", cfg.Server.Port))
-	if err := r.Run(fmt.Sprintf(":%d", cfg.Server.Port)); err != nil {
-		util.Logger.Fatal("Server failed to start", zap.Error(err))
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			util.Logger.Fatal("Server failed to start", zap.Error(err))
+		}
+	}()
+
+	// 4. 收到退出信号后停止接收请求，中断运行中的任务，并等待尚未完成的 Webhook 投递
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	<-ctx.Done()
+	util.Logger.Info("Server shutting down")
+
+	waitShutdown("Server shutdown incomplete", srv.Shutdown)
+	// 任务结束时可能还会派发 Webhook，因此先于 Webhook 等待
+	waitShutdown("Running jobs did not stop in time", job.Shutdown)
+	waitShutdown("Pending webhook deliveries abandoned", webhook.Wait)
+}
+
+// shutdownTimeout 退出时每个阶段（HTTP 请求、后台任务、Webhook 投递）各自等待的最长时间
+const shutdownTimeout = 10 * time.Second
+
+// waitShutdown 以独立的超时执行一个退出阶段，避免前一阶段耗尽后续阶段的等待时间
+func waitShutdown(msg string, fn func(context.Context) error) {
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := fn(ctx); err != nil {
+		util.Logger.Warn(msg, zap.Error(err))
 	}
 }